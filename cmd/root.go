@@ -2,15 +2,23 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gandalfmagic/liveness-wrapper/internal"
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
+	"github.com/gandalfmagic/liveness-wrapper/internal/heartbeat"
 	"github.com/gandalfmagic/liveness-wrapper/internal/http"
+	"github.com/gandalfmagic/liveness-wrapper/internal/notify"
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/internal/sigmask"
 	"github.com/gandalfmagic/liveness-wrapper/internal/system"
 	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
 
@@ -21,8 +29,12 @@ import (
 
 const (
 	defaultPingTimeout     = 10 * time.Minute
+	defaultStdErrLines     = 20
 	defaultProcessTimeout  = 30 * time.Second
 	defaultShutdownTimeout = 15 * time.Second
+	defaultSpawnInterval   = 1 * time.Second
+	defaultHeartbeatFile   = 1 * time.Second
+	defaultMaintenanceFile = 1 * time.Second
 )
 
 var (
@@ -55,9 +67,37 @@ func init() {
 	RootCmd.PersistentFlags().Bool("process-hide-stderr", false, "Hide the stderr of the wrapped process from the logs")
 	RootCmd.PersistentFlags().Bool("process-fail-on-stderr", false, "Mark the wrapped process as failed if it writes logs on stderr")
 	RootCmd.PersistentFlags().Duration("process-timeout", defaultProcessTimeout, "Timeout to wait for a graceful shutdown")
+	RootCmd.PersistentFlags().Duration("process-startup-timeout", 0, "Time the wrapped process has to complete its startup calling the ping endpoint, use 0 to disable")
+	RootCmd.PersistentFlags().Bool("process-notify-socket", false, "Receive the sd_notify messages of the wrapped process, on a socket passed in the NOTIFY_SOCKET environment variable")
+	RootCmd.PersistentFlags().Int("process-spawn-retries", 0, "How many times to retry starting the wrapped process when its executable cannot be started")
+	RootCmd.PersistentFlags().Duration("process-spawn-retry-interval", defaultSpawnInterval, "Time to wait before retrying to start the wrapped process")
+	RootCmd.PersistentFlags().StringSlice("process-exit-codes", nil, "Comma separated list of rules to classify the exit codes of the wrapped process, as <code>[-<code>]:<success|transient|fatal|ignore>")
+	RootCmd.PersistentFlags().StringSlice("process-exit-code-map", nil, "Comma separated list of mappings from the exit codes of the wrapped process to the exit codes of the wrapper, as <code>[-<code>]:<code>")
+	RootCmd.PersistentFlags().String("process-termination-message-path", "/dev/termination-log", "Path of the termination message file written on exit, leave empty to disable")
+	RootCmd.PersistentFlags().Int("process-termination-message-lines", defaultStdErrLines, "Number of stderr lines of the wrapped process to add to the termination message")
 	RootCmd.PersistentFlags().StringP("server-address", "a", ":6060", "Bind address for the http server")
+	RootCmd.PersistentFlags().String("server-grpc-address", "", "Bind address for the grpc health server, leave empty to disable")
+	RootCmd.PersistentFlags().String("server-tls-cert-file", "", "Path of the certificate of the http server, to serve it with TLS")
+	RootCmd.PersistentFlags().String("server-tls-key-file", "", "Path of the private key of the certificate of the http server")
+	RootCmd.PersistentFlags().String("server-tls-client-ca-file", "", "Path of the certificate authorities verifying the client certificates, leave empty to ignore them")
+	RootCmd.PersistentFlags().String("server-metrics-address", "", "Bind address for the /metrics endpoint, leave empty to serve it on the http server")
 	RootCmd.PersistentFlags().DurationP("server-ping-timeout", "t", defaultPingTimeout, "Ping endpoint timeout, use 0 to disable")
+	RootCmd.PersistentFlags().Bool("server-ping-token", false, "Accept only the pings with the token of the running process, passed in the LIVENESS_WRAPPER_PING_TOKEN environment variable")
 	RootCmd.PersistentFlags().DurationP("server-shutdown-timeout", "s", defaultShutdownTimeout, "HTTP server shutdown timeout")
+	RootCmd.PersistentFlags().String("server-readiness", "wrapper", "Readiness policy: wrapper is ready as soon as the server starts, process only while the wrapped process is running")
+	RootCmd.PersistentFlags().Duration("server-readiness-delay", 0, "Time to wait after the startup of the wrapped process before it's ready, with the process readiness policy")
+	RootCmd.PersistentFlags().Bool("server-readiness-after-check", false, "Mark the wrapped process as ready only after its first successful health check, with the process readiness policy")
+	RootCmd.PersistentFlags().Bool("server-wait-child-ready", false, "Mark the server as not ready until the wrapped process calls the /ready/set endpoint, after every start")
+	RootCmd.PersistentFlags().Duration("server-stall-timeout", 0, "Mark the wrapped process as not alive if the progress reported on the ping endpoint doesn't increase within the timeout, use 0 to disable")
+	RootCmd.PersistentFlags().Bool("heartbeat-socket", false, "Receive the heartbeats of the wrapped process on a unix socket, passed in the LIVENESS_WRAPPER_HEARTBEAT_SOCKET environment variable")
+	RootCmd.PersistentFlags().String("heartbeat-socket-path", "", "Path of the heartbeat socket, leave empty to create it in a temporary directory")
+	RootCmd.PersistentFlags().String("heartbeat-signal", "", "Signal sent by the wrapped process to the wrapper as a heartbeat (SIGHUP, SIGUSR1, SIGUSR2 or SIGWINCH), leave empty to disable")
+	RootCmd.PersistentFlags().String("heartbeat-file", "", "Path of a file touched by the wrapped process as a heartbeat, leave empty to disable")
+	RootCmd.PersistentFlags().Bool("heartbeat-file-must-exist", false, "Mark the wrapped process as not alive while the heartbeat file is missing")
+	RootCmd.PersistentFlags().Duration("heartbeat-file-interval", defaultHeartbeatFile, "How often the mtime of the heartbeat file is checked")
+	RootCmd.PersistentFlags().String("maintenance-file", "", "Path of a file enabling the maintenance mode while it exists, leave empty to disable")
+	RootCmd.PersistentFlags().Duration("maintenance-file-interval", defaultMaintenanceFile, "How often the maintenance file is checked")
+	RootCmd.PersistentFlags().Bool("maintenance-pause-restarts", false, "Pause the automatic restarts of the wrapped process during the maintenance")
 	RootCmd.PersistentFlags().String("log-level", "WARN", "Output level of logs (TRACE, DEBUG, INFO, WARN, ERROR, FATAL)")
 
 	// cli-only flags
@@ -73,10 +113,38 @@ func init() {
 	_ = viper.BindPFlag("process.hide-stderr", RootCmd.PersistentFlags().Lookup("process-hide-stderr"))
 	_ = viper.BindPFlag("process.fail-on-stderr", RootCmd.PersistentFlags().Lookup("process-fail-on-stderr"))
 	_ = viper.BindPFlag("process.timeout", RootCmd.PersistentFlags().Lookup("process-timeout"))
+	_ = viper.BindPFlag("process.notify-socket", RootCmd.PersistentFlags().Lookup("process-notify-socket"))
+	_ = viper.BindPFlag("process.startup-timeout", RootCmd.PersistentFlags().Lookup("process-startup-timeout"))
+	_ = viper.BindPFlag("process.spawn-retries", RootCmd.PersistentFlags().Lookup("process-spawn-retries"))
+	_ = viper.BindPFlag("process.spawn-retry-interval", RootCmd.PersistentFlags().Lookup("process-spawn-retry-interval"))
+	_ = viper.BindPFlag("process.exit-codes", RootCmd.PersistentFlags().Lookup("process-exit-codes"))
+	_ = viper.BindPFlag("process.exit-code-map", RootCmd.PersistentFlags().Lookup("process-exit-code-map"))
+	_ = viper.BindPFlag("process.termination-message-path", RootCmd.PersistentFlags().Lookup("process-termination-message-path"))
+	_ = viper.BindPFlag("process.termination-message-lines", RootCmd.PersistentFlags().Lookup("process-termination-message-lines"))
 
 	_ = viper.BindPFlag("server.address", RootCmd.PersistentFlags().Lookup("server-address"))
+	_ = viper.BindPFlag("server.grpc-address", RootCmd.PersistentFlags().Lookup("server-grpc-address"))
+	_ = viper.BindPFlag("server.tls-cert-file", RootCmd.PersistentFlags().Lookup("server-tls-cert-file"))
+	_ = viper.BindPFlag("server.tls-key-file", RootCmd.PersistentFlags().Lookup("server-tls-key-file"))
+	_ = viper.BindPFlag("server.tls-client-ca-file", RootCmd.PersistentFlags().Lookup("server-tls-client-ca-file"))
+	_ = viper.BindPFlag("server.metrics-address", RootCmd.PersistentFlags().Lookup("server-metrics-address"))
 	_ = viper.BindPFlag("server.ping-timeout", RootCmd.PersistentFlags().Lookup("server-ping-timeout"))
+	_ = viper.BindPFlag("server.ping-token", RootCmd.PersistentFlags().Lookup("server-ping-token"))
 	_ = viper.BindPFlag("server.shutdown-timeout", RootCmd.PersistentFlags().Lookup("server-shutdown-timeout"))
+	_ = viper.BindPFlag("server.readiness", RootCmd.PersistentFlags().Lookup("server-readiness"))
+	_ = viper.BindPFlag("server.readiness-delay", RootCmd.PersistentFlags().Lookup("server-readiness-delay"))
+	_ = viper.BindPFlag("server.readiness-after-check", RootCmd.PersistentFlags().Lookup("server-readiness-after-check"))
+	_ = viper.BindPFlag("server.wait-child-ready", RootCmd.PersistentFlags().Lookup("server-wait-child-ready"))
+	_ = viper.BindPFlag("server.stall-timeout", RootCmd.PersistentFlags().Lookup("server-stall-timeout"))
+	_ = viper.BindPFlag("heartbeat.socket", RootCmd.PersistentFlags().Lookup("heartbeat-socket"))
+	_ = viper.BindPFlag("heartbeat.socket-path", RootCmd.PersistentFlags().Lookup("heartbeat-socket-path"))
+	_ = viper.BindPFlag("heartbeat.signal", RootCmd.PersistentFlags().Lookup("heartbeat-signal"))
+	_ = viper.BindPFlag("heartbeat.file", RootCmd.PersistentFlags().Lookup("heartbeat-file"))
+	_ = viper.BindPFlag("heartbeat.file-must-exist", RootCmd.PersistentFlags().Lookup("heartbeat-file-must-exist"))
+	_ = viper.BindPFlag("heartbeat.file-interval", RootCmd.PersistentFlags().Lookup("heartbeat-file-interval"))
+	_ = viper.BindPFlag("maintenance.file", RootCmd.PersistentFlags().Lookup("maintenance-file"))
+	_ = viper.BindPFlag("maintenance.file-interval", RootCmd.PersistentFlags().Lookup("maintenance-file-interval"))
+	_ = viper.BindPFlag("maintenance.pause-restarts", RootCmd.PersistentFlags().Lookup("maintenance-pause-restarts"))
 	_ = viper.BindPFlag("log.level", RootCmd.PersistentFlags().Lookup("log-level"))
 }
 
@@ -139,44 +207,583 @@ func getRestartMode(restartAlways, restartOnError bool) system.WrapperRestartMod
 	return system.WrapperRestartNever
 }
 
+// getChecks creates the health checks listed in the configuration.
+func getChecks() (health.Checks, error) {
+	var configs []health.Config
+	if err := viper.UnmarshalKey("checks", &configs); err != nil {
+		return nil, err
+	}
+
+	list := make([]*health.Check, 0, len(configs))
+
+	for _, cfg := range configs {
+		check, err := health.NewCheck(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, check)
+	}
+
+	return health.NewChecks(list...), nil
+}
+
+// getHeartbeats creates the named heartbeats listed in the
+// configuration.
+func getHeartbeats() ([]*http.Heartbeat, error) {
+	var configs []http.HeartbeatConfig
+	if err := viper.UnmarshalKey("server.heartbeats", &configs); err != nil {
+		return nil, err
+	}
+
+	list := make([]*http.Heartbeat, 0, len(configs))
+	names := make(map[string]struct{}, len(configs))
+
+	for _, cfg := range configs {
+		heartbeat, err := http.NewHeartbeat(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := names[heartbeat.Name()]; ok {
+			return nil, fmt.Errorf("%w: the name %s is duplicated", http.ErrInvalidHeartbeat, heartbeat.Name())
+		}
+
+		names[heartbeat.Name()] = struct{}{}
+		list = append(list, heartbeat)
+	}
+
+	return list, nil
+}
+
+// getHeartbeatSignal creates the heartbeat signal, it's nil if it's
+// not enabled. The signal is read with a signalfd, to verify its
+// sender, so it's blocked first: the wrapper may be executed again.
+func getHeartbeatSignal() (heartbeat.Signal, error) {
+	name := viper.GetString("heartbeat.signal")
+	if name == "" {
+		return nil, nil
+	}
+
+	sig, err := heartbeat.ParseSignal(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sigmask.Block(sig); err != nil {
+		return nil, err
+	}
+
+	return heartbeat.NewSignal(sig, procfs.NewFS(procfs.DefaultRoot))
+}
+
+// getAuth creates the authentication of the groups of routes listed in
+// the configuration, the groups which are not listed are open.
+func getAuth() (map[http.RouteGroup]*http.Auth, error) {
+	auth := make(map[http.RouteGroup]*http.Auth)
+
+	known := make(map[string]bool, len(http.RouteGroups))
+	for _, group := range http.RouteGroups {
+		known[string(group)] = true
+	}
+
+	groups := viper.GetStringMap("server.auth")
+	for name := range groups {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown route group %q, use one of probes, ping or admin", http.ErrInvalidAuth, name)
+		}
+	}
+
+	for _, group := range http.RouteGroups {
+		if _, ok := groups[string(group)]; !ok {
+			continue
+		}
+
+		key := "server.auth." + string(group)
+
+		var cfg http.AuthConfig
+		if err := viper.UnmarshalKey(key, &cfg); err != nil {
+			return nil, err
+		}
+
+		a, err := http.NewAuth(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+
+		auth[group] = a
+	}
+
+	return auth, nil
+}
+
+// getTLSConfig reads the TLS configuration of the http server, it's
+// nil if TLS is not enabled.
+func getTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := viper.GetString("server.tls-cert-file"), viper.GetString("server.tls-key-file")
+	clientCAFile := viper.GetString("server.tls-client-ca-file")
+
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("the client certificate authorities require the certificate of the server")
+		}
+
+		return nil, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both the certificate of the server and its private key are required")
+	}
+
+	return http.NewTLSConfig(certFile, keyFile, clientCAFile)
+}
+
+// getReadiness reads the readiness policy from the configuration.
+func getReadiness() (http.ReadinessConfig, error) {
+	policy, err := http.ParseReadinessPolicy(viper.GetString("server.readiness"))
+	if err != nil {
+		return http.ReadinessConfig{}, err
+	}
+
+	cfg := http.ReadinessConfig{
+		Policy:     policy,
+		Delay:      viper.GetDuration("server.readiness-delay"),
+		AfterCheck: viper.GetBool("server.readiness-after-check"),
+	}
+
+	if cfg.Policy == http.ReadinessWrapper && (cfg.Delay != 0 || cfg.AfterCheck) {
+		return http.ReadinessConfig{}, fmt.Errorf("%w: the delay and the health checks require the process policy", http.ErrInvalidReadiness)
+	}
+
+	if cfg.Delay < 0 {
+		return http.ReadinessConfig{}, fmt.Errorf("%w: the delay cannot be negative", http.ErrInvalidReadiness)
+	}
+
+	if cfg.AfterCheck {
+		var checks []health.Config
+		if err := viper.UnmarshalKey("checks", &checks); err != nil {
+			return http.ReadinessConfig{}, err
+		}
+
+		if len(checks) == 0 {
+			return http.ReadinessConfig{}, fmt.Errorf("%w: no health checks are configured", http.ErrInvalidReadiness)
+		}
+	}
+
+	return cfg, nil
+}
+
+// notifyCheckName is the name of the readiness check set by the
+// sd_notify messages of the wrapped process.
+const notifyCheckName = "sd_notify"
+
 type runner struct {
-	serverDone  <-chan struct{}
-	updateAlive chan<- bool
-	updateReady chan<- bool
-	wrapperData <-chan system.WrapperData
-	wrapperDone <-chan struct{}
+	checkResults           <-chan health.Result
+	childReady             chan<- bool
+	extendStartup          chan<- time.Duration
+	heartbeats             <-chan struct{}
+	isAlive                func() bool
+	isListening            bool
+	isRunning              bool
+	maintenance            <-chan bool
+	notifyMessages         <-chan notify.Message
+	pauseRestarts          func(paused bool)
+	pid                    int
+	ping                   chan<- bool
+	processState           http.ProcessState
+	serverDone             <-chan struct{}
+	serverErr              func() error
+	signalHeartbeats       <-chan struct{}
+	socketReady            <-chan bool
+	serverEvents           <-chan http.ServerEvent
+	startupSignal          chan<- struct{}
+	systemd                notify.Sender
+	systemdReady           bool
+	systemdStatus          string
+	systemdStopping        bool
+	systemdWatchdog        <-chan time.Time
+	terminationMessagePath string
+	updateAlive            chan<- bool
+	updateCheck            chan<- health.Result
+	updateChecks           chan<- health.ProcessState
+	updateHeartbeat        chan<- int
+	updateSignalHeartbeat  chan<- int
+	updateProcess          chan<- http.ProcessState
+	updateReady            chan<- bool
+	wrapperData            <-chan system.WrapperData
+	wrapperDone            <-chan struct{}
+}
+
+// writeTerminationMessage writes the final state of the wrapped
+// process in the termination message file, if one is configured.
+func (r *runner) writeTerminationMessage(ws system.WrapperData) {
+	if r.terminationMessagePath == "" {
+		return
+	}
+
+	if err := system.WriteTerminationMessage(r.terminationMessagePath, ws); err != nil {
+		logger.Warnf("cannot write the termination message on %s: %s", r.terminationMessagePath, err)
+	}
+}
+
+// sendStartupSignal notifies the wrapper that the running process
+// completed its startup.
+func (r *runner) sendStartupSignal() {
+	// don't block if a signal is already pending
+	select {
+	case r.startupSignal <- struct{}{}:
+	default:
+	}
+}
+
+// The send methods below don't block once the http server is done,
+// because its channels are not received anymore: the wrapper is
+// stopping, and the state they carry is not served.
+
+// sendPing pings the http server.
+func (r *runner) sendPing() {
+	select {
+	case r.ping <- true:
+	case <-r.serverDone:
+	}
+}
+
+// sendAlive updates the liveness set by the status of the process.
+func (r *runner) sendAlive(isAlive bool) {
+	select {
+	case r.updateAlive <- isAlive:
+	case <-r.serverDone:
+	}
+}
+
+// sendReady updates the readiness of the wrapper.
+func (r *runner) sendReady(isReady bool) {
+	select {
+	case r.updateReady <- isReady:
+	case <-r.serverDone:
+	}
+}
+
+// sendChildReady updates the readiness declared by the wrapped process.
+func (r *runner) sendChildReady(isReady bool) {
+	select {
+	case r.childReady <- isReady:
+	case <-r.serverDone:
+	}
+}
+
+// sendCheck updates the result of a health check.
+func (r *runner) sendCheck(result health.Result) {
+	select {
+	case r.updateCheck <- result:
+	case <-r.serverDone:
+	}
+}
+
+// sendProcessState updates the state of the process on the http server.
+func (r *runner) sendProcessState() {
+	select {
+	case r.updateProcess <- r.processState:
+	case <-r.serverDone:
+	}
+}
+
+// sendPid updates the process followed by the health checks and the
+// heartbeats.
+func (r *runner) sendPid(ws system.WrapperData) {
+	select {
+	case r.updateChecks <- health.ProcessState{Running: ws.WrapperStatus == system.WrapperStatusRunning, Restarts: ws.Restarts, Pid: ws.Pid}:
+	case <-r.serverDone:
+	}
+
+	if r.updateHeartbeat != nil {
+		select {
+		case r.updateHeartbeat <- ws.Pid:
+		case <-r.serverDone:
+		}
+	}
+
+	if r.updateSignalHeartbeat != nil {
+		select {
+		case r.updateSignalHeartbeat <- ws.Pid:
+		case <-r.serverDone:
+		}
+	}
+}
+
+// setNotifyReady updates the readiness set by the sd_notify messages.
+func (r *runner) setNotifyReady(isReady bool) {
+	r.sendCheck(health.Result{Name: notifyCheckName, Target: health.TargetReady, Healthy: isReady})
+}
+
+// handleNotify applies a sd_notify message sent by the wrapped process.
+func (r *runner) handleNotify(msg notify.Message) {
+	if msg.Ready {
+		logger.Infof("wrapped process notified it's ready")
+		r.sendStartupSignal()
+		r.setNotifyReady(true)
+	}
+
+	if msg.Stopping {
+		logger.Infof("wrapped process notified it's stopping")
+		r.setNotifyReady(false)
+	}
+
+	if msg.Watchdog {
+		r.sendPing()
+	}
+
+	if msg.HasStatus || msg.WatchdogTimeout > 0 {
+		if msg.HasStatus {
+			logger.Infof("wrapped process status: %s", msg.Status)
+			r.processState.Status = msg.Status
+		}
+
+		if msg.WatchdogTimeout > 0 {
+			r.processState.PingTimeout = msg.WatchdogTimeout
+		}
+
+		r.sendProcessState()
+	}
+
+	if msg.ExtendTimeout > 0 {
+		// don't block if a request is already pending
+		select {
+		case r.extendStartup <- msg.ExtendTimeout:
+		default:
+		}
+	}
+}
+
+// notifySystemd sends a message to systemd, if the wrapper runs
+// under it.
+func (r *runner) notifySystemd(assignments ...string) {
+	if r.systemd == nil {
+		return
+	}
+
+	if err := r.systemd.Send(assignments...); err != nil {
+		logger.Warnf("cannot notify systemd: %s", err)
+	}
+}
+
+// readySystemd notifies systemd that the wrapper is ready, once the
+// http server is listening and the wrapped process is running.
+func (r *runner) readySystemd() {
+	if r.systemdReady || !r.isListening || !r.isRunning {
+		return
+	}
+
+	r.systemdReady = true
+	r.notifySystemd("READY=1")
+}
+
+// updateSystemd notifies systemd of the state of the wrapped process.
+func (r *runner) updateSystemd(ws system.WrapperData) {
+	r.isRunning = ws.WrapperStatus == system.WrapperStatusRunning
+
+	if status := systemdStatus(ws); status != r.systemdStatus {
+		r.systemdStatus = status
+		r.notifySystemd("STATUS=" + status)
+	}
+
+	r.readySystemd()
+}
+
+// stopSystemd notifies systemd that the wrapper is shutting down.
+func (r *runner) stopSystemd() {
+	if r.systemdStopping {
+		return
+	}
+
+	r.systemdStopping = true
+	r.notifySystemd("STOPPING=1", "STATUS=stopping")
+}
+
+// systemdStatus describes the state of the wrapped process.
+func systemdStatus(ws system.WrapperData) string {
+	status := "process " + ws.WrapperStatus.String()
+
+	if ws.Err != nil {
+		status += ": " + ws.Err.Error()
+	}
+
+	if ws.Restarts > 0 {
+		status += fmt.Sprintf(" (restarts: %d)", ws.Restarts)
+	}
+
+	return status
+}
+
+// processExit converts the exit of the wrapped process for the server.
+func processExit(info *system.ExitInfo) *http.ProcessExit {
+	if info == nil {
+		return nil
+	}
+
+	return &http.ProcessExit{
+		Time:       info.Time,
+		ExitStatus: info.ExitStatus,
+		Signal:     info.Signal,
+		Cause:      info.Cause,
+		Reason:     info.Reason,
+	}
+}
+
+// outputMetrics exposes the output of the wrapped process on /metrics.
+func outputMetrics(wrapper system.WrapperHandler) http.MetricsCollector {
+	return func(m *http.MetricsWriter) {
+		stats := wrapper.OutputStats()
+
+		m.Family("process_output_lines_total", "counter", "Number of lines written by the wrapped process, by stream.")
+		m.Sample("process_output_lines_total", float64(stats.StdOutLines), "stream", "stdout")
+		m.Sample("process_output_lines_total", float64(stats.StdErrLines), "stream", "stderr")
+		m.Family("process_output_bytes_total", "counter", "Number of bytes written by the wrapped process, by stream.")
+		m.Sample("process_output_bytes_total", float64(stats.StdOutBytes), "stream", "stdout")
+		m.Sample("process_output_bytes_total", float64(stats.StdErrBytes), "stream", "stderr")
+	}
+}
+
+// controlCommands are the commands of the actions of the admin API.
+var controlCommands = map[string]system.ControlCommand{
+	"restart": system.ControlRestart,
+	"stop":    system.ControlStop,
+	"start":   system.ControlStart,
+	"signal":  system.ControlSignal,
+}
+
+// controlProcess applies the actions of the admin API on the wrapped
+// process.
+func controlProcess(wrapper system.WrapperHandler) http.ProcessController {
+	return func(ctx context.Context, action http.ProcessAction) error {
+		command, ok := controlCommands[action.Name]
+		if !ok {
+			return fmt.Errorf("unknown action %q", action.Name)
+		}
+
+		return wrapper.Control(ctx, system.ControlAction{Command: command, Signal: action.Signal, RequestedBy: action.RequestedBy})
+	}
 }
 
 func (r *runner) wait(cancelWrapper, cancelServer context.CancelFunc, c <-chan os.Signal) error {
 	defer close(r.updateAlive)
+	defer close(r.updateProcess)
 	defer close(r.updateReady)
 
+	if r.notifyMessages != nil {
+		// the process is not ready until it sends READY=1
+		r.setNotifyReady(false)
+	}
+
+	// the error of the http server, if it stops before the process
+	var serverErr error
+
+	serverDone := r.serverDone
+
 	for {
 		select {
+		case <-serverDone:
+			// the process cannot be probed anymore, it's stopped, and the
+			// wrapper exits with the error of the listener which failed
+			serverDone = nil
+
+			serverErr = errors.New("the http server stopped")
+			if err := r.serverErr(); err != nil {
+				serverErr = fmt.Errorf("the http server stopped: %w", err)
+			}
+
+			logger.Errorf("%s, stopping the process", serverErr)
+			r.stopSystemd()
+
+			cancelWrapper()
+
 		case <-c:
-			r.updateReady <- false
+			r.stopSystemd()
+			r.sendReady(false)
 
 			cancelWrapper()
 
+		case event := <-r.serverEvents:
+			switch event {
+			case http.ServerEventStartupSignal:
+				r.sendStartupSignal()
+			case http.ServerEventListening:
+				r.isListening = true
+				r.readySystemd()
+			}
+
+		case <-r.heartbeats:
+			r.sendPing()
+
+		case <-r.signalHeartbeats:
+			r.sendPing()
+
+		case isReady := <-r.socketReady:
+			r.sendChildReady(isReady)
+
+		case isEnabled := <-r.maintenance:
+			r.pauseRestarts(isEnabled)
+
+		case <-r.systemdWatchdog:
+			// systemd restarts the wrapper if the process is not alive
+			if r.isAlive() {
+				r.notifySystemd("WATCHDOG=1")
+			}
+
+		case msg := <-r.notifyMessages:
+			r.handleNotify(msg)
+
+		case result := <-r.checkResults:
+			r.sendCheck(result)
+
 		case ws := <-r.wrapperData:
+			if r.notifyMessages != nil && ws.Pid != 0 && ws.Pid != r.pid {
+				// a new process must send READY=1 again, and its own
+				// WATCHDOG_USEC
+				r.setNotifyReady(false)
+				r.processState.Status = ""
+				r.processState.PingTimeout = 0
+			}
+
+			r.pid = ws.Pid
+			r.updateSystemd(ws)
+			r.processState.Started = ws.Started
+			r.processState.Token = ws.Token
+			r.processState.Pid = ws.Pid
+			r.processState.State = ws.WrapperStatus.String()
+			r.processState.Reason = ws.Reason
+			r.processState.Restarts = ws.Restarts
+			r.processState.StartTime = ws.StartTime
+			r.processState.LastExit = processExit(ws.LastExit)
+			r.processState.RestartDelay = ws.RestartDelay
+			r.sendProcessState()
+			r.sendPid(ws)
+
 			// change the liveness state based on the process status
 			switch ws.WrapperStatus {
 			case system.WrapperStatusError:
-				r.updateAlive <- false
+				r.sendAlive(false)
 			case system.WrapperStatusRunning:
-				r.updateAlive <- true
+				r.sendAlive(true)
 			case system.WrapperStatusStopped:
-				r.updateAlive <- false
+				r.sendAlive(false)
 			}
 
 			if ws.Done {
-				r.updateReady <- false
+				r.stopSystemd()
+				r.sendReady(false)
 
 				cancelWrapper()
 				<-r.wrapperDone
 				cancelServer()
 				<-r.serverDone
 
+				r.writeTerminationMessage(ws)
+
+				if serverErr != nil {
+					return serverErr
+				}
+
 				return ws.Err
 			}
 		}
@@ -184,33 +791,245 @@ func (r *runner) wait(cancelWrapper, cancelServer context.CancelFunc, c <-chan o
 }
 
 func run(_ *cobra.Command, _ []string) error {
+	// the heartbeat signal is blocked before the environment is changed,
+	// the wrapper may be executed again to block it
+	heartbeatSignal, err := getHeartbeatSignal()
+	if err != nil {
+		return err
+	}
+
+	// when the wrapper runs under systemd, the variables of the
+	// protocol are removed before the wrapped process inherits them
+	systemd, err := notify.SenderFromEnv()
+	if err != nil {
+		logger.Warnf("cannot connect to the systemd notification socket: %s", err)
+	}
+
+	if systemd != nil {
+		defer systemd.Close()
+	}
+
+	// fail fast if the executable of the wrapped process doesn't exist
+	// or cannot be executed, instead of trying to start it over and over
+	path, err := system.LookPath(viper.GetString("process.path"))
+	if err != nil {
+		return err
+	}
+
+	exitCodes, err := system.ParseExitCodeRules(viper.GetStringSlice("process.exit-codes"))
+	if err != nil {
+		return err
+	}
+
+	exitCodeMap, err := system.ParseExitCodeMap(viper.GetStringSlice("process.exit-code-map"))
+	if err != nil {
+		return err
+	}
+
+	checks, err := getChecks()
+	if err != nil {
+		return err
+	}
+
+	namedHeartbeats, err := getHeartbeats()
+	if err != nil {
+		return err
+	}
+
+	readiness, err := getReadiness()
+	if err != nil {
+		return err
+	}
+
+	auth, err := getAuth()
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := getTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	var env []string
+
+	if heartbeatSignal != nil {
+		env = append(env, heartbeat.EnvPid+"="+strconv.Itoa(os.Getpid()))
+	}
+
+	var notifyListener notify.Listener
+
+	if viper.GetBool("process.notify-socket") {
+		if notifyListener, err = notify.Listen(); err != nil {
+			return err
+		}
+
+		env = append(env, notify.EnvSocket+"="+notifyListener.Path())
+
+		if pingTimeout := viper.GetDuration("server.ping-timeout"); pingTimeout > 0 {
+			env = append(env, notify.EnvWatchdogUsec+"="+strconv.FormatInt(pingTimeout.Microseconds(), 10))
+		}
+	}
+
+	var heartbeatSocket heartbeat.Socket
+
+	if viper.GetBool("heartbeat.socket") {
+		if heartbeatSocket, err = heartbeat.ListenSocket(viper.GetString("heartbeat.socket-path"), procfs.NewFS(procfs.DefaultRoot)); err != nil {
+			// the notify socket is only removed by its listener once
+			// it's started
+			if notifyListener != nil {
+				_ = notifyListener.Close()
+			}
+
+			return err
+		}
+
+		env = append(env, heartbeat.EnvSocket+"="+heartbeatSocket.Path())
+	}
+
 	ctx, cancelServer := context.WithCancel(context.Background())
 
+	restartMode := getRestartMode(viper.GetBool("process.restart-always"), viper.GetBool("process.restart-on-error"))
+
+	// create the wrapped process, its output is counted by the metrics
+	wrapperConfiguration := system.WrapperConfiguration{
+		RestartMode:        restartMode,
+		HideStdOut:         viper.GetBool("process.hide-stdout"),
+		HideStdErr:         viper.GetBool("process.hide-stderr"),
+		FailOnStdErr:       viper.GetBool("process.fail-on-stderr"),
+		Timeout:            viper.GetDuration("process.timeout"),
+		Path:               path,
+		StdErrLines:        viper.GetInt("process.termination-message-lines"),
+		ExitCodes:          exitCodes,
+		ExitCodeMap:        exitCodeMap,
+		SpawnRetries:       viper.GetInt("process.spawn-retries"),
+		SpawnRetryInterval: viper.GetDuration("process.spawn-retry-interval"),
+		StartupTimeout:     viper.GetDuration("process.startup-timeout"),
+		Env:                env,
+		PingToken:          viper.GetBool("server.ping-token"),
+	}
+	wrapper := system.NewWrapperHandler(wrapperConfiguration, viper.GetStringSlice("process.args")...)
+
+	serverOptions := []http.ServerOption{
+		http.WithGRPCAddress(viper.GetString("server.grpc-address")),
+		http.WithHeartbeats(namedHeartbeats...),
+		http.WithStallTimeout(viper.GetDuration("server.stall-timeout")),
+		http.WithReadiness(readiness),
+		http.WithStatusConfig(http.StatusConfig{
+			Version:        version,
+			Path:           path,
+			RestartMode:    restartMode.String(),
+			StopTimeout:    viper.GetDuration("process.timeout"),
+			StartupTimeout: viper.GetDuration("process.startup-timeout"),
+		}),
+		http.WithMetricsAddress(viper.GetString("server.metrics-address")),
+		http.WithProcFS(procfs.NewFS(procfs.DefaultRoot)),
+		http.WithMetricsCollector(outputMetrics(wrapper)),
+		http.WithProcessController(controlProcess(wrapper)),
+	}
+
+	for group, a := range auth {
+		serverOptions = append(serverOptions, http.WithAuth(group, a))
+	}
+
+	if tlsConfig != nil {
+		serverOptions = append(serverOptions, http.WithTLS(tlsConfig))
+	}
+
+	if viper.GetBool("server.ping-token") {
+		serverOptions = append(serverOptions, http.WithPingToken())
+	}
+
+	if viper.GetBool("server.wait-child-ready") {
+		serverOptions = append(serverOptions, http.WithWaitChildReady())
+	}
+
+	if path := viper.GetString("maintenance.file"); path != "" {
+		serverOptions = append(serverOptions, http.WithMaintenanceFile(path, viper.GetDuration("maintenance.file-interval")))
+	}
+
+	if path := viper.GetString("heartbeat.file"); path != "" {
+		serverOptions = append(serverOptions, http.WithHeartbeatFile(path, viper.GetBool("heartbeat.file-must-exist"), viper.GetDuration("heartbeat.file-interval")))
+	}
+
 	// create the http server
-	server := http.NewServer(viper.GetString("server.address"), viper.GetDuration("server.shutdown-timeout"), viper.GetDuration("server.ping-timeout"))
+	server := http.NewServer(viper.GetString("server.address"), viper.GetDuration("server.shutdown-timeout"), viper.GetDuration("server.ping-timeout"),
+		serverOptions...)
 	updateReady, updateAlive, serverDone := server.Start(ctx)
 
+	// start the health checks, they are stopped with the http server,
+	// after the wrapped process is done
+	checkResults := checks.Start(ctx)
+
+	var notifyMessages <-chan notify.Message
+	if notifyListener != nil {
+		notifyMessages = notifyListener.Start(ctx)
+	}
+
+	var signalHeartbeats <-chan struct{}
+
+	var updateSignalHeartbeat chan<- int
+
+	if heartbeatSignal != nil {
+		signalHeartbeats = heartbeatSignal.Start(ctx)
+		updateSignalHeartbeat = heartbeatSignal.UpdateProcess()
+	}
+
+	var heartbeats <-chan struct{}
+
+	var socketReady <-chan bool
+
+	var updateHeartbeat chan<- int
+
+	if heartbeatSocket != nil {
+		heartbeats = heartbeatSocket.Start(ctx)
+		socketReady = heartbeatSocket.Ready()
+		updateHeartbeat = heartbeatSocket.UpdateProcess()
+	}
+
 	ctx, cancelWrapper := context.WithCancel(context.Background())
 
 	// start the wrapped process
-	restartMode := getRestartMode(viper.GetBool("process.restart-always"), viper.GetBool("process.restart-on-error"))
-	wrapperConfiguration := system.WrapperConfiguration{
-		RestartMode:  restartMode,
-		HideStdOut:   viper.GetBool("process.hide-stdout"),
-		HideStdErr:   viper.GetBool("process.hide-stderr"),
-		FailOnStdErr: viper.GetBool("process.fail-on-stderr"),
-		Timeout:      viper.GetDuration("process.timeout"),
-		Path:         viper.GetString("process.path"),
-	}
-	wrapper := system.NewWrapperHandler(wrapperConfiguration, viper.GetStringSlice("process.args")...)
 	wrapperData, wrapperDone := wrapper.Start(ctx)
 
 	r := &runner{
-		serverDone:  serverDone,
-		updateAlive: updateAlive,
-		updateReady: updateReady,
-		wrapperData: wrapperData,
-		wrapperDone: wrapperDone,
+		checkResults:           checkResults,
+		childReady:             server.ChildReady(),
+		extendStartup:          wrapper.ExtendStartup(),
+		heartbeats:             heartbeats,
+		isAlive:                server.IsAlive,
+		notifyMessages:         notifyMessages,
+		ping:                   server.Ping(),
+		serverDone:             serverDone,
+		serverErr:              server.Err,
+		signalHeartbeats:       signalHeartbeats,
+		socketReady:            socketReady,
+		serverEvents:           server.Events(),
+		startupSignal:          wrapper.StartupSignal(),
+		systemd:                systemd,
+		terminationMessagePath: viper.GetString("process.termination-message-path"),
+		updateAlive:            updateAlive,
+		updateCheck:            server.UpdateCheck(),
+		updateChecks:           checks.UpdateProcess(),
+		updateHeartbeat:        updateHeartbeat,
+		updateProcess:          server.UpdateProcess(),
+		updateSignalHeartbeat:  updateSignalHeartbeat,
+		updateReady:            updateReady,
+		wrapperData:            wrapperData,
+		wrapperDone:            wrapperDone,
+	}
+
+	if viper.GetBool("maintenance.pause-restarts") {
+		r.maintenance = server.Maintenance()
+		r.pauseRestarts = wrapper.PauseRestarts
+	}
+
+	if systemd != nil && systemd.WatchdogTimeout() > 0 {
+		// systemd recommends to send the keep-alive at half of the timeout
+		ticker := time.NewTicker(systemd.WatchdogTimeout() / 2)
+		defer ticker.Stop()
+
+		r.systemdWatchdog = ticker.C
 	}
 
 	// create the channel to catch SIGINT signal
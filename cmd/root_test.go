@@ -2,17 +2,26 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"github.com/spf13/viper"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
+	"github.com/gandalfmagic/liveness-wrapper/internal/heartbeat"
 	myHttp "github.com/gandalfmagic/liveness-wrapper/internal/http"
+	"github.com/gandalfmagic/liveness-wrapper/internal/notify"
+	"github.com/gandalfmagic/liveness-wrapper/internal/sigmask"
 	"github.com/gandalfmagic/liveness-wrapper/internal/system"
 	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
 	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
@@ -20,6 +29,16 @@ import (
 
 var testDirectory = "../test"
 
+func TestMain(m *testing.M) {
+	// the heartbeat signal of the test configuration is blocked, like
+	// the wrapper does executing itself again
+	if err := sigmask.Block(syscall.SIGUSR1); err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
 func Test_readConfig(t *testing.T) {
 	t.Run("read_config", func(t *testing.T) {
 		config = "../test/config/liveness-wrapper.yaml"
@@ -63,21 +82,116 @@ func Test_readConfig(t *testing.T) {
 			t.Errorf("process.timeout expected: %v, got %v", 31*time.Second, processRestartTimeout)
 		}
 
+		processExitCodes := viper.GetStringSlice("process.exit-codes")
+		if !reflect.DeepEqual(processExitCodes, []string{"3:transient", "64-78:fatal"}) {
+			t.Errorf("process.exit-codes expected: %v, got %v", []string{"3:transient", "64-78:fatal"}, processExitCodes)
+		}
+
+		processExitCodeMap := viper.GetStringSlice("process.exit-code-map")
+		if !reflect.DeepEqual(processExitCodeMap, []string{"3:0"}) {
+			t.Errorf("process.exit-code-map expected: %v, got %v", []string{"3:0"}, processExitCodeMap)
+		}
+
+		processTerminationMessagePath := viper.GetString("process.termination-message-path")
+		if processTerminationMessagePath != "" {
+			t.Errorf("process.termination-message-path expected: %v, got %v", "", processTerminationMessagePath)
+		}
+
+		processTerminationMessageLines := viper.GetInt("process.termination-message-lines")
+		if processTerminationMessageLines != 10 {
+			t.Errorf("process.termination-message-lines expected: %v, got %v", 10, processTerminationMessageLines)
+		}
+
+		processStartupTimeout := viper.GetDuration("process.startup-timeout")
+		if processStartupTimeout != 5*time.Second {
+			t.Errorf("process.startup-timeout expected: %v, got %v", 5*time.Second, processStartupTimeout)
+		}
+
+		heartbeatSignal := viper.GetString("heartbeat.signal")
+		if heartbeatSignal != "SIGUSR1" {
+			t.Errorf("heartbeat.signal expected: %v, got %v", "SIGUSR1", heartbeatSignal)
+		}
+
+		if _, err := heartbeat.ParseSignal(heartbeatSignal); err != nil {
+			t.Errorf("heartbeat.signal: no error was expected, got one: %s", err)
+		}
+
+		heartbeatFileMustExist := viper.GetBool("heartbeat.file-must-exist")
+		if !heartbeatFileMustExist {
+			t.Errorf("heartbeat.file-must-exist expected: %v, got %v", true, heartbeatFileMustExist)
+		}
+
+		heartbeats, err := getHeartbeats()
+		if err != nil {
+			t.Errorf("server.heartbeats: no error was expected, got one: %s", err)
+		}
+
+		if len(heartbeats) != 1 {
+			t.Errorf("server.heartbeats: expected 1 heartbeat, got %d", len(heartbeats))
+		}
+
+		if _, err := getChecks(); err != nil {
+			t.Errorf("checks: no error was expected, got one: %s", err)
+		}
+
+		checks := viper.Get("checks").([]interface{})
+		if len(checks) != 1 {
+			t.Errorf("checks expected: %v items, got %v", 1, len(checks))
+		}
+
 		serverAddress := viper.GetString("server.address")
 		if serverAddress != ":6060" {
 			t.Errorf("process.timeout expected: %v, got %v", ":6060", serverAddress)
 		}
 
+		if metricsAddress := viper.GetString("server.metrics-address"); metricsAddress != ":9090" {
+			t.Errorf("server.metrics-address expected: %v, got %v", ":9090", metricsAddress)
+		}
+
+		auth, err := getAuth()
+		if err != nil {
+			t.Errorf("server.auth: no error was expected, got one: %s", err)
+		}
+
+		if _, ok := auth[myHttp.RouteGroupAdmin]; len(auth) != 1 || !ok {
+			t.Errorf("server.auth: expected the admin group only, got %v", auth)
+		}
+
+		if token := viper.GetString("server.auth.admin.token"); token != "secret" {
+			t.Errorf("server.auth.admin.token expected: %v, got %v", "secret", token)
+		}
+
 		serverPingTimeout := viper.GetDuration("server.ping-timeout")
 		if serverPingTimeout != 10*time.Minute {
 			t.Errorf("process.ping-timeout expected: %v, got %v", 10*time.Minute, serverPingTimeout)
 		}
 
+		if !viper.GetBool("server.ping-token") {
+			t.Errorf("server.ping-token expected: %v, got %v", true, false)
+		}
+
 		serverShutdownTimeout := viper.GetDuration("server.shutdown-timeout")
 		if serverShutdownTimeout != 15*time.Second {
 			t.Errorf("process.shutdown-timeout expected: %v, got %v", 15*time.Second, serverShutdownTimeout)
 		}
 
+		if readiness, err := getReadiness(); err != nil || readiness != (myHttp.ReadinessConfig{Policy: myHttp.ReadinessProcess, Delay: 1 * time.Second, AfterCheck: true}) {
+			t.Errorf("server.readiness: unexpected policy %+v (error: %v)", readiness, err)
+		}
+
+		if maintenanceFile := viper.GetString("maintenance.file"); maintenanceFile != "/tmp/liveness-wrapper-maintenance" || !viper.GetBool("maintenance.pause-restarts") {
+			t.Errorf("maintenance expected: %v with paused restarts, got %v (pause-restarts: %t)", "/tmp/liveness-wrapper-maintenance", maintenanceFile, viper.GetBool("maintenance.pause-restarts"))
+		}
+
+		if !viper.GetBool("server.wait-child-ready") {
+			t.Errorf("server.wait-child-ready expected: %v, got %v", true, false)
+		}
+
+		serverStallTimeout := viper.GetDuration("server.stall-timeout")
+		if serverStallTimeout != 5*time.Minute {
+			t.Errorf("server.stall-timeout expected: %v, got %v", 5*time.Minute, serverStallTimeout)
+		}
+
 		logLevel := viper.GetString("log.level")
 		if logLevel != "INFO" {
 			t.Errorf("log.level expected: %v, got %v", "INFO", logLevel)
@@ -127,6 +241,589 @@ func Test_getRestartMode(t *testing.T) {
 	}
 }
 
+func Test_runner_writeTerminationMessage(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		// nothing is written, not even in the working directory
+		dir := t.TempDir()
+
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		defer func() {
+			_ = os.Chdir(wd)
+		}()
+
+		r := &runner{}
+		r.writeTerminationMessage(system.WrapperData{Done: true, WrapperStatus: system.WrapperStatusStopped})
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 0 {
+			t.Errorf("no termination message was expected, got %d files", len(entries))
+		}
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "termination-log")
+		r := &runner{terminationMessagePath: path}
+
+		ws := system.WrapperData{
+			WrapperStatus: system.WrapperStatusError,
+			Err:           system.NewProcessExitStatusError(10),
+			Done:          true,
+			Restarts:      2,
+			StdErrTail:    []string{"write a line to stderr"},
+		}
+		r.writeTerminationMessage(ws)
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("the termination message was expected, got an error: %s", err)
+		}
+
+		if string(got) != system.TerminationMessage(ws) {
+			t.Errorf("termination message expected: %q, got %q", system.TerminationMessage(ws), got)
+		}
+	})
+}
+
+func Test_runner_handleNotify(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "test", "INFO")
+
+	extendStartup := make(chan time.Duration, 1)
+	ping := make(chan bool, 1)
+	startupSignal := make(chan struct{}, 1)
+	updateCheck := make(chan health.Result, 1)
+	updateProcess := make(chan myHttp.ProcessState, 1)
+
+	r := &runner{
+		extendStartup: extendStartup,
+		ping:          ping,
+		startupSignal: startupSignal,
+		updateCheck:   updateCheck,
+		updateProcess: updateProcess,
+	}
+
+	t.Run("Ready", func(t *testing.T) {
+		r.handleNotify(notify.Message{Ready: true})
+
+		if len(startupSignal) != 1 {
+			t.Errorf("a startup signal was expected")
+		}
+
+		want := health.Result{Name: notifyCheckName, Target: health.TargetReady, Healthy: true}
+		if got := <-updateCheck; got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+
+		// the pending startup signal doesn't block the runner
+		r.handleNotify(notify.Message{Ready: true})
+		<-updateCheck
+		<-startupSignal
+	})
+
+	t.Run("Stopping", func(t *testing.T) {
+		r.handleNotify(notify.Message{Stopping: true})
+
+		want := health.Result{Name: notifyCheckName, Target: health.TargetReady, Healthy: false}
+		if got := <-updateCheck; got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("Watchdog", func(t *testing.T) {
+		r.handleNotify(notify.Message{Watchdog: true})
+
+		if got := <-ping; !got {
+			t.Errorf("a ping was expected")
+		}
+	})
+
+	t.Run("Status_and_watchdog_timeout", func(t *testing.T) {
+		r.processState.Started = true
+
+		r.handleNotify(notify.Message{Status: "loading", HasStatus: true})
+
+		want := myHttp.ProcessState{Started: true, Status: "loading"}
+		if got := <-updateProcess; got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+
+		r.handleNotify(notify.Message{WatchdogTimeout: 5 * time.Second})
+
+		want = myHttp.ProcessState{Started: true, Status: "loading", PingTimeout: 5 * time.Second}
+		if got := <-updateProcess; got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	})
+
+	t.Run("Extend_timeout", func(t *testing.T) {
+		r.handleNotify(notify.Message{ExtendTimeout: 10 * time.Second})
+
+		if got := <-extendStartup; got != 10*time.Second {
+			t.Errorf("expected %s, got %s", 10*time.Second, got)
+		}
+	})
+
+	t.Run("Server_done", func(t *testing.T) {
+		serverDone := make(chan struct{})
+		close(serverDone)
+
+		// the channels of a stopped server are not received anymore
+		r := &runner{
+			ping:          make(chan bool),
+			serverDone:    serverDone,
+			updateCheck:   make(chan health.Result),
+			updateProcess: make(chan myHttp.ProcessState),
+		}
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			r.handleNotify(notify.Message{Ready: true, Watchdog: true, Status: "stopping", HasStatus: true})
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf("the runner is blocked on the stopped server")
+		}
+	})
+}
+
+func Test_runner_wait_Systemd(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "test", "INFO")
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	systemd, err := notify.NewSender(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer systemd.Close()
+
+	next := func() string {
+		t.Helper()
+
+		buf := make([]byte, 4096)
+
+		_ = conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("a message was expected, got %s", err)
+		}
+
+		return string(buf[:n])
+	}
+
+	noMessage := func() {
+		t.Helper()
+
+		buf := make([]byte, 4096)
+
+		_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+		if n, err := conn.Read(buf); err == nil {
+			t.Errorf("no message was expected, got %q", buf[:n])
+		}
+	}
+
+	var isAlive atomic.Bool
+	isAlive.Store(true)
+
+	// the server is done when it's cancelled
+	serverDone := make(chan struct{})
+
+	serverEvents := make(chan myHttp.ServerEvent)
+	watchdog := make(chan time.Time)
+	wrapperData := make(chan system.WrapperData)
+
+	wrapperDone := make(chan struct{})
+	close(wrapperDone)
+
+	r := &runner{
+		isAlive:         isAlive.Load,
+		serverDone:      serverDone,
+		serverEvents:    serverEvents,
+		systemd:         systemd,
+		systemdWatchdog: watchdog,
+		updateAlive:     make(chan bool, 10),
+		updateChecks:    make(chan health.ProcessState, 10),
+		updateProcess:   make(chan myHttp.ProcessState, 10),
+		updateReady:     make(chan bool, 10),
+		wrapperData:     wrapperData,
+		wrapperDone:     wrapperDone,
+	}
+
+	waitErr := make(chan error)
+
+	go func() {
+		waitErr <- r.wait(func() {}, func() { close(serverDone) }, make(chan os.Signal))
+	}()
+
+	// the process is running, but the http server is not listening yet
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusRunning}
+
+	if got := next(); got != "STATUS=process running" {
+		t.Errorf("expected the running status, got %q", got)
+	}
+
+	noMessage()
+
+	serverEvents <- myHttp.ServerEventListening
+
+	if got := next(); got != "READY=1" {
+		t.Errorf("expected the ready message, got %q", got)
+	}
+
+	// the keep-alive is sent only while the process is alive
+	watchdog <- time.Now()
+
+	if got := next(); got != "WATCHDOG=1" {
+		t.Errorf("expected the watchdog message, got %q", got)
+	}
+
+	isAlive.Store(false)
+
+	watchdog <- time.Now()
+
+	noMessage()
+
+	// the ready message is sent only once
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusError, Err: system.NewProcessExitStatusError(1)}
+
+	if got := next(); got != "STATUS=process error: "+system.NewProcessExitStatusError(1).Error() {
+		t.Errorf("expected the error status, got %q", got)
+	}
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusRunning, Restarts: 1}
+
+	if got := next(); got != "STATUS=process running (restarts: 1)" {
+		t.Errorf("expected the restarted status, got %q", got)
+	}
+
+	noMessage()
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusStopped, Restarts: 1, Done: true}
+
+	if got := next(); got != "STATUS=process stopped (restarts: 1)" {
+		t.Errorf("expected the stopped status, got %q", got)
+	}
+
+	if got := next(); got != "STOPPING=1\nSTATUS=stopping" {
+		t.Errorf("expected the stopping message, got %q", got)
+	}
+
+	if err := <-waitErr; err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+}
+
+func Test_runner_wait_Heartbeat(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "test", "INFO")
+
+	heartbeats := make(chan struct{})
+	ping := make(chan bool)
+	signalHeartbeats := make(chan struct{})
+	socketReady := make(chan bool)
+	childReady := make(chan bool)
+	updateHeartbeat := make(chan int, 10)
+	updateSignalHeartbeat := make(chan int, 10)
+	wrapperData := make(chan system.WrapperData)
+
+	// the server is done when it's cancelled
+	serverDone := make(chan struct{})
+
+	wrapperDone := make(chan struct{})
+	close(wrapperDone)
+
+	r := &runner{
+		childReady:            childReady,
+		heartbeats:            heartbeats,
+		ping:                  ping,
+		serverDone:            serverDone,
+		signalHeartbeats:      signalHeartbeats,
+		socketReady:           socketReady,
+		updateAlive:           make(chan bool, 10),
+		updateChecks:          make(chan health.ProcessState, 10),
+		updateHeartbeat:       updateHeartbeat,
+		updateProcess:         make(chan myHttp.ProcessState, 10),
+		updateReady:           make(chan bool, 10),
+		updateSignalHeartbeat: updateSignalHeartbeat,
+		wrapperData:           wrapperData,
+		wrapperDone:           wrapperDone,
+	}
+
+	waitErr := make(chan error)
+
+	go func() {
+		waitErr <- r.wait(func() {}, func() { close(serverDone) }, make(chan os.Signal))
+	}()
+
+	// the heartbeat socket and signal follow the pid of the wrapped process
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusRunning, Pid: 1234}
+
+	if pid := <-updateHeartbeat; pid != 1234 {
+		t.Errorf("expected the pid %d, got %d", 1234, pid)
+	}
+
+	if pid := <-updateSignalHeartbeat; pid != 1234 {
+		t.Errorf("expected the pid %d on the heartbeat signal, got %d", 1234, pid)
+	}
+
+	// a heartbeat is a ping
+	for _, c := range []chan struct{}{heartbeats, signalHeartbeats} {
+		c <- struct{}{}
+
+		select {
+		case <-ping:
+		case <-time.After(1 * time.Second):
+			t.Errorf("a ping was expected")
+		}
+	}
+
+	// the readiness declared on the socket is passed to the server
+	socketReady <- false
+
+	if isReady := <-childReady; isReady {
+		t.Errorf("expected the process to be not ready")
+	}
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusStopped, Done: true}
+
+	if pid := <-updateHeartbeat; pid != 0 {
+		t.Errorf("expected the pid %d, got %d", 0, pid)
+	}
+
+	if err := <-waitErr; err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+}
+
+func Test_runner_wait_Notify(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "test", "INFO")
+
+	notifyMessages := make(chan notify.Message)
+	updateProcess := make(chan myHttp.ProcessState, 10)
+	wrapperData := make(chan system.WrapperData)
+
+	// the server is done when it's cancelled
+	serverDone := make(chan struct{})
+
+	wrapperDone := make(chan struct{})
+	close(wrapperDone)
+
+	r := &runner{
+		notifyMessages: notifyMessages,
+		serverDone:     serverDone,
+		updateAlive:    make(chan bool, 10),
+		updateCheck:    make(chan health.Result, 10),
+		updateChecks:   make(chan health.ProcessState, 10),
+		updateProcess:  updateProcess,
+		updateReady:    make(chan bool, 10),
+		wrapperData:    wrapperData,
+		wrapperDone:    wrapperDone,
+	}
+
+	waitErr := make(chan error)
+
+	go func() {
+		waitErr <- r.wait(func() {}, func() { close(serverDone) }, make(chan os.Signal))
+	}()
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusRunning, Pid: 1234}
+	<-updateProcess
+
+	notifyMessages <- notify.Message{Status: "loading", HasStatus: true, WatchdogTimeout: 5 * time.Second}
+
+	if state := <-updateProcess; state.PingTimeout != 5*time.Second || state.Status != "loading" {
+		t.Errorf("expected the ping timeout %s and the status %q, got %+v", 5*time.Second, "loading", state)
+	}
+
+	// the next process doesn't inherit the watchdog timeout
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusRunning, Pid: 5678, Restarts: 1}
+
+	if state := <-updateProcess; state.PingTimeout != 0 || state.Status != "" {
+		t.Errorf("expected no ping timeout and no status, got %+v", state)
+	}
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusStopped, Done: true}
+
+	if err := <-waitErr; err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+}
+
+func Test_runner_wait_PingToken(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "test", "INFO")
+
+	updateProcess := make(chan myHttp.ProcessState, 10)
+	wrapperData := make(chan system.WrapperData)
+
+	// the server is done when it's cancelled
+	serverDone := make(chan struct{})
+
+	wrapperDone := make(chan struct{})
+	close(wrapperDone)
+
+	r := &runner{
+		serverDone:    serverDone,
+		updateAlive:   make(chan bool, 10),
+		updateChecks:  make(chan health.ProcessState, 10),
+		updateProcess: updateProcess,
+		updateReady:   make(chan bool, 10),
+		wrapperData:   wrapperData,
+		wrapperDone:   wrapperDone,
+	}
+
+	waitErr := make(chan error)
+
+	go func() {
+		waitErr <- r.wait(func() {}, func() { close(serverDone) }, make(chan os.Signal))
+	}()
+
+	// the token of the running process is passed to the server
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusRunning, Pid: 1234, Token: "abc"}
+
+	if state := <-updateProcess; state.Token != "abc" || state.Pid != 1234 {
+		t.Errorf("expected the token %q of the pid %d, got %q of the pid %d", "abc", 1234, state.Token, state.Pid)
+	}
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusStopped, Done: true}
+
+	if state := <-updateProcess; state.Token != "" {
+		t.Errorf("no token expected, got %q", state.Token)
+	}
+
+	if err := <-waitErr; err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+}
+
+func Test_runner_wait_Status(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "test", "INFO")
+
+	updateProcess := make(chan myHttp.ProcessState, 10)
+	wrapperData := make(chan system.WrapperData)
+
+	// the server is done when it's cancelled
+	serverDone := make(chan struct{})
+
+	wrapperDone := make(chan struct{})
+	close(wrapperDone)
+
+	r := &runner{
+		serverDone:    serverDone,
+		updateAlive:   make(chan bool, 10),
+		updateChecks:  make(chan health.ProcessState, 10),
+		updateProcess: updateProcess,
+		updateReady:   make(chan bool, 10),
+		wrapperData:   wrapperData,
+		wrapperDone:   wrapperDone,
+	}
+
+	waitErr := make(chan error)
+
+	go func() {
+		waitErr <- r.wait(func() {}, func() { close(serverDone) }, make(chan os.Signal))
+	}()
+
+	exitTime := time.Now()
+
+	// the state of the wrapped process is passed to the server
+	wrapperData <- system.WrapperData{
+		WrapperStatus: system.WrapperStatusError,
+		Restarts:      2,
+		LastExit:      &system.ExitInfo{Time: exitTime, ExitStatus: 137, Signal: "SIGKILL", Reason: "killed by SIGKILL"},
+		RestartDelay:  4 * time.Second,
+		Reason:        "killed by SIGKILL",
+	}
+
+	want := myHttp.ProcessState{
+		State:        "error",
+		Reason:       "killed by SIGKILL",
+		Restarts:     2,
+		LastExit:     &myHttp.ProcessExit{Time: exitTime, ExitStatus: 137, Signal: "SIGKILL", Reason: "killed by SIGKILL"},
+		RestartDelay: 4 * time.Second,
+	}
+
+	if state := <-updateProcess; !reflect.DeepEqual(state, want) {
+		t.Errorf("expected the state %+v, got %+v", want, state)
+	}
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusStopped, Done: true}
+
+	<-updateProcess
+
+	if err := <-waitErr; err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+}
+
+func Test_runner_wait_Maintenance(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "test", "INFO")
+
+	maintenance := make(chan bool)
+	paused := make(chan bool)
+	wrapperData := make(chan system.WrapperData)
+
+	// the server is done when it's cancelled
+	serverDone := make(chan struct{})
+
+	wrapperDone := make(chan struct{})
+	close(wrapperDone)
+
+	r := &runner{
+		maintenance:   maintenance,
+		pauseRestarts: func(isPaused bool) { paused <- isPaused },
+		serverDone:    serverDone,
+		updateAlive:   make(chan bool, 10),
+		updateChecks:  make(chan health.ProcessState, 10),
+		updateProcess: make(chan myHttp.ProcessState, 10),
+		updateReady:   make(chan bool, 10),
+		wrapperData:   wrapperData,
+		wrapperDone:   wrapperDone,
+	}
+
+	waitErr := make(chan error)
+
+	go func() {
+		waitErr <- r.wait(func() {}, func() { close(serverDone) }, make(chan os.Signal))
+	}()
+
+	// the restarts are paused during the maintenance
+	for _, isEnabled := range []bool{true, false} {
+		maintenance <- isEnabled
+
+		if isPaused := <-paused; isPaused != isEnabled {
+			t.Errorf("expected the restarts paused: %t, got %t", isEnabled, isPaused)
+		}
+	}
+
+	wrapperData <- system.WrapperData{WrapperStatus: system.WrapperStatusStopped, Done: true}
+
+	if err := <-waitErr; err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+}
+
 func Test_runner_wait(t *testing.T) {
 	console := testconsole.NewTestConsole()
 	logger.New(console, "test", "INFO")
@@ -138,6 +835,10 @@ func Test_runner_wait(t *testing.T) {
 		server := myHttp.NewServer("127.0.0.1:6060", 15*time.Second, 10*time.Minute)
 		updateReady, updateAlive, serverDone := server.Start(ctx)
 
+		// create the health checks
+		checks := health.NewChecks()
+		checkResults := checks.Start(ctx)
+
 		ctx, cancelWrapper := context.WithCancel(context.Background())
 
 		// start the wrapped process
@@ -153,11 +854,17 @@ func Test_runner_wait(t *testing.T) {
 		wrapperData, wrapperDone := process.Start(ctx)
 
 		r := &runner{
-			serverDone:  serverDone,
-			updateAlive: updateAlive,
-			updateReady: updateReady,
-			wrapperData: wrapperData,
-			wrapperDone: wrapperDone,
+			checkResults:  checkResults,
+			serverDone:    serverDone,
+			serverEvents:  server.Events(),
+			startupSignal: process.StartupSignal(),
+			updateAlive:   updateAlive,
+			updateCheck:   server.UpdateCheck(),
+			updateChecks:  checks.UpdateProcess(),
+			updateProcess: server.UpdateProcess(),
+			updateReady:   updateReady,
+			wrapperData:   wrapperData,
+			wrapperDone:   wrapperDone,
 		}
 
 		c := make(chan os.Signal, 1)
@@ -200,6 +907,10 @@ func Test_runner_wait(t *testing.T) {
 		server := myHttp.NewServer("127.0.0.1:6060", 15*time.Second, 10*time.Minute)
 		updateReady, updateAlive, serverDone := server.Start(ctx)
 
+		// create the health checks
+		checks := health.NewChecks()
+		checkResults := checks.Start(ctx)
+
 		ctx, cancelFuncProcess := context.WithCancel(context.Background())
 
 		// start the wrapped process
@@ -215,11 +926,17 @@ func Test_runner_wait(t *testing.T) {
 		wrapperData, wrapperDone := process.Start(ctx)
 
 		r := &runner{
-			serverDone:  serverDone,
-			updateAlive: updateAlive,
-			updateReady: updateReady,
-			wrapperData: wrapperData,
-			wrapperDone: wrapperDone,
+			checkResults:  checkResults,
+			serverDone:    serverDone,
+			serverEvents:  server.Events(),
+			startupSignal: process.StartupSignal(),
+			updateAlive:   updateAlive,
+			updateCheck:   server.UpdateCheck(),
+			updateChecks:  checks.UpdateProcess(),
+			updateProcess: server.UpdateProcess(),
+			updateReady:   updateReady,
+			wrapperData:   wrapperData,
+			wrapperDone:   wrapperDone,
 		}
 
 		c := make(chan os.Signal, 1)
@@ -263,6 +980,10 @@ func Test_runner_wait(t *testing.T) {
 		server := myHttp.NewServer("127.0.0.1:6060", 15*time.Second, 10*time.Minute)
 		updateReady, updateAlive, serverDone := server.Start(ctx)
 
+		// create the health checks
+		checks := health.NewChecks()
+		checkResults := checks.Start(ctx)
+
 		ctx, cancelWrapper := context.WithCancel(context.Background())
 
 		// start the wrapped process
@@ -278,11 +999,17 @@ func Test_runner_wait(t *testing.T) {
 		wrapperData, wrapperDone := process.Start(ctx)
 
 		r := &runner{
-			serverDone:  serverDone,
-			updateAlive: updateAlive,
-			updateReady: updateReady,
-			wrapperData: wrapperData,
-			wrapperDone: wrapperDone,
+			checkResults:  checkResults,
+			serverDone:    serverDone,
+			serverEvents:  server.Events(),
+			startupSignal: process.StartupSignal(),
+			updateAlive:   updateAlive,
+			updateCheck:   server.UpdateCheck(),
+			updateChecks:  checks.UpdateProcess(),
+			updateProcess: server.UpdateProcess(),
+			updateReady:   updateReady,
+			wrapperData:   wrapperData,
+			wrapperDone:   wrapperDone,
 		}
 
 		c := make(chan os.Signal, 1)
@@ -352,6 +1079,10 @@ func Test_runner_wait(t *testing.T) {
 		server := myHttp.NewServer("127.0.0.1:6060", 15*time.Second, 10*time.Minute)
 		updateReady, updateAlive, serverDone := server.Start(ctx)
 
+		// create the health checks
+		checks := health.NewChecks()
+		checkResults := checks.Start(ctx)
+
 		ctx, cancelWrapper := context.WithCancel(context.Background())
 
 		// start the wrapped process
@@ -367,11 +1098,17 @@ func Test_runner_wait(t *testing.T) {
 		wrapperData, wrapperDone := process.Start(ctx)
 
 		r := &runner{
-			serverDone:  serverDone,
-			updateAlive: updateAlive,
-			updateReady: updateReady,
-			wrapperData: wrapperData,
-			wrapperDone: wrapperDone,
+			checkResults:  checkResults,
+			serverDone:    serverDone,
+			serverEvents:  server.Events(),
+			startupSignal: process.StartupSignal(),
+			updateAlive:   updateAlive,
+			updateCheck:   server.UpdateCheck(),
+			updateChecks:  checks.UpdateProcess(),
+			updateProcess: server.UpdateProcess(),
+			updateReady:   updateReady,
+			wrapperData:   wrapperData,
+			wrapperDone:   wrapperDone,
 		}
 
 		c := make(chan os.Signal, 1)
@@ -437,6 +1174,10 @@ func Test_runner_wait(t *testing.T) {
 		server := myHttp.NewServer("127.0.0.1:6060", 15*time.Second, 10*time.Minute)
 		updateReady, updateAlive, serverDone := server.Start(ctx)
 
+		// create the health checks
+		checks := health.NewChecks()
+		checkResults := checks.Start(ctx)
+
 		ctx, cancelFuncProcess := context.WithCancel(context.Background())
 
 		// start the wrapped process
@@ -452,11 +1193,17 @@ func Test_runner_wait(t *testing.T) {
 		wrapperData, wrapperDone := process.Start(ctx)
 
 		r := &runner{
-			serverDone:  serverDone,
-			updateAlive: updateAlive,
-			updateReady: updateReady,
-			wrapperData: wrapperData,
-			wrapperDone: wrapperDone,
+			checkResults:  checkResults,
+			serverDone:    serverDone,
+			serverEvents:  server.Events(),
+			startupSignal: process.StartupSignal(),
+			updateAlive:   updateAlive,
+			updateCheck:   server.UpdateCheck(),
+			updateChecks:  checks.UpdateProcess(),
+			updateProcess: server.UpdateProcess(),
+			updateReady:   updateReady,
+			wrapperData:   wrapperData,
+			wrapperDone:   wrapperDone,
 		}
 
 		c := make(chan os.Signal, 1)
@@ -561,6 +1308,10 @@ func Test_runner_wait(t *testing.T) {
 		server := myHttp.NewServer("127.0.0.1:6060", 15*time.Second, 50*time.Millisecond)
 		updateReady, updateAlive, serverDone := server.Start(ctx)
 
+		// create the health checks
+		checks := health.NewChecks()
+		checkResults := checks.Start(ctx)
+
 		ctx, cancelFuncProcess := context.WithCancel(context.Background())
 
 		// start the wrapped process
@@ -576,11 +1327,17 @@ func Test_runner_wait(t *testing.T) {
 		wrapperData, wrapperDone := process.Start(ctx)
 
 		r := &runner{
-			serverDone:  serverDone,
-			updateAlive: updateAlive,
-			updateReady: updateReady,
-			wrapperData: wrapperData,
-			wrapperDone: wrapperDone,
+			checkResults:  checkResults,
+			serverDone:    serverDone,
+			serverEvents:  server.Events(),
+			startupSignal: process.StartupSignal(),
+			updateAlive:   updateAlive,
+			updateCheck:   server.UpdateCheck(),
+			updateChecks:  checks.UpdateProcess(),
+			updateProcess: server.UpdateProcess(),
+			updateReady:   updateReady,
+			wrapperData:   wrapperData,
+			wrapperDone:   wrapperDone,
 		}
 
 		c := make(chan os.Signal, 1)
@@ -700,6 +1457,318 @@ func Test_runner_wait(t *testing.T) {
 	})
 }
 
+func Test_getChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		checks  []map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name:   "no_checks",
+			checks: nil,
+		},
+		{
+			name: "valid_checks",
+			checks: []map[string]interface{}{
+				{"name": "http", "type": "http", "target": "alive", "url": "http://127.0.0.1:8080/health", "interval": "5s"},
+				{"name": "exec", "type": "exec", "target": "ready", "command": []string{"true"}},
+			},
+		},
+		{
+			name: "invalid_target",
+			checks: []map[string]interface{}{
+				{"name": "tcp", "type": "tcp", "target": "started", "address": "127.0.0.1:8080"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid_duration",
+			checks: []map[string]interface{}{
+				{"name": "tcp", "type": "tcp", "target": "ready", "address": "127.0.0.1:8080", "interval": "soon"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("checks", tt.checks)
+			defer viper.Set("checks", nil)
+
+			_, err := getChecks()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getChecks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_getHeartbeats(t *testing.T) {
+	tests := []struct {
+		name       string
+		heartbeats []map[string]interface{}
+		want       int
+		wantErr    bool
+	}{
+		{
+			name:       "no_heartbeats",
+			heartbeats: nil,
+		},
+		{
+			name: "valid_heartbeats",
+			heartbeats: []map[string]interface{}{
+				{"name": "worker", "timeout": "30s"},
+				{"name": "cleanup", "timeout": "1h", "optional": true},
+			},
+			want: 2,
+		},
+		{
+			name: "invalid_timeout",
+			heartbeats: []map[string]interface{}{
+				{"name": "worker", "timeout": "soon"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicated_name",
+			heartbeats: []map[string]interface{}{
+				{"name": "worker", "timeout": "30s"},
+				{"name": "worker", "timeout": "1m"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.heartbeats", tt.heartbeats)
+			defer viper.Set("server.heartbeats", nil)
+
+			got, err := getHeartbeats()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getHeartbeats() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != tt.want {
+				t.Errorf("getHeartbeats() returned %d heartbeats, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_getHeartbeatSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		signal  string
+		want    bool
+		wantErr error
+	}{
+		{name: "no_signal"},
+		{name: "signal", signal: "SIGUSR1", want: true},
+		{name: "invalid_signal", signal: "SIGTERM", wantErr: heartbeat.ErrInvalidSignal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("heartbeat.signal", tt.signal)
+			defer viper.Set("heartbeat.signal", nil)
+
+			got, err := getHeartbeatSignal()
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("getHeartbeatSignal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (got != nil) != tt.want {
+				t.Errorf("getHeartbeatSignal() = %v, want a signal %v", got, tt.want)
+			}
+
+			if got != nil {
+				ctx, cancel := context.WithCancel(context.Background())
+				got.Start(ctx)
+				cancel()
+			}
+		})
+	}
+}
+
+func Test_getAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    map[string]interface{}
+		want    []myHttp.RouteGroup
+		wantErr bool
+	}{
+		{
+			name: "no_auth",
+			auth: map[string]interface{}{},
+		},
+		{
+			name: "valid_auth",
+			auth: map[string]interface{}{
+				"admin": map[string]interface{}{"token": "secret", "allow": []string{"127.0.0.1", "10.0.0.0/8"}},
+				"ping":  map[string]interface{}{"allow": []string{"127.0.0.1"}},
+			},
+			want: []myHttp.RouteGroup{myHttp.RouteGroupPing, myHttp.RouteGroupAdmin},
+		},
+		{
+			name: "unknown_group",
+			auth: map[string]interface{}{
+				"logs": map[string]interface{}{"token": "secret"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid_network",
+			auth: map[string]interface{}{
+				"probes": map[string]interface{}{"allow": []string{"10.0.0.0/33"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "plain_password",
+			auth: map[string]interface{}{
+				"admin": map[string]interface{}{"basic": []map[string]interface{}{{"user": "alice", "password-hash": "secret"}}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.auth", tt.auth)
+			defer viper.Set("server.auth", nil)
+
+			got, err := getAuth()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("getAuth() returned %d groups, want %d", len(got), len(tt.want))
+			}
+
+			for _, group := range tt.want {
+				if got[group] == nil {
+					t.Errorf("getAuth() expected the group %s", group)
+				}
+			}
+		})
+	}
+}
+
+func Test_getTLSConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		certFile     string
+		keyFile      string
+		clientCAFile string
+		wantErr      bool
+	}{
+		{name: "no_tls"},
+		{name: "missing_key", certFile: "server.crt", wantErr: true},
+		{name: "client_ca_only", clientCAFile: "ca.crt", wantErr: true},
+		{name: "missing_files", certFile: "missing.crt", keyFile: "missing.key", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.tls-cert-file", tt.certFile)
+			viper.Set("server.tls-key-file", tt.keyFile)
+			viper.Set("server.tls-client-ca-file", tt.clientCAFile)
+
+			defer func() {
+				viper.Set("server.tls-cert-file", "")
+				viper.Set("server.tls-key-file", "")
+				viper.Set("server.tls-client-ca-file", "")
+			}()
+
+			got, err := getTLSConfig()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != nil {
+				t.Errorf("getTLSConfig() expected no configuration, got %v", got)
+			}
+		})
+	}
+}
+
+func Test_getReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		readiness  string
+		delay      string
+		afterCheck bool
+		checks     []map[string]interface{}
+		want       myHttp.ReadinessConfig
+		wantErr    bool
+	}{
+		{
+			name:      "wrapper",
+			readiness: "wrapper",
+			want:      myHttp.ReadinessConfig{Policy: myHttp.ReadinessWrapper},
+		},
+		{
+			name:      "process",
+			readiness: "process",
+			delay:     "10s",
+			want:      myHttp.ReadinessConfig{Policy: myHttp.ReadinessProcess, Delay: 10 * time.Second},
+		},
+		{
+			name:       "process_after_check",
+			readiness:  "process",
+			afterCheck: true,
+			checks: []map[string]interface{}{
+				{"name": "server", "type": "tcp", "address": "127.0.0.1:8080"},
+			},
+			want: myHttp.ReadinessConfig{Policy: myHttp.ReadinessProcess, AfterCheck: true},
+		},
+		{
+			name:       "after_check_without_checks",
+			readiness:  "process",
+			afterCheck: true,
+			wantErr:    true,
+		},
+		{
+			name:      "wrapper_with_delay",
+			readiness: "wrapper",
+			delay:     "10s",
+			wantErr:   true,
+		},
+		{
+			name:      "negative_delay",
+			readiness: "process",
+			delay:     "-1s",
+			wantErr:   true,
+		},
+		{
+			name:      "unknown_policy",
+			readiness: "always",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("server.readiness", tt.readiness)
+			viper.Set("server.readiness-delay", tt.delay)
+			viper.Set("server.readiness-after-check", tt.afterCheck)
+			viper.Set("checks", tt.checks)
+
+			defer func() {
+				viper.Set("server.readiness", nil)
+				viper.Set("server.readiness-delay", nil)
+				viper.Set("server.readiness-after-check", nil)
+				viper.Set("checks", nil)
+			}()
+
+			got, err := getReadiness()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getReadiness() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("getReadiness() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_run(t *testing.T) {
 	t.Run("run", func(t *testing.T) {
 		config = "../test/config/liveness-wrapper.yaml"
@@ -714,4 +1783,86 @@ func Test_run(t *testing.T) {
 
 		config = ""
 	})
+
+	t.Run("process_not_found", func(t *testing.T) {
+		viper.Set("process.path", filepath.Join(testDirectory, "cmd/command_not_found.sh"))
+		defer viper.Set("process.path", nil)
+
+		err := run(nil, nil)
+
+		e, ok := err.(system.ProcessExitStatusError)
+		if !ok {
+			t.Fatalf("run: a ProcessExitStatusError was expected, got %v", err)
+		}
+
+		if e.ExitStatus() != 127 {
+			t.Errorf("run: exit status 127 was expected, got %d", e.ExitStatus())
+		}
+	})
+
+	t.Run("heartbeat_socket_error", func(t *testing.T) {
+		tmp := t.TempDir()
+		t.Setenv("TMPDIR", tmp)
+
+		viper.Set("process.notify-socket", true)
+		viper.Set("heartbeat.socket", true)
+		viper.Set("heartbeat.socket-path", filepath.Join(tmp, "missing", "heartbeat.sock"))
+
+		defer func() {
+			for _, k := range []string{"process.notify-socket", "heartbeat.socket", "heartbeat.socket-path"} {
+				viper.Set(k, nil)
+			}
+		}()
+
+		if err := run(nil, nil); err == nil {
+			t.Fatalf("run: an error was expected")
+		}
+
+		// the notify socket, created before, is removed
+		entries, err := os.ReadDir(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != 0 {
+			t.Errorf("run: expected no temporary files, got %d", len(entries))
+		}
+	})
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	// the wrapper exits if a listener fails, the process cannot be probed
+	for _, key := range []string{"server.grpc-address", "server.metrics-address"} {
+		t.Run(key+"_in_use", func(t *testing.T) {
+			viper.Set("process.path", "/bin/sleep")
+			viper.Set("process.args", []string{"30"})
+			viper.Set("server.address", "127.0.0.1:0")
+			viper.Set(key, busy.Addr().String())
+
+			defer func() {
+				for _, k := range []string{"process.path", "process.args", "server.address", key} {
+					viper.Set(k, nil)
+				}
+			}()
+
+			runErr := make(chan error)
+
+			go func() {
+				runErr <- run(nil, nil)
+			}()
+
+			select {
+			case err := <-runErr:
+				if err == nil || !strings.Contains(err.Error(), "the http server stopped") {
+					t.Errorf("run: the error of the http server was expected, got %v", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("run: the wrapper was expected to exit")
+			}
+		})
+	}
 }
@@ -0,0 +1,415 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+const (
+	defaultInterval         = 10 * time.Second
+	defaultTimeout          = 1 * time.Second
+	defaultSuccessThreshold = 1
+	defaultFailureThreshold = 3
+	maxPort                 = 65535
+)
+
+var ErrInvalidCheck = errors.New("invalid health check")
+
+type Target int
+
+const (
+	// TargetAlive makes the result of a check part of the liveness
+	// of the wrapped process.
+	TargetAlive Target = iota
+	// TargetReady makes the result of a check part of the readiness
+	// of the wrapped process.
+	TargetReady
+)
+
+func (t Target) String() string {
+	switch t {
+	case TargetAlive:
+		return "alive"
+	case TargetReady:
+		return "ready"
+	}
+
+	return "unknown"
+}
+
+// ParseTarget parses the target of a check, alive or ready.
+func ParseTarget(value string) (Target, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "alive":
+		return TargetAlive, nil
+	case "ready":
+		return TargetReady, nil
+	}
+
+	return 0, fmt.Errorf("%w: unknown target %q", ErrInvalidCheck, value)
+}
+
+// Config is the configuration of a health check, as read from the
+// configuration file.
+type Config struct {
+	Name             string        `mapstructure:"name"`
+	Type             string        `mapstructure:"type"`
+	Target           string        `mapstructure:"target"`
+	Interval         time.Duration `mapstructure:"interval"`
+	Timeout          time.Duration `mapstructure:"timeout"`
+	InitialDelay     time.Duration `mapstructure:"initial-delay"`
+	SuccessThreshold int           `mapstructure:"success-threshold"`
+	FailureThreshold int           `mapstructure:"failure-threshold"`
+
+	// http checks
+	URL            string `mapstructure:"url"`
+	ExpectedStatus int    `mapstructure:"expected-status"`
+	BodyRegex      string `mapstructure:"body-regex"`
+
+	// tcp and grpc checks
+	Address string `mapstructure:"address"`
+
+	// grpc checks
+	Service               string `mapstructure:"service"`
+	TLS                   bool   `mapstructure:"tls"`
+	TLSCA                 string `mapstructure:"tls-ca"`
+	TLSServerName         string `mapstructure:"tls-server-name"`
+	TLSInsecureSkipVerify bool   `mapstructure:"tls-insecure-skip-verify"`
+
+	// exec checks
+	Command  []string `mapstructure:"command"`
+	ExitCode int      `mapstructure:"exit-code"`
+
+	// port checks
+	Ports []int `mapstructure:"ports"`
+}
+
+// Result is the state of a check, it's sent every time the check
+// becomes healthy or unhealthy, and after the first successful probe
+// of every execution of the process.
+type Result struct {
+	Name    string
+	Target  Target
+	Healthy bool
+	Err     error
+	// Probed is false for the initial state of the check, before the
+	// probe is executed.
+	Probed bool
+}
+
+// ProcessState is the state of the wrapped process, the checks are
+// executed only while the process is running, and they start again
+// from their initial state every time the process is restarted.
+type ProcessState struct {
+	Running  bool
+	Restarts int
+	Pid      int
+}
+
+type Check struct {
+	failureThreshold int
+	initialDelay     time.Duration
+	interval         time.Duration
+	name             string
+	probe            Probe
+	successThreshold int
+	target           Target
+	timeout          time.Duration
+}
+
+// NewCheck creates a check from its configuration, using the
+// default values for the settings left empty.
+func NewCheck(cfg Config) (*Check, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("%w: the name is missing", ErrInvalidCheck)
+	}
+
+	target, err := ParseTarget(cfg.Target)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Name, err)
+	}
+
+	probe, err := newProbe(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Name, err)
+	}
+
+	if cfg.Interval < 0 || cfg.Timeout < 0 || cfg.InitialDelay < 0 || cfg.SuccessThreshold < 0 || cfg.FailureThreshold < 0 {
+		return nil, fmt.Errorf("%w: %s: the durations and the thresholds cannot be negative", ErrInvalidCheck, cfg.Name)
+	}
+
+	return &Check{
+		failureThreshold: valueOrDefault(cfg.FailureThreshold, defaultFailureThreshold),
+		initialDelay:     cfg.InitialDelay,
+		interval:         durationOrDefault(cfg.Interval, defaultInterval),
+		name:             cfg.Name,
+		probe:            probe,
+		successThreshold: valueOrDefault(cfg.SuccessThreshold, defaultSuccessThreshold),
+		target:           target,
+		timeout:          durationOrDefault(cfg.Timeout, defaultTimeout),
+	}, nil
+}
+
+func newProbe(cfg Config) (Probe, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%w: the url is missing", ErrInvalidCheck)
+		}
+
+		var bodyRegex *regexp.Regexp
+
+		if cfg.BodyRegex != "" {
+			var err error
+
+			if bodyRegex, err = regexp.Compile(cfg.BodyRegex); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidCheck, err)
+			}
+		}
+
+		return NewHTTPProbe(cfg.URL, cfg.ExpectedStatus, bodyRegex), nil
+
+	case "tcp":
+		if cfg.Address == "" {
+			return nil, fmt.Errorf("%w: the address is missing", ErrInvalidCheck)
+		}
+
+		return NewTCPProbe(cfg.Address), nil
+
+	case "exec":
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("%w: the command is missing", ErrInvalidCheck)
+		}
+
+		return NewExecProbe(cfg.ExitCode, cfg.Command[0], cfg.Command[1:]...), nil
+
+	case "grpc":
+		if cfg.Address == "" {
+			return nil, fmt.Errorf("%w: the address is missing", ErrInvalidCheck)
+		}
+
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewGRPCProbe(cfg.Address, cfg.Service, tlsConfig), nil
+
+	case "port":
+		if len(cfg.Ports) == 0 {
+			return nil, fmt.Errorf("%w: the ports are missing", ErrInvalidCheck)
+		}
+
+		for _, port := range cfg.Ports {
+			if port <= 0 || port > maxPort {
+				return nil, fmt.Errorf("%w: invalid port %d", ErrInvalidCheck, port)
+			}
+		}
+
+		return NewPortProbe(procfs.NewFS(procfs.DefaultRoot), cfg.Ports...), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidCheck, cfg.Type)
+}
+
+// newTLSConfig returns the tls configuration of a grpc check, or nil
+// if the connection must not be encrypted.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if !cfg.TLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify, //nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+	}
+
+	if cfg.TLSCA != "" {
+		pem, err := os.ReadFile(cfg.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCheck, err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates found in %s", ErrInvalidCheck, cfg.TLSCA)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func valueOrDefault(value, defaultValue int) int {
+	if value == 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+func durationOrDefault(value, defaultValue time.Duration) time.Duration {
+	if value == 0 {
+		return defaultValue
+	}
+
+	return value
+}
+
+// initialResult returns the state of the check before its first
+// execution: a liveness check is healthy until it fails, while
+// a readiness check is unhealthy until it succeeds.
+func (c *Check) initialResult() Result {
+	return Result{
+		Name:    c.name,
+		Target:  c.target,
+		Healthy: c.target == TargetAlive,
+	}
+}
+
+func (c *Check) runProbe(ctx context.Context, pid int) error {
+	ctxProbe, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.probe.Probe(ctxProbe, pid)
+}
+
+// closeProbe releases the resources kept by the probe between its
+// executions, like the connection of a grpc probe.
+func (c *Check) closeProbe() {
+	closer, ok := c.probe.(io.Closer)
+	if !ok {
+		return
+	}
+
+	if err := closer.Close(); err != nil {
+		logger.Debugf("health check %s: cannot close the probe: %s", c.name, err)
+	}
+}
+
+func (c *Check) do(ctx context.Context, processState <-chan ProcessState, results chan<- Result) {
+	defer c.closeProbe()
+
+	send := func(result Result) bool {
+		select {
+		case results <- result:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	result := c.initialResult()
+	if !send(result) {
+		return
+	}
+
+	timer := time.NewTimer(0)
+	stopTimer(timer)
+
+	var state ProcessState
+
+	var successes, failures int
+
+	// true if a successful probe was reported for the running process
+	var succeeded bool
+
+	for {
+		select {
+		case <-ctx.Done():
+			stopTimer(timer)
+
+			return
+
+		case newState := <-processState:
+			if newState == state {
+				continue
+			}
+
+			state = newState
+			successes, failures = 0, 0
+			succeeded = false
+
+			stopTimer(timer)
+
+			if state.Running {
+				logger.Debugf("health check %s starts in %s", c.name, c.initialDelay)
+				timer.Reset(c.initialDelay)
+
+				continue
+			}
+
+			if initial := c.initialResult(); result.Healthy != initial.Healthy {
+				result = initial
+				if !send(result) {
+					return
+				}
+			}
+
+		case <-timer.C:
+			err := c.runProbe(ctx, state.Pid)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err == nil {
+				successes++
+				failures = 0
+
+				logger.Debugf("health check %s succeeded", c.name)
+			} else {
+				failures++
+				successes = 0
+
+				logger.Debugf("health check %s failed: %s", c.name, err)
+			}
+
+			timer.Reset(c.interval)
+
+			switch {
+			case !result.Healthy && successes >= c.successThreshold:
+				logger.Infof("health check %s is healthy", c.name)
+
+				result = Result{Name: c.name, Target: c.target, Healthy: true, Probed: true}
+				succeeded = true
+			case result.Healthy && failures >= c.failureThreshold:
+				logger.Warnf("health check %s is unhealthy: %s", c.name, err)
+
+				result = Result{Name: c.name, Target: c.target, Healthy: false, Err: err, Probed: true}
+			case result.Healthy && err == nil && !succeeded:
+				// the first success is reported even if the check was
+				// already healthy, e.g. the initial state of a liveness
+				// check
+				result = Result{Name: c.name, Target: c.target, Healthy: true, Probed: true}
+				succeeded = true
+			default:
+				continue
+			}
+
+			if !send(result) {
+				return
+			}
+		}
+	}
+}
+
+// stopTimer stops a timer, draining its channel if it already fired.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
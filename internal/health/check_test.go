@@ -0,0 +1,503 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errProbeFailed = errors.New("probe failed")
+
+// fakeProbe returns the errors of its results in order, then it keeps
+// returning the last one.
+type fakeProbe struct {
+	closed  bool
+	mux     sync.Mutex
+	results []error
+}
+
+func (p *fakeProbe) Close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.closed = true
+
+	return nil
+}
+
+func (p *fakeProbe) isClosed() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return p.closed
+}
+
+func (p *fakeProbe) Probe(context.Context, int) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if len(p.results) == 0 {
+		return nil
+	}
+
+	err := p.results[0]
+	if len(p.results) > 1 {
+		p.results = p.results[1:]
+	}
+
+	return err
+}
+
+func nextResult(t *testing.T, results <-chan Result, timeout time.Duration) Result {
+	t.Helper()
+
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(timeout):
+		t.Fatalf("no result received within %s", timeout)
+	}
+
+	return Result{}
+}
+
+func noResult(t *testing.T, results <-chan Result, timeout time.Duration) {
+	t.Helper()
+
+	select {
+	case result := <-results:
+		t.Errorf("no result was expected, got %+v", result)
+	case <-time.After(timeout):
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Target
+		wantErr bool
+	}{
+		{name: "alive", value: "alive", want: TargetAlive},
+		{name: "ready", value: " Ready ", want: TargetReady},
+		{name: "empty", value: "", wantErr: true},
+		{name: "unknown", value: "started", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTarget(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    *Check
+		wantErr bool
+	}{
+		{
+			name: "http_defaults",
+			cfg:  Config{Name: "http", Type: "http", Target: "alive", URL: "http://127.0.0.1:8080/health"},
+			want: &Check{
+				failureThreshold: defaultFailureThreshold,
+				interval:         defaultInterval,
+				name:             "http",
+				successThreshold: defaultSuccessThreshold,
+				target:           TargetAlive,
+				timeout:          defaultTimeout,
+			},
+		},
+		{
+			name: "tcp",
+			cfg: Config{
+				Name: "tcp", Type: "TCP", Target: "ready", Address: "127.0.0.1:8080",
+				Interval: 2 * time.Second, Timeout: 500 * time.Millisecond, InitialDelay: 5 * time.Second,
+				SuccessThreshold: 2, FailureThreshold: 5,
+			},
+			want: &Check{
+				failureThreshold: 5,
+				initialDelay:     5 * time.Second,
+				interval:         2 * time.Second,
+				name:             "tcp",
+				successThreshold: 2,
+				target:           TargetReady,
+				timeout:          500 * time.Millisecond,
+			},
+		},
+		{
+			name: "exec",
+			cfg:  Config{Name: "exec", Type: "exec", Target: "ready", Command: []string{"/bin/check", "-v"}},
+			want: &Check{
+				failureThreshold: defaultFailureThreshold,
+				interval:         defaultInterval,
+				name:             "exec",
+				successThreshold: defaultSuccessThreshold,
+				target:           TargetReady,
+				timeout:          defaultTimeout,
+			},
+		},
+		{
+			name: "grpc",
+			cfg:  Config{Name: "grpc", Type: "grpc", Target: "alive", Address: "127.0.0.1:9090", Service: "api", TLS: true},
+			want: &Check{
+				failureThreshold: defaultFailureThreshold,
+				interval:         defaultInterval,
+				name:             "grpc",
+				successThreshold: defaultSuccessThreshold,
+				target:           TargetAlive,
+				timeout:          defaultTimeout,
+			},
+		},
+		{
+			name:    "grpc_missing_address",
+			cfg:     Config{Name: "grpc", Type: "grpc", Target: "ready"},
+			wantErr: true,
+		},
+		{
+			name:    "grpc_missing_tls_ca",
+			cfg:     Config{Name: "grpc", Type: "grpc", Target: "ready", Address: "127.0.0.1:9090", TLS: true, TLSCA: "/not/found.pem"},
+			wantErr: true,
+		},
+		{
+			name: "port",
+			cfg:  Config{Name: "port", Type: "port", Target: "ready", Ports: []int{8080, 9090}},
+			want: &Check{
+				failureThreshold: defaultFailureThreshold,
+				interval:         defaultInterval,
+				name:             "port",
+				successThreshold: defaultSuccessThreshold,
+				target:           TargetReady,
+				timeout:          defaultTimeout,
+			},
+		},
+		{
+			name:    "port_missing_ports",
+			cfg:     Config{Name: "port", Type: "port", Target: "ready"},
+			wantErr: true,
+		},
+		{
+			name:    "port_invalid_port",
+			cfg:     Config{Name: "port", Type: "port", Target: "ready", Ports: []int{70000}},
+			wantErr: true,
+		},
+		{
+			name:    "missing_name",
+			cfg:     Config{Type: "tcp", Target: "ready", Address: "127.0.0.1:8080"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown_type",
+			cfg:     Config{Name: "grpc", Type: "unknown", Target: "ready"},
+			wantErr: true,
+		},
+		{
+			name:    "missing_url",
+			cfg:     Config{Name: "http", Type: "http", Target: "ready"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid_body_regex",
+			cfg:     Config{Name: "http", Type: "http", Target: "ready", URL: "http://127.0.0.1:8080", BodyRegex: "("},
+			wantErr: true,
+		},
+		{
+			name:    "missing_address",
+			cfg:     Config{Name: "tcp", Type: "tcp", Target: "ready"},
+			wantErr: true,
+		},
+		{
+			name:    "missing_command",
+			cfg:     Config{Name: "exec", Type: "exec", Target: "ready"},
+			wantErr: true,
+		},
+		{
+			name:    "negative_threshold",
+			cfg:     Config{Name: "tcp", Type: "tcp", Target: "ready", Address: "127.0.0.1:8080", FailureThreshold: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewCheck(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCheck) {
+					t.Errorf("NewCheck() error = %v, expected %v", err, ErrInvalidCheck)
+				}
+
+				return
+			}
+
+			if got.probe == nil {
+				t.Errorf("NewCheck() the probe is missing")
+			}
+
+			got.probe = nil
+			if *got != *tt.want {
+				t.Errorf("NewCheck() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck_do(t *testing.T) {
+	t.Run("Probe_closed", func(t *testing.T) {
+		probe := &fakeProbe{}
+
+		c := &Check{
+			failureThreshold: 1,
+			interval:         10 * time.Millisecond,
+			name:             "test",
+			probe:            probe,
+			successThreshold: 1,
+			target:           TargetAlive,
+			timeout:          10 * time.Millisecond,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		processState := make(chan ProcessState, 1)
+		results := make(chan Result)
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			c.do(ctx, processState, results)
+		}()
+
+		nextResult(t, results, 100*time.Millisecond)
+
+		if probe.isClosed() {
+			t.Errorf("the probe was closed while the check is running")
+		}
+
+		// the probe is closed when the check stops
+		cancel()
+		<-done
+
+		if !probe.isClosed() {
+			t.Errorf("the probe was expected to be closed")
+		}
+	})
+
+	t.Run("Alive_failure_threshold", func(t *testing.T) {
+		c := &Check{
+			failureThreshold: 2,
+			interval:         10 * time.Millisecond,
+			name:             "test",
+			probe:            &fakeProbe{results: []error{errProbeFailed, nil, errProbeFailed, errProbeFailed, nil}},
+			successThreshold: 1,
+			target:           TargetAlive,
+			timeout:          10 * time.Millisecond,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		processState := make(chan ProcessState, 1)
+		results := make(chan Result)
+
+		go c.do(ctx, processState, results)
+
+		result := nextResult(t, results, 100*time.Millisecond)
+		if !result.Healthy || result.Target != TargetAlive || result.Name != "test" {
+			t.Errorf("a healthy initial result was expected, got %+v", result)
+		}
+
+		processState <- ProcessState{Running: true}
+
+		// a single failure is below the threshold, the first success
+		// is reported even if the check is already healthy
+		result = nextResult(t, results, 500*time.Millisecond)
+		if !result.Healthy || !result.Probed {
+			t.Errorf("a healthy probed result was expected, got %+v", result)
+		}
+
+		result = nextResult(t, results, 500*time.Millisecond)
+		if result.Healthy || !errors.Is(result.Err, errProbeFailed) {
+			t.Errorf("an unhealthy result was expected, got %+v", result)
+		}
+
+		result = nextResult(t, results, 100*time.Millisecond)
+		if !result.Healthy {
+			t.Errorf("a healthy result was expected, got %+v", result)
+		}
+	})
+
+	t.Run("Ready_success_threshold", func(t *testing.T) {
+		c := &Check{
+			failureThreshold: 1,
+			interval:         10 * time.Millisecond,
+			name:             "test",
+			probe:            &fakeProbe{results: []error{errProbeFailed, nil, errProbeFailed, nil, nil}},
+			successThreshold: 2,
+			target:           TargetReady,
+			timeout:          10 * time.Millisecond,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		processState := make(chan ProcessState, 1)
+		results := make(chan Result)
+
+		go c.do(ctx, processState, results)
+
+		result := nextResult(t, results, 100*time.Millisecond)
+		if result.Healthy || result.Target != TargetReady {
+			t.Errorf("an unhealthy initial result was expected, got %+v", result)
+		}
+
+		processState <- ProcessState{Running: true}
+
+		start := time.Now()
+
+		result = nextResult(t, results, 500*time.Millisecond)
+		if !result.Healthy {
+			t.Errorf("a healthy result was expected, got %+v", result)
+		}
+
+		// the first success is not enough
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("the check became healthy too early, after %s", elapsed)
+		}
+	})
+
+	t.Run("Initial_delay_and_process_restart", func(t *testing.T) {
+		c := &Check{
+			failureThreshold: 1,
+			initialDelay:     100 * time.Millisecond,
+			interval:         10 * time.Millisecond,
+			name:             "test",
+			probe:            &fakeProbe{},
+			successThreshold: 1,
+			target:           TargetReady,
+			timeout:          10 * time.Millisecond,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		processState := make(chan ProcessState, 1)
+		results := make(chan Result)
+
+		go c.do(ctx, processState, results)
+
+		_ = nextResult(t, results, 100*time.Millisecond)
+
+		// the check is not executed while the process is not running
+		noResult(t, results, 50*time.Millisecond)
+
+		processState <- ProcessState{Running: true}
+
+		// the check is not executed before the initial delay
+		noResult(t, results, 50*time.Millisecond)
+
+		result := nextResult(t, results, 200*time.Millisecond)
+		if !result.Healthy {
+			t.Errorf("a healthy result was expected, got %+v", result)
+		}
+
+		// the check returns to its initial state when the process stops
+		processState <- ProcessState{Running: false, Restarts: 0}
+
+		result = nextResult(t, results, 100*time.Millisecond)
+		if result.Healthy {
+			t.Errorf("an unhealthy result was expected, got %+v", result)
+		}
+
+		processState <- ProcessState{Running: true, Restarts: 1}
+
+		noResult(t, results, 50*time.Millisecond)
+
+		result = nextResult(t, results, 200*time.Millisecond)
+		if !result.Healthy {
+			t.Errorf("a healthy result was expected, got %+v", result)
+		}
+	})
+
+	t.Run("First_success_every_restart", func(t *testing.T) {
+		c := &Check{
+			failureThreshold: 1,
+			interval:         10 * time.Millisecond,
+			name:             "test",
+			probe:            &fakeProbe{},
+			successThreshold: 1,
+			target:           TargetAlive,
+			timeout:          10 * time.Millisecond,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		processState := make(chan ProcessState, 1)
+		results := make(chan Result)
+
+		go c.do(ctx, processState, results)
+
+		result := nextResult(t, results, 100*time.Millisecond)
+		if result.Probed {
+			t.Errorf("the initial result must not be probed, got %+v", result)
+		}
+
+		for restarts := 0; restarts < 2; restarts++ {
+			processState <- ProcessState{Running: true, Restarts: restarts}
+
+			result = nextResult(t, results, 100*time.Millisecond)
+			if !result.Healthy || !result.Probed {
+				t.Errorf("restart %d: a healthy probed result was expected, got %+v", restarts, result)
+			}
+
+			// the following successes are not reported
+			noResult(t, results, 50*time.Millisecond)
+
+			processState <- ProcessState{Running: false, Restarts: restarts}
+		}
+	})
+
+	t.Run("Context_canceled", func(t *testing.T) {
+		c := &Check{
+			failureThreshold: 1,
+			interval:         10 * time.Millisecond,
+			name:             "test",
+			probe:            &fakeProbe{},
+			successThreshold: 1,
+			target:           TargetAlive,
+			timeout:          10 * time.Millisecond,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		processState := make(chan ProcessState, 1)
+		results := make(chan Result)
+		done := make(chan struct{})
+
+		go func() {
+			c.do(ctx, processState, results)
+			close(done)
+		}()
+
+		// nobody reads the initial result
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(100 * time.Millisecond):
+			t.Errorf("the check was expected to end")
+		}
+	})
+}
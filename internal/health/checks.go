@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+)
+
+type Checks interface {
+	Start(ctx context.Context) <-chan Result
+	UpdateProcess() chan<- ProcessState
+}
+
+type checks struct {
+	checks        []*Check
+	updateProcess chan ProcessState
+}
+
+// NewChecks creates the runner of a list of health checks, each
+// check is executed periodically in its own goroutine.
+func NewChecks(list ...*Check) Checks {
+	return &checks{
+		checks:        list,
+		updateProcess: make(chan ProcessState),
+	}
+}
+
+func (c *checks) do(ctx context.Context, processStates []chan ProcessState) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case state := <-c.updateProcess:
+			for _, processState := range processStates {
+				// replace the pending state, if the check didn't
+				// receive it yet, so a slow probe doesn't block
+				// the other checks
+				select {
+				case <-processState:
+				default:
+				}
+
+				processState <- state
+			}
+		}
+	}
+}
+
+// Start executes the checks until ctx is done, the returned channel
+// receives the initial result of every check, then a new result every
+// time a check becomes healthy or unhealthy.
+func (c *checks) Start(ctx context.Context) <-chan Result {
+	results := make(chan Result)
+	processStates := make([]chan ProcessState, 0, len(c.checks))
+
+	for _, check := range c.checks {
+		processState := make(chan ProcessState, 1)
+		processStates = append(processStates, processState)
+
+		go check.do(ctx, processState, results)
+	}
+
+	go c.do(ctx, processStates)
+
+	return results
+}
+
+// UpdateProcess returns the channel used to update the state of
+// the wrapped process.
+func (c *checks) UpdateProcess() chan<- ProcessState {
+	return c.updateProcess
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_checks_Start(t *testing.T) {
+	alive := &Check{
+		failureThreshold: 1,
+		interval:         10 * time.Millisecond,
+		name:             "alive",
+		probe:            &fakeProbe{results: []error{errProbeFailed}},
+		successThreshold: 1,
+		target:           TargetAlive,
+		timeout:          10 * time.Millisecond,
+	}
+	ready := &Check{
+		failureThreshold: 1,
+		interval:         10 * time.Millisecond,
+		name:             "ready",
+		probe:            &fakeProbe{},
+		successThreshold: 1,
+		target:           TargetReady,
+		timeout:          10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewChecks(alive, ready)
+	results := c.Start(ctx)
+
+	initial := map[string]Result{}
+	for i := 0; i < 2; i++ {
+		result := nextResult(t, results, 100*time.Millisecond)
+		initial[result.Name] = result
+	}
+
+	if !initial["alive"].Healthy || initial["ready"].Healthy {
+		t.Errorf("unexpected initial results: %+v", initial)
+	}
+
+	c.UpdateProcess() <- ProcessState{Running: true}
+
+	changed := map[string]Result{}
+	for i := 0; i < 2; i++ {
+		result := nextResult(t, results, 100*time.Millisecond)
+		changed[result.Name] = result
+	}
+
+	if changed["alive"].Healthy || !changed["ready"].Healthy {
+		t.Errorf("unexpected results: %+v", changed)
+	}
+}
@@ -0,0 +1,338 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/internal/sigmask"
+)
+
+// maxBodySize is the maximum number of bytes of the response body
+// read by an http probe to match it with the body regex.
+const maxBodySize = 64 * 1024
+
+// maxOutputSize is the maximum number of bytes of the output of an
+// exec probe reported in the reason of a failure.
+const maxOutputSize = 256
+
+// execWaitDelay is the time to wait for the output of an exec probe
+// to be closed, after its command is killed by the timeout; it
+// avoids waiting for the children of the command still running.
+const execWaitDelay = 100 * time.Millisecond
+
+var (
+	ErrUnexpectedStatus   = errors.New("unexpected status code")
+	ErrUnexpectedBody     = errors.New("the response body doesn't match")
+	ErrUnexpectedExitCode = errors.New("unexpected exit code")
+	ErrNotServing         = errors.New("the service is not serving")
+	ErrNotListening       = errors.New("the process is not listening on the port")
+)
+
+// Probe checks once the health of the wrapped process, pid is the
+// process id of the running process. A probe keeping resources between
+// its executions implements io.Closer, it's closed when its check stops.
+type Probe interface {
+	Probe(ctx context.Context, pid int) error
+}
+
+type httpProbe struct {
+	bodyRegex      *regexp.Regexp
+	client         *http.Client
+	expectedStatus int
+	url            string
+}
+
+// NewHTTPProbe creates a probe sending a GET request to url; if
+// expectedStatus is 0, any status code between 200 and 399 is a
+// success, if bodyRegex is not nil, the response body must match it.
+func NewHTTPProbe(url string, expectedStatus int, bodyRegex *regexp.Regexp) Probe {
+	return &httpProbe{
+		bodyRegex: bodyRegex,
+		client: &http.Client{
+			// the redirects are handled like a success, as kubernetes does
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		expectedStatus: expectedStatus,
+		url:            url,
+	}
+}
+
+func (p *httpProbe) Probe(ctx context.Context, _ int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if !p.isExpectedStatus(rsp.StatusCode) {
+		return fmt.Errorf("%w: %d", ErrUnexpectedStatus, rsp.StatusCode)
+	}
+
+	if p.bodyRegex == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+
+	if !p.bodyRegex.Match(body) {
+		return fmt.Errorf("%w %q", ErrUnexpectedBody, p.bodyRegex)
+	}
+
+	return nil
+}
+
+func (p *httpProbe) isExpectedStatus(status int) bool {
+	if p.expectedStatus == 0 {
+		return status >= http.StatusOK && status < http.StatusBadRequest
+	}
+
+	return status == p.expectedStatus
+}
+
+type tcpProbe struct {
+	address string
+	dialer  net.Dialer
+}
+
+// NewTCPProbe creates a probe opening a tcp connection to address.
+func NewTCPProbe(address string) Probe {
+	return &tcpProbe{
+		address: address,
+	}
+}
+
+func (p *tcpProbe) Probe(ctx context.Context, _ int) error {
+	conn, err := p.dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+type execProbe struct {
+	args     []string
+	exitCode int
+	path     string
+}
+
+// NewExecProbe creates a probe executing a command, which must end
+// with exitCode.
+func NewExecProbe(exitCode int, path string, args ...string) Probe {
+	return &execProbe{
+		args:     args,
+		exitCode: exitCode,
+		path:     path,
+	}
+}
+
+func (p *execProbe) Probe(ctx context.Context, _ int) error {
+	var output bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, p.path, p.args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = execWaitDelay
+
+	// the command doesn't inherit the signals blocked in the wrapper
+	err := sigmask.Start(cmd)
+	if err == nil {
+		err = cmd.Wait()
+	}
+
+	var exitError *exec.ExitError
+
+	switch {
+	case errors.As(err, &exitError) && ctx.Err() == nil:
+		if exitError.ExitCode() == p.exitCode {
+			return nil
+		}
+	case err != nil:
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return err
+	case p.exitCode == 0:
+		return nil
+	}
+
+	err = fmt.Errorf("%w: %d", ErrUnexpectedExitCode, cmd.ProcessState.ExitCode())
+
+	if text := outputText(output.String()); text != "" {
+		err = fmt.Errorf("%w: %s", err, text)
+	}
+
+	return err
+}
+
+// outputText returns the last part of the output of an exec probe,
+// on a single line.
+func outputText(output string) string {
+	output = strings.Join(strings.Fields(output), " ")
+	if len(output) > maxOutputSize {
+		output = output[len(output)-maxOutputSize:]
+	}
+
+	return output
+}
+
+type grpcProbe struct {
+	address     string
+	conn        *grpc.ClientConn
+	credentials credentials.TransportCredentials
+	mux         sync.Mutex
+	service     string
+}
+
+// NewGRPCProbe creates a probe calling the Check method of the gRPC
+// health service at address, for the given service name; the probe
+// succeeds only if the service is SERVING. If tlsConfig is nil, the
+// connection is not encrypted.
+func NewGRPCProbe(address, service string, tlsConfig *tls.Config) Probe {
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
+	return &grpcProbe{
+		address:     address,
+		credentials: transportCredentials,
+		service:     service,
+	}
+}
+
+// client returns the client of the health service, the connection
+// is created only once, and it's reused by the next probes.
+func (p *grpcProbe) client() (healthpb.HealthClient, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.conn == nil {
+		conn, err := grpc.Dial(p.address, grpc.WithTransportCredentials(p.credentials))
+		if err != nil {
+			return nil, err
+		}
+
+		p.conn = conn
+	}
+
+	return healthpb.NewHealthClient(p.conn), nil
+}
+
+// Close closes the connection of the probe, if it's open; a new one
+// is created by the next probe.
+func (p *grpcProbe) Close() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+
+	err := p.conn.Close()
+	p.conn = nil
+
+	return err
+}
+
+func (p *grpcProbe) Probe(ctx context.Context, _ int) error {
+	client, err := p.client()
+	if err != nil {
+		return err
+	}
+
+	rsp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: p.service})
+	if err != nil {
+		return err
+	}
+
+	if rsp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%w: %s", ErrNotServing, rsp.GetStatus())
+	}
+
+	return nil
+}
+
+type portProbe struct {
+	fs    procfs.FS
+	ports []int
+}
+
+// NewPortProbe creates a probe which succeeds when the wrapped process,
+// or any of its descendants, is listening on all the tcp ports; it
+// doesn't connect to the process, the sockets are read from fs.
+func NewPortProbe(fs procfs.FS, ports ...int) Probe {
+	return &portProbe{
+		fs:    fs,
+		ports: ports,
+	}
+}
+
+func (p *portProbe) Probe(_ context.Context, pid int) error {
+	if pid == 0 {
+		return ErrNotListening
+	}
+
+	listening, err := p.fs.ListeningPorts(pid)
+	if err != nil {
+		return err
+	}
+
+	tree, err := p.fs.Tree(pid)
+	if err != nil {
+		return err
+	}
+
+	// the ports of the sockets owned by the process tree
+	owned := make(map[int]struct{})
+
+	for _, treePid := range tree {
+		// the process may end while reading the tree
+		inodes, err := p.fs.SocketInodes(treePid)
+		if err != nil {
+			continue
+		}
+
+		for inode := range inodes {
+			if port, ok := listening[inode]; ok {
+				owned[port] = struct{}{}
+			}
+		}
+	}
+
+	for _, port := range p.ports {
+		if _, ok := owned[port]; !ok {
+			return fmt.Errorf("%w: %d", ErrNotListening, port)
+		}
+	}
+
+	return nil
+}
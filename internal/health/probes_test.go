@@ -0,0 +1,553 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+)
+
+func Test_httpProbe_Probe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/error", http.StatusFound)
+	})
+	mux.HandleFunc("/accepted", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	type args struct {
+		path           string
+		expectedStatus int
+		bodyRegex      *regexp.Regexp
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "ok",
+			args: args{path: "/ok"},
+		},
+		{
+			name:    "server_error",
+			args:    args{path: "/error"},
+			wantErr: ErrUnexpectedStatus,
+		},
+		{
+			name: "redirect_is_not_followed",
+			args: args{path: "/redirect"},
+		},
+		{
+			name: "expected_status",
+			args: args{path: "/accepted", expectedStatus: http.StatusAccepted},
+		},
+		{
+			name:    "unexpected_status",
+			args:    args{path: "/ok", expectedStatus: http.StatusAccepted},
+			wantErr: ErrUnexpectedStatus,
+		},
+		{
+			name: "body_matches",
+			args: args{path: "/ok", bodyRegex: regexp.MustCompile(`"status":\s*"ok"`)},
+		},
+		{
+			name:    "body_does_not_match",
+			args:    args{path: "/ok", bodyRegex: regexp.MustCompile(`"status":\s*"down"`)},
+			wantErr: ErrUnexpectedBody,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHTTPProbe(ts.URL+tt.args.path, tt.args.expectedStatus, tt.args.bodyRegex)
+
+			err := p.Probe(context.Background(), 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("connection_refused", func(t *testing.T) {
+		p := NewHTTPProbe("http://127.0.0.1:1/", 0, nil)
+
+		if err := p.Probe(context.Background(), 0); err == nil {
+			t.Errorf("Probe() an error was expected")
+		}
+	})
+}
+
+func Test_tcpProbe_Probe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+
+	t.Run("listening", func(t *testing.T) {
+		p := NewTCPProbe(address)
+
+		if err := p.Probe(context.Background(), 0); err != nil {
+			t.Errorf("Probe() no error was expected, got %v", err)
+		}
+	})
+
+	_ = listener.Close()
+
+	t.Run("not_listening", func(t *testing.T) {
+		p := NewTCPProbe(address)
+
+		if err := p.Probe(context.Background(), 0); err == nil {
+			t.Errorf("Probe() an error was expected")
+		}
+	})
+}
+
+func Test_execProbe_Probe(t *testing.T) {
+	type args struct {
+		exitCode int
+		path     string
+		args     []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "success",
+			args: args{path: "/bin/sh", args: []string{"-c", "exit 0"}},
+		},
+		{
+			name:    "failure",
+			args:    args{path: "/bin/sh", args: []string{"-c", "echo failed; exit 1"}},
+			wantErr: ErrUnexpectedExitCode,
+		},
+		{
+			name: "expected_exit_code",
+			args: args{exitCode: 3, path: "/bin/sh", args: []string{"-c", "exit 3"}},
+		},
+		{
+			name:    "unexpected_success",
+			args:    args{exitCode: 3, path: "/bin/sh", args: []string{"-c", "exit 0"}},
+			wantErr: ErrUnexpectedExitCode,
+		},
+		{
+			name:    "timeout",
+			args:    args{path: "/bin/sh", args: []string{"-c", "sleep 1"}},
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			p := NewExecProbe(tt.args.exitCode, tt.args.path, tt.args.args...)
+
+			err := p.Probe(ctx, 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("not_found", func(t *testing.T) {
+		p := NewExecProbe(0, "/not/found")
+
+		if err := p.Probe(context.Background(), 0); err == nil {
+			t.Errorf("Probe() an error was expected")
+		}
+	})
+}
+
+func Test_outputText(t *testing.T) {
+	long := make([]byte, maxOutputSize+10)
+	for i := range long {
+		long[i] = 'a'
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "empty",
+			output: "",
+			want:   "",
+		},
+		{
+			name:   "multiple_lines",
+			output: "first line\n  second line\n",
+			want:   "first line second line",
+		},
+		{
+			name:   "truncated",
+			output: string(long),
+			want:   string(long[:maxOutputSize]),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outputText(tt.output); got != tt.want {
+				t.Errorf("outputText() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestCertificate creates a self-signed certificate for 127.0.0.1.
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+// startGRPCHealthServer starts an in-process gRPC server exposing
+// the health service, it's stopped at the end of the test.
+func startGRPCHealthServer(t *testing.T, opts ...grpc.ServerOption) (string, *health.Server) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("serving", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("not-serving", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	grpcServer := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+
+	t.Cleanup(grpcServer.Stop)
+
+	return listener.Addr().String(), healthServer
+}
+
+func Test_grpcProbe_Probe(t *testing.T) {
+	address, healthServer := startGRPCHealthServer(t)
+
+	tests := []struct {
+		name    string
+		service string
+		wantErr bool
+		err     error
+	}{
+		{
+			name:    "server",
+			service: "",
+		},
+		{
+			name:    "serving",
+			service: "serving",
+		},
+		{
+			name:    "not_serving",
+			service: "not-serving",
+			wantErr: true,
+			err:     ErrNotServing,
+		},
+		{
+			name:    "unknown_service",
+			service: "unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			p := NewGRPCProbe(address, tt.service, nil)
+
+			err := p.Probe(ctx, 0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Probe() error = %v, expected %v", err, tt.err)
+			}
+		})
+	}
+
+	t.Run("status_changed", func(t *testing.T) {
+		p := NewGRPCProbe(address, "serving", nil)
+
+		healthServer.SetServingStatus("serving", healthpb.HealthCheckResponse_NOT_SERVING)
+		defer healthServer.SetServingStatus("serving", healthpb.HealthCheckResponse_SERVING)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		if err := p.Probe(ctx, 0); !errors.Is(err, ErrNotServing) {
+			t.Errorf("Probe() error = %v, expected %v", err, ErrNotServing)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		p := NewGRPCProbe(address, "serving", nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		if err := p.Probe(ctx, 0); err != nil {
+			t.Fatalf("Probe() error = %v", err)
+		}
+
+		closer, ok := p.(io.Closer)
+		if !ok {
+			t.Fatalf("the grpc probe was expected to implement io.Closer")
+		}
+
+		if err := closer.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+
+		if conn := p.(*grpcProbe).conn; conn != nil {
+			t.Errorf("the connection was expected to be closed, got %v", conn.GetState())
+		}
+
+		// the next probe opens a new connection
+		if err := p.Probe(ctx, 0); err != nil {
+			t.Errorf("Probe() error = %v", err)
+		}
+
+		if err := closer.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	})
+
+	t.Run("not_listening", func(t *testing.T) {
+		p := NewGRPCProbe("127.0.0.1:1", "", nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if err := p.Probe(ctx, 0); err == nil {
+			t.Errorf("Probe() an error was expected")
+		}
+	})
+}
+
+func Test_grpcProbe_Probe_TLS(t *testing.T) {
+	serverCert, cert := newTestCertificate(t)
+	address, _ := startGRPCHealthServer(t, grpc.Creds(credentials.NewServerTLSFromCert(&serverCert)))
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(cert)
+
+	tests := []struct {
+		name      string
+		tlsConfig *tls.Config
+		wantErr   bool
+	}{
+		{
+			name:      "trusted_certificate",
+			tlsConfig: &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12},
+		},
+		{
+			name:      "insecure_skip_verify",
+			tlsConfig: &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS12}, //nolint:gosec
+		},
+		{
+			name:      "untrusted_certificate",
+			tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+			wantErr:   true,
+		},
+		{
+			name:      "plaintext",
+			tlsConfig: nil,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			p := NewGRPCProbe(address, "serving", tt.tlsConfig)
+
+			if err := p.Probe(ctx, 0); (err != nil) != tt.wantErr {
+				t.Errorf("Probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeProcFS creates a fake proc filesystem with the process 100,
+// listening on the port 8080, and its child 101, listening on 9090;
+// the port 7070 is listening in a process out of the tree.
+func fakeProcFS(t *testing.T) procfs.FS {
+	t.Helper()
+
+	root := t.TempDir()
+
+	processes := []struct {
+		pid, ppid int
+		inode     string
+	}{
+		{pid: 100, ppid: 1, inode: "1234"},
+		{pid: 101, ppid: 100, inode: "5678"},
+		{pid: 200, ppid: 1, inode: "9999"},
+	}
+
+	for _, p := range processes {
+		dir := filepath.Join(root, strconv.Itoa(p.pid))
+		if err := os.MkdirAll(filepath.Join(dir, "fd"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		stat := fmt.Sprintf("%d (cmd) S %d 1 1 0 -1\n", p.pid, p.ppid)
+		if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Symlink("socket:["+p.inode+"]", filepath.Join(dir, "fd", "3")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcp := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1234 1\n" +
+		"   1: 0100007F:2382 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 5678 1\n" +
+		"   2: 0100007F:1B9E 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 9999 1\n"
+
+	if err := os.MkdirAll(filepath.Join(root, "100", "net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "100", "net", "tcp"), []byte(tcp), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return procfs.NewFS(root)
+}
+
+func Test_portProbe_Probe(t *testing.T) {
+	fs := fakeProcFS(t)
+
+	tests := []struct {
+		name    string
+		pid     int
+		ports   []int
+		wantErr error
+	}{
+		{name: "process", pid: 100, ports: []int{8080}},
+		{name: "child", pid: 100, ports: []int{9090}},
+		{name: "all_ports", pid: 100, ports: []int{8080, 9090}},
+		{name: "not_listening", pid: 100, ports: []int{8080, 8081}, wantErr: ErrNotListening},
+		{name: "out_of_the_tree", pid: 100, ports: []int{7070}, wantErr: ErrNotListening},
+		{name: "not_running", pid: 0, ports: []int{8080}, wantErr: ErrNotListening},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPortProbe(fs, tt.ports...)
+
+			err := p.Probe(context.Background(), tt.pid)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("process_ended", func(t *testing.T) {
+		p := NewPortProbe(fs, 8080)
+
+		if err := p.Probe(context.Background(), 300); err == nil {
+			t.Errorf("Probe() an error was expected")
+		}
+	})
+}
+
+func Test_portProbe_Probe_real(t *testing.T) {
+	if _, err := os.Stat(procfs.DefaultRoot); err != nil {
+		t.Skip("the proc filesystem is not available")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	p := NewPortProbe(procfs.NewFS(procfs.DefaultRoot), port)
+
+	if err := p.Probe(context.Background(), os.Getpid()); err != nil {
+		t.Errorf("Probe() no error was expected, got %v", err)
+	}
+
+	_ = listener.Close()
+
+	if err := p.Probe(context.Background(), os.Getpid()); !errors.Is(err, ErrNotListening) {
+		t.Errorf("Probe() error = %v, expected %v", err, ErrNotListening)
+	}
+}
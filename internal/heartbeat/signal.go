@@ -0,0 +1,179 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/internal/sigmask"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// EnvPid is the environment variable with the pid of the wrapper,
+// passed to the wrapped process to send the heartbeat signals.
+const EnvPid = "LIVENESS_WRAPPER_PID"
+
+var (
+	ErrInvalidSignal = errors.New("invalid heartbeat signal")
+	// ErrSignalNotBlocked is returned when the heartbeat signal is not
+	// blocked with sigmask.Block, so it cannot be read with a signalfd.
+	ErrSignalNotBlocked = errors.New("the heartbeat signal is not blocked")
+)
+
+// allowedSignals are the signals which can be used as heartbeats: the
+// wrapper shuts down on SIGINT and SIGTERM, and the other signals are
+// either used by the go runtime or cannot be handled.
+var allowedSignals = map[syscall.Signal]struct{}{
+	syscall.SIGHUP:   {},
+	syscall.SIGUSR1:  {},
+	syscall.SIGUSR2:  {},
+	syscall.SIGWINCH: {},
+}
+
+// ParseSignal parses the name of a heartbeat signal, with or without
+// the SIG prefix, like SIGUSR1 or USR1.
+func ParseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig := unix.SignalNum(name)
+	if _, ok := allowedSignals[sig]; !ok {
+		return 0, fmt.Errorf("%w: %s, use one of SIGHUP, SIGUSR1, SIGUSR2 or SIGWINCH", ErrInvalidSignal, name)
+	}
+
+	return sig, nil
+}
+
+// Signal receives the heartbeats of the wrapped process as signals
+// sent to the wrapper. The signals are read with a signalfd, which
+// reports the pid of their sender, and the signals sent by processes
+// outside the tree of the wrapped process are ignored.
+type Signal interface {
+	Start(ctx context.Context) <-chan struct{}
+	UpdateProcess() chan<- int
+}
+
+type signalHeartbeat struct {
+	file          *os.File
+	fs            procfs.FS
+	signal        syscall.Signal
+	updateProcess chan int
+}
+
+// NewSignal returns a Signal receiving sig as the heartbeat, sig must
+// be blocked with sigmask.Block.
+func NewSignal(sig syscall.Signal, fs procfs.FS) (Signal, error) {
+	isBlocked, err := sigmask.IsBlocked(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isBlocked {
+		return nil, fmt.Errorf("%w: %s", ErrSignalNotBlocked, unix.SignalName(sig))
+	}
+
+	set := sigmask.Set(sig)
+
+	fd, err := unix.Signalfd(-1, &set, unix.SFD_CLOEXEC|unix.SFD_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the signalfd of %s: %w", unix.SignalName(sig), err)
+	}
+
+	return &signalHeartbeat{
+		file:          os.NewFile(uintptr(fd), "signalfd"),
+		fs:            fs,
+		signal:        sig,
+		updateProcess: make(chan int),
+	}, nil
+}
+
+// UpdateProcess returns the channel used to update the pid of the
+// wrapped process, 0 if the process is not running.
+func (s *signalHeartbeat) UpdateProcess() chan<- int {
+	return s.updateProcess
+}
+
+// read reads the signals from the signalfd, and sends the pid of
+// their sender on received, until the signalfd is closed.
+func (s *signalHeartbeat) read(ctx context.Context, received chan<- int) {
+	var info unix.SignalfdSiginfo
+
+	buf := make([]byte, unsafe.Sizeof(info))
+
+	for {
+		if _, err := io.ReadFull(s.file, buf); err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				logger.Errorf("cannot read the heartbeat signal: %s", err)
+			}
+
+			return
+		}
+
+		info = *(*unix.SignalfdSiginfo)(unsafe.Pointer(&buf[0]))
+
+		select {
+		case received <- int(info.Pid):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *signalHeartbeat) do(ctx context.Context, heartbeats chan<- struct{}) {
+	received := make(chan int)
+
+	go s.read(ctx, received)
+
+	pid := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = s.file.Close()
+
+			return
+
+		case pid = <-s.updateProcess:
+
+		case sender := <-received:
+			if pid == 0 {
+				logger.Debugf("ignoring a heartbeat signal from pid %d, the wrapped process is not running", sender)
+				continue
+			}
+
+			// the signals sent by the kernel have no sender
+			isDescendant, err := s.fs.IsDescendant(sender, pid)
+			if sender == 0 || err != nil || !isDescendant {
+				logger.Warnf("ignoring a heartbeat signal from pid %d, outside of the wrapped process tree", sender)
+				continue
+			}
+
+			// don't block if a heartbeat is already pending
+			select {
+			case heartbeats <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Start receives the heartbeats until ctx is done, the returned
+// channel receives a value for every signal sent by the wrapped
+// process, or by one of its descendants.
+func (s *signalHeartbeat) Start(ctx context.Context) <-chan struct{} {
+	heartbeats := make(chan struct{}, 1)
+
+	go s.do(ctx, heartbeats)
+
+	return heartbeats
+}
@@ -0,0 +1,138 @@
+package heartbeat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/internal/sigmask"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func TestMain(m *testing.M) {
+	// the heartbeat signals are read with a signalfd, the test binary
+	// is executed again with SIGUSR2 blocked
+	if err := sigmask.Block(syscall.SIGUSR2); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    syscall.Signal
+		wantErr error
+	}{
+		{name: "SIGUSR1", want: syscall.SIGUSR1},
+		{name: "usr2", want: syscall.SIGUSR2},
+		{name: "SIGHUP", want: syscall.SIGHUP},
+		{name: "WINCH", want: syscall.SIGWINCH},
+		{name: "SIGTERM", wantErr: ErrInvalidSignal},
+		{name: "SIGINT", wantErr: ErrInvalidSignal},
+		{name: "SIGKILL", wantErr: ErrInvalidSignal},
+		{name: "SIGURG", wantErr: ErrInvalidSignal},
+		{name: "unknown", wantErr: ErrInvalidSignal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSignal(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseSignal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseSignal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignal_Start(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "DEBUG")
+
+	if _, err := NewSignal(syscall.SIGUSR1, procfs.NewFS(procfs.DefaultRoot)); !errors.Is(err, ErrSignalNotBlocked) {
+		t.Errorf("NewSignal() error = %v, want %v", err, ErrSignalNotBlocked)
+	}
+
+	h, err := NewSignal(syscall.SIGUSR2, procfs.NewFS(procfs.DefaultRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the wrapped process sends a heartbeat for every line on its stdin
+	child := exec.Command("/bin/sh", "-c", "while read line; do kill -USR2 "+strconv.Itoa(os.Getpid())+"; done")
+
+	stdin, err := child.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sigmask.Start(child); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = stdin.Close()
+		_ = child.Wait()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	heartbeats := h.Start(ctx)
+
+	kill := func() {
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Process_not_running", func(t *testing.T) {
+		kill()
+
+		if nextHeartbeat(heartbeats, 100*time.Millisecond) {
+			t.Errorf("no heartbeat was expected")
+		}
+	})
+
+	t.Run("Outside_of_the_tree", func(t *testing.T) {
+		// the test is the parent of the wrapped process
+		h.UpdateProcess() <- child.Process.Pid
+
+		kill()
+
+		if nextHeartbeat(heartbeats, 100*time.Millisecond) {
+			t.Errorf("no heartbeat was expected")
+		}
+	})
+
+	t.Run("Wrapped_process", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if _, err := stdin.Write([]byte("ping\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			if !nextHeartbeat(heartbeats, 1*time.Second) {
+				t.Errorf("heartbeat %d: a heartbeat was expected", i)
+			}
+		}
+	})
+
+	cancel()
+
+	// a late heartbeat doesn't terminate the process
+	time.Sleep(10 * time.Millisecond)
+	kill()
+	time.Sleep(10 * time.Millisecond)
+}
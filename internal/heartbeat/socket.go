@@ -0,0 +1,266 @@
+package heartbeat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// EnvSocket is the environment variable with the path of the
+// heartbeat socket, passed to the wrapped process.
+const EnvSocket = "LIVENESS_WRAPPER_HEARTBEAT_SOCKET"
+
+// maxLineSize is the maximum size of a heartbeat line.
+const maxLineSize = 4096
+
+// The lines used by the wrapped process to declare its readiness.
+const (
+	lineReadySet   = "ready/set"
+	lineReadyUnset = "ready/unset"
+)
+
+// Socket receives the heartbeats of the wrapped process on a unix
+// socket: every line written on a connection is a heartbeat, and so
+// is a connection closed without writing anything, except for the
+// ready/set and ready/unset lines, which declare the readiness of the
+// process. The messages sent by processes outside the tree of the
+// wrapped process are ignored.
+type Socket interface {
+	Start(ctx context.Context) <-chan struct{}
+	Ready() <-chan bool
+	UpdateProcess() chan<- int
+	Path() string
+}
+
+type socket struct {
+	dir           string
+	fs            procfs.FS
+	listener      *net.UnixListener
+	path          string
+	ready         chan bool
+	updateProcess chan int
+}
+
+// message is a line received on the socket, with the pid of its
+// sender.
+type message struct {
+	line string
+	pid  int
+}
+
+// ListenSocket creates the heartbeat socket in path, if path is empty
+// the socket is created in a new temporary directory, which is
+// removed when the socket is stopped.
+func ListenSocket(path string, fs procfs.FS) (Socket, error) {
+	dir := ""
+
+	if path == "" {
+		var err error
+
+		if dir, err = os.MkdirTemp("", "liveness-wrapper-"); err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(dir, "heartbeat.sock")
+	} else {
+		// remove the socket left by a previous execution
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		if dir != "" {
+			_ = os.RemoveAll(dir)
+		}
+
+		return nil, err
+	}
+
+	return &socket{
+		dir:           dir,
+		fs:            fs,
+		listener:      listener,
+		path:          path,
+		ready:         make(chan bool, 1),
+		updateProcess: make(chan int),
+	}, nil
+}
+
+// Path returns the path of the socket, to be passed to the wrapped
+// process in the LIVENESS_WRAPPER_HEARTBEAT_SOCKET environment variable.
+func (s *socket) Path() string {
+	return s.path
+}
+
+// Ready returns the channel receiving the readiness declared by the
+// wrapped process.
+func (s *socket) Ready() <-chan bool {
+	return s.ready
+}
+
+// UpdateProcess returns the channel used to update the pid of the
+// wrapped process, 0 if the process is not running.
+func (s *socket) UpdateProcess() chan<- int {
+	return s.updateProcess
+}
+
+// peerPid returns the pid of the process connected to conn.
+func peerPid(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var cred *syscall.Ucred
+
+	var credErr error
+
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if credErr != nil {
+		return 0, credErr
+	}
+
+	return int(cred.Pid), nil
+}
+
+// handle reads the lines sent on conn, and sends them on received
+// with the pid of the sender.
+func (s *socket) handle(ctx context.Context, conn *net.UnixConn, received chan<- message) {
+	defer conn.Close()
+
+	pid, err := peerPid(conn)
+	if err != nil {
+		logger.Warnf("cannot read the credentials of the heartbeat sender: %s", err)
+		return
+	}
+
+	send := func(line string) bool {
+		select {
+		case received <- message{line: line, pid: pid}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, maxLineSize), maxLineSize)
+
+	lines := 0
+
+	for scanner.Scan() {
+		lines++
+
+		if !send(strings.TrimSpace(scanner.Text())) {
+			return
+		}
+	}
+
+	// a connection without data is a single heartbeat
+	if lines == 0 {
+		send("")
+	}
+}
+
+func (s *socket) accept(ctx context.Context, received chan<- message) {
+	for {
+		conn, err := s.listener.AcceptUnix()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Errorf("cannot accept a connection on the heartbeat socket %s: %s", s.path, err)
+			}
+
+			return
+		}
+
+		go s.handle(ctx, conn, received)
+	}
+}
+
+func (s *socket) do(ctx context.Context, heartbeats chan<- struct{}) {
+	received := make(chan message)
+
+	go s.accept(ctx, received)
+
+	pid := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = s.listener.Close()
+
+			if s.dir != "" {
+				_ = os.RemoveAll(s.dir)
+			}
+
+			return
+
+		case pid = <-s.updateProcess:
+
+		case msg := <-received:
+			if pid == 0 {
+				logger.Debugf("ignoring a heartbeat from pid %d, the wrapped process is not running", msg.pid)
+				continue
+			}
+
+			isDescendant, err := s.fs.IsDescendant(msg.pid, pid)
+			if err != nil || !isDescendant {
+				logger.Warnf("ignoring a heartbeat from pid %d, outside of the wrapped process tree", msg.pid)
+				continue
+			}
+
+			switch msg.line {
+			case lineReadySet:
+				s.setReady(true)
+
+			case lineReadyUnset:
+				s.setReady(false)
+
+			default:
+				// don't block if a heartbeat is already pending
+				select {
+				case heartbeats <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// setReady sends the readiness, replacing the pending one: only the
+// last readiness declared by the process matters.
+func (s *socket) setReady(isReady bool) {
+	select {
+	case <-s.ready:
+	default:
+	}
+
+	s.ready <- isReady
+}
+
+// Start receives the heartbeats until ctx is done, the returned
+// channel receives a value for every heartbeat sent by the wrapped
+// process, or by one of its descendants.
+func (s *socket) Start(ctx context.Context) <-chan struct{} {
+	heartbeats := make(chan struct{}, 1)
+
+	go s.do(ctx, heartbeats)
+
+	return heartbeats
+}
@@ -0,0 +1,185 @@
+package heartbeat
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+// nextHeartbeat returns true if a heartbeat is received within timeout.
+func nextHeartbeat(heartbeats <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-heartbeats:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func sendHeartbeat(t *testing.T, path, data string) {
+	t.Helper()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if data != "" {
+		if _, err := conn.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSocket_Start(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "DEBUG")
+
+	if _, err := os.Stat(procfs.DefaultRoot); err != nil {
+		t.Skip("the proc filesystem is not available")
+	}
+
+	// a process outside of the tree of the test
+	other := exec.Command("sleep", "10")
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = other.Process.Kill()
+		_ = other.Wait()
+	}()
+
+	s, err := ListenSocket("", procfs.NewFS(procfs.DefaultRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	heartbeats := s.Start(ctx)
+
+	t.Run("Process_not_running", func(t *testing.T) {
+		sendHeartbeat(t, s.Path(), "")
+
+		if nextHeartbeat(heartbeats, 100*time.Millisecond) {
+			t.Errorf("no heartbeat was expected")
+		}
+	})
+
+	t.Run("Outside_of_the_tree", func(t *testing.T) {
+		s.UpdateProcess() <- other.Process.Pid
+
+		sendHeartbeat(t, s.Path(), "ping\n")
+
+		if nextHeartbeat(heartbeats, 100*time.Millisecond) {
+			t.Errorf("no heartbeat was expected")
+		}
+	})
+
+	t.Run("Connection_without_data", func(t *testing.T) {
+		// the test is a descendant of its parent
+		s.UpdateProcess() <- os.Getppid()
+
+		sendHeartbeat(t, s.Path(), "")
+
+		if !nextHeartbeat(heartbeats, 1*time.Second) {
+			t.Errorf("a heartbeat was expected")
+		}
+	})
+
+	t.Run("Lines", func(t *testing.T) {
+		s.UpdateProcess() <- os.Getpid()
+
+		conn, err := net.Dial("unix", s.Path())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		for i := 0; i < 3; i++ {
+			if _, err := conn.Write([]byte("ping\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			if !nextHeartbeat(heartbeats, 1*time.Second) {
+				t.Errorf("heartbeat %d: a heartbeat was expected", i)
+			}
+		}
+	})
+
+	t.Run("Readiness", func(t *testing.T) {
+		s.UpdateProcess() <- os.Getpid()
+
+		sendHeartbeat(t, s.Path(), "ready/unset\n")
+
+		select {
+		case isReady := <-s.Ready():
+			if isReady {
+				t.Errorf("expected the process to be not ready")
+			}
+		case <-time.After(1 * time.Second):
+			t.Errorf("a readiness was expected")
+		}
+
+		// only the last readiness is kept
+		sendHeartbeat(t, s.Path(), "ready/unset\nready/set\n")
+
+		time.Sleep(100 * time.Millisecond)
+
+		if isReady := <-s.Ready(); !isReady {
+			t.Errorf("expected the process to be ready")
+		}
+
+		if nextHeartbeat(heartbeats, 100*time.Millisecond) {
+			t.Errorf("the readiness is not a heartbeat")
+		}
+	})
+
+	cancel()
+
+	// the socket is removed when the listener is stopped
+	deadline := time.Now().Add(1 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Dir(s.Path())); os.IsNotExist(err) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the directory of the socket %s was expected to be removed", s.Path())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListenSocket_Path(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heartbeat.sock")
+
+	// a socket left by a previous execution
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ListenSocket(path, procfs.NewFS(procfs.DefaultRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Path() != path {
+		t.Errorf("Path() = %s, want %s", s.Path(), path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	cancel()
+}
@@ -2,11 +2,19 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
 	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
 )
 
@@ -17,20 +25,111 @@ const (
 	startupDelay = 5 * time.Millisecond
 )
 
+type ServerEvent int
+
+const (
+	// ServerEventStartupSignal is sent when the wrapped process
+	// signals that it's working, e.g. calling the /ping endpoint.
+	ServerEventStartupSignal ServerEvent = iota
+	// ServerEventListening is sent once the http server is listening.
+	ServerEventListening
+)
+
+// ProcessState is the state of the wrapped process, as seen by
+// the wrapper.
+type ProcessState struct {
+	Started bool
+	// Status is a free-form text describing the state of the process,
+	// as reported by the process itself.
+	Status string
+	// PingTimeout overrides the ping timeout, if it's not 0.
+	PingTimeout time.Duration
+	// Token is the ping token of the running process, used when the
+	// ping tokens are enabled.
+	Token string
+	// Pid is the pid of the running process, 0 if it's not running.
+	Pid int
+	// State is the state of the process as seen by the wrapper, like
+	// running or stopped.
+	State string
+	// Reason describes the last change of the state.
+	Reason   string
+	Restarts int
+	// StartTime is the time the running process was started.
+	StartTime time.Time
+	// LastExit describes how the previous execution of the process
+	// ended, nil until the process exits for the first time.
+	LastExit *ProcessExit
+	// RestartDelay is the time to wait before the process is started
+	// again, 0 if no restart is scheduled.
+	RestartDelay time.Duration
+}
+
 type Server interface {
 	Start(ctx context.Context) (chan<- bool, chan<- bool, <-chan struct{})
+	Events() <-chan ServerEvent
+	UpdateProcess() chan<- ProcessState
+	UpdateCheck() chan<- health.Result
+	Maintenance() <-chan bool
+	ChildReady() chan<- bool
+	Ping() chan<- bool
+	IsAlive() bool
+	Err() error
 }
 
 type server struct {
-	externalAlive   chan bool
-	isAlive         bool
-	isReady         bool
-	pingChannel     chan bool
-	pingInterval    time.Duration
-	server          *http.Server
-	shutdownTimeout time.Duration
-	updateReady     chan bool
-	mux             sync.Mutex
+	childReady        chan bool
+	err               error
+	events            chan ServerEvent
+	externalAlive     chan bool
+	grpcAddress       string
+	grpcHealth        *grpchealth.Server
+	grpcServer        *grpc.Server
+	heartbeatFile     *heartbeatFile
+	heartbeats        map[string]*Heartbeat
+	heartbeatsStatus  []HeartbeatStatus
+	history           []Transition
+	isAlive           bool
+	isReady           bool
+	isStarted         bool
+	lastPing          time.Time
+	liveness          []CheckStatus
+	maintenance       chan bool
+	maintenanceFile   *maintenanceFile
+	auth              map[RouteGroup]*Auth
+	maintenanceStatus MaintenanceStatus
+	metricsAddress    string
+	metricsCollectors []MetricsCollector
+	metricsServer     *http.Server
+	namedPing         chan string
+	pingChannel       chan bool
+	pingInterval      time.Duration
+	pingTimeout       time.Duration
+	pingToken         string
+	pingTokenRequired bool
+	pingTokenStatus   PingTokenStatus
+	processController ProcessController
+	processState      ProcessState
+	processStatus     string
+	procfs            *procfs.FS
+	progress          chan uint64
+	progressStatus    ProgressStatus
+	readiness         ReadinessConfig
+	readinessChecks   []CheckStatus
+	requestMetrics    *requestMetrics
+	restarts          map[string]uint64
+	server            *http.Server
+	shutdownTimeout   time.Duration
+	stallTimeout      time.Duration
+	startTime         time.Time
+	tlsConfig         *tls.Config
+	statusConfig      StatusConfig
+	updateCheck       chan health.Result
+	updateMaintenance chan MaintenanceStatus
+	updateProcess     chan ProcessState
+	updateReady       chan bool
+	waitChildReady    bool
+	mux               sync.Mutex
 }
 
 var httpServerShutdown = func(ctx context.Context, server *http.Server, shutdownTimeout time.Duration) {
@@ -48,20 +147,73 @@ var httpServerShutdown = func(ctx context.Context, server *http.Server, shutdown
 	logger.Infof("http server shutdown complete...")
 }
 
-func NewServer(addr string, shutdownTimeout, pingInterval time.Duration) Server {
+func NewServer(addr string, shutdownTimeout, pingInterval time.Duration, opts ...ServerOption) Server {
 	s := &server{
-		externalAlive:   make(chan bool),
-		pingChannel:     make(chan bool),
-		pingInterval:    pingInterval,
-		shutdownTimeout: shutdownTimeout,
-		updateReady:     make(chan bool),
+		childReady:        make(chan bool),
+		events:            make(chan ServerEvent, 1),
+		externalAlive:     make(chan bool),
+		maintenance:       make(chan bool, 1),
+		namedPing:         make(chan string),
+		pingChannel:       make(chan bool),
+		pingInterval:      pingInterval,
+		requestMetrics:    newRequestMetrics(),
+		progress:          make(chan uint64),
+		shutdownTimeout:   shutdownTimeout,
+		startTime:         time.Now(),
+		updateCheck:       make(chan health.Result),
+		updateMaintenance: make(chan MaintenanceStatus),
+		updateProcess:     make(chan ProcessState),
+		updateReady:       make(chan bool),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.grpcAddress != "" {
+		s.newGRPCServer()
 	}
 
 	mux := http.NewServeMux()
-	mux.Handle("/ready", LoggingMiddleware()(MethodsMiddleware([]string{"GET"})(http.HandlerFunc(s.ReadyHandler))))
-	mux.Handle("/alive", LoggingMiddleware()(MethodsMiddleware([]string{"GET"})(http.HandlerFunc(s.AliveHandler))))
-	mux.Handle("/ping", LoggingMiddleware()(MethodsMiddleware([]string{"GET"})(http.HandlerFunc(s.PingHandler))))
-	mux.Handle("/", LoggingMiddleware()(MethodsMiddleware([]string{"GET"})(http.HandlerFunc(RootHandler))))
+
+	// handle registers a route, the requests are logged and counted
+	// by the path of the route, and authenticated by its group
+	handle := func(mux *http.ServeMux, pattern, path string, group RouteGroup, methods []string, handler http.HandlerFunc) {
+		mux.Handle(pattern, LoggingMiddleware(s.requestMetrics.observer(path))(AuthMiddleware(s.auth[group])(MethodsMiddleware(methods)(handler))))
+	}
+
+	handle(mux, "/ready", "/ready", RouteGroupProbes, []string{"GET"}, s.ReadyHandler)
+	handle(mux, "/alive", "/alive", RouteGroupProbes, []string{"GET"}, s.AliveHandler)
+	handle(mux, "/livez", "/livez", RouteGroupProbes, []string{"GET"}, s.LivezHandler)
+	handle(mux, "/readyz", "/readyz", RouteGroupProbes, []string{"GET"}, s.ReadyzHandler)
+	handle(mux, "/status", "/status", RouteGroupProbes, []string{"GET"}, s.StatusHandler)
+	handle(mux, "/startup", "/startup", RouteGroupProbes, []string{"GET"}, s.StartupHandler)
+	handle(mux, "/ready/set", "/ready/set", RouteGroupPing, []string{"POST"}, s.ReadySetHandler)
+	handle(mux, "/ready/unset", "/ready/unset", RouteGroupPing, []string{"POST"}, s.ReadyUnsetHandler)
+	handle(mux, "/admin/maintenance", "/admin/maintenance", RouteGroupAdmin, []string{"POST"}, s.MaintenanceHandler)
+	handle(mux, "/admin/restart", "/admin/restart", RouteGroupAdmin, []string{"POST"}, s.ProcessRestartHandler)
+	handle(mux, "/admin/stop", "/admin/stop", RouteGroupAdmin, []string{"POST"}, s.ProcessStopHandler)
+	handle(mux, "/admin/start", "/admin/start", RouteGroupAdmin, []string{"POST"}, s.ProcessStartHandler)
+	handle(mux, "/admin/signal", "/admin/signal", RouteGroupAdmin, []string{"POST"}, s.ProcessSignalHandler)
+	handle(mux, "/ping", "/ping", RouteGroupPing, []string{"GET", "POST"}, s.PingHandler)
+	handle(mux, "/ping/", "/ping/{name}", RouteGroupPing, []string{"GET"}, s.NamedPingHandler)
+	handle(mux, "/", "/*", "", []string{"GET"}, RootHandler)
+
+	if s.metricsAddress == "" {
+		handle(mux, "/metrics", "/metrics", RouteGroupProbes, []string{"GET"}, s.MetricsHandler)
+	} else {
+		metricsMux := http.NewServeMux()
+		handle(metricsMux, "/metrics", "/metrics", RouteGroupProbes, []string{"GET"}, s.MetricsHandler)
+		handle(metricsMux, "/", "/*", "", []string{"GET"}, RootHandler)
+
+		s.metricsServer = &http.Server{
+			Addr:         s.metricsAddress,
+			Handler:      metricsMux,
+			ReadTimeout:  readTimeout,
+			WriteTimeout: writeTimeout,
+			IdleTimeout:  idleTimeout,
+		}
+	}
 
 	s.server = &http.Server{
 		Addr:         addr,
@@ -76,61 +228,347 @@ func NewServer(addr string, shutdownTimeout, pingInterval time.Duration) Server
 
 func (s *server) do(ctx context.Context, serverError chan error, serverDone chan struct{}) {
 	defer close(serverDone)
-	defer close(s.pingChannel)
-	defer close(serverError)
 
 	timer := time.NewTimer(s.pingInterval)
 
+	// the ping timeout restored when the process stops overriding it
+	configuredPingInterval := s.pingInterval
+
 	isPingAlive := true
+	pingReason := ""
 	isExternalAlive := false
+	isServerReady := false
+
+	// the latest results of the health checks, by name
+	checks := make(map[string]health.Result)
+
+	// the readiness declared by the wrapped process
+	initialChildReady := !s.waitChildReady
+	isChildReady := initialChildReady
+
+	// the readiness policy, following the lifecycle of the process
+	readiness := newReadinessTracker(s.readiness)
+
+	defer readiness.timer.Stop()
+
+	// the maintenance mode, set by the file or by the admin API
+	maintenance := &maintenanceTracker{}
+
+	// the timers of the named heartbeats
+	heartbeatExpired := make(chan string)
+	heartbeats := s.startHeartbeatTimers(ctx, heartbeatExpired)
+
+	s.setHeartbeatsStatus(heartbeats)
+
+	defer stopHeartbeatTimers(heartbeats)
+
+	// the progress reported on the ping endpoint
+	progress := newProgressTracker(s.stallTimeout)
+	isProgressAlive := true
+
+	defer progress.timer.Stop()
+
+	// livenessChecks returns the checks contributing to the liveness,
+	// as reported by /livez
+	livenessChecks := func() []CheckStatus {
+		list := []CheckStatus{
+			newCheckStatus("process", isExternalAlive, "the wrapped process is not running"),
+			newCheckStatus("ping", isPingAlive, pingReason),
+		}
+
+		if s.stallTimeout > 0 {
+			reason := fmt.Sprintf("the progress is stalled at %d since %s", progress.status.Value, progress.status.LastChange.Format(time.RFC3339))
+			list = append(list, newCheckStatus("progress", isProgressAlive, reason))
+		}
+
+		list = append(list, heartbeatsChecksStatus(heartbeats)...)
+
+		return append(list, healthChecksStatus(checks, health.TargetAlive)...)
+	}
+
+	// readinessChecks returns the checks contributing to the readiness,
+	// as reported by /readyz
+	readinessChecks := func() []CheckStatus {
+		list := []CheckStatus{
+			newCheckStatus("server", isServerReady, "the wrapper is not serving"),
+			newCheckStatus("child", isChildReady, "the wrapped process did not declare itself ready"),
+		}
+
+		if s.readiness.Policy == ReadinessProcess {
+			list = append(list, newCheckStatus("lifecycle", readiness.isReady(), readiness.reason()))
+		}
+
+		status := maintenance.status()
+		reason := "enabled by " + status.EnabledBy
+		if status.Reason != "" {
+			reason += ": " + status.Reason
+		}
+
+		list = append(list, newCheckStatus("maintenance", !status.Enabled, reason))
+
+		return append(list, healthChecksStatus(checks, health.TargetReady)...)
+	}
+
+	alive := func() bool {
+		return checksPassed(livenessChecks())
+	}
+
+	ready := func() bool {
+		return checksPassed(readinessChecks())
+	}
+
+	// applyMaintenance applies a change of the maintenance mode
+	applyMaintenance := func() {
+		status, previous := maintenance.status(), s.MaintenanceStatus()
+		if status == previous {
+			return
+		}
+
+		s.setMaintenanceStatus(status)
+		s.setReadiness(readinessChecks())
+
+		if status.Enabled {
+			logger.Warnf("maintenance mode enabled by %s: %s", status.EnabledBy, status.Reason)
+		} else {
+			logger.Infof("maintenance mode disabled")
+		}
+
+		if status.Enabled != previous.Enabled {
+			s.sendMaintenance(status.Enabled)
+		}
+	}
+
+	var maintenanceTick <-chan time.Time
+
+	if s.maintenanceFile != nil {
+		maintenance.file, _ = s.maintenanceFile.check(maintenance.file)
+		applyMaintenance()
+
+		ticker := time.NewTicker(s.maintenanceFile.interval)
+		defer ticker.Stop()
+
+		maintenanceTick = ticker.C
+	}
+
+	// ping handles a heartbeat of the wrapped process, received on
+	// the /ping endpoint or read from the heartbeat file
+	ping := func(isAlive bool) {
+		isPingAlive = isAlive
+		pingReason = "the wrapped process is not alive"
+
+		if isAlive {
+			s.setLastPing(time.Now())
+		}
+
+		s.sendEvent(ServerEventStartupSignal)
+
+		if s.pingInterval == 0 {
+			logger.Debugf("timeout is %s, ignoring ping endpoint", s.pingInterval)
+
+			isPingAlive = true
+
+			s.setLiveness(livenessChecks())
+
+			return
+		}
+
+		s.setLiveness(livenessChecks())
+		logger.Debugf("alive status changed to %t", alive())
+
+		if !timer.Stop() {
+			<-timer.C
+		}
+
+		timer.Reset(s.pingInterval)
+		logger.Debugf("timer restarted")
+	}
+
+	var heartbeatTick <-chan time.Time
+
+	if s.heartbeatFile != nil {
+		ticker := time.NewTicker(s.heartbeatFile.interval)
+		defer ticker.Stop()
+
+		heartbeatTick = ticker.C
+	}
+
+	s.setPingTimeout(s.pingInterval)
+	s.setLiveness(livenessChecks())
+	s.setReadiness(readinessChecks())
 
 	for {
 		select {
-		case <-serverError:
-			s.setReady(false)
+		case err := <-serverError:
+			isServerReady = false
+
+			s.mux.Lock()
+			s.err = err
+			s.mux.Unlock()
+
+			s.setReadiness(readinessChecks())
 
 			_ = timer.Stop()
 
+			// the listeners which didn't fail must not outlive the server
+			s.shutdown(ctx)
+
 			return
 
 		case <-ctx.Done():
 			logger.Debugf("http server context is closing")
-			s.setReady(false)
+			isServerReady = false
+
+			s.setReadiness(readinessChecks())
 
 			_ = timer.Stop()
 
-			httpServerShutdown(ctx, s.server, s.shutdownTimeout)
+			s.shutdown(ctx)
 
 			return
 
 		case isExternalAlive = <-s.externalAlive:
-			s.setAlive(isExternalAlive && isPingAlive)
-			logger.Debugf("alive status changed to %t", isExternalAlive && isPingAlive)
+			s.setLiveness(livenessChecks())
+			logger.Debugf("alive status changed to %t", alive())
 
-		case isPingAlive = <-s.pingChannel:
-			if s.pingInterval == 0 {
-				logger.Debugf("timeout is %s, ignoring ping endpoint", s.pingInterval)
+		case isAlive := <-s.pingChannel:
+			ping(isAlive)
+
+		case value := <-s.progress:
+			progress.update(value)
+			isProgressAlive = !progress.status.Stalled
+
+			s.setProgressStatus(progress.status)
+			s.setLiveness(livenessChecks())
 
-				isPingAlive = true
+		case <-progress.timer.C:
+			progress.status.Stalled = true
+			isProgressAlive = false
 
-				s.setAlive(isExternalAlive && isPingAlive)
+			logger.Warnf("the progress is stalled at %d since %s", progress.status.Value, progress.status.LastChange.Format(time.RFC3339))
 
+			s.setProgressStatus(progress.status)
+			s.setLiveness(livenessChecks())
+
+		case name := <-s.namedPing:
+			heartbeats[name].ping()
+			s.setHeartbeatsStatus(heartbeats)
+			s.setLiveness(livenessChecks())
+			s.sendEvent(ServerEventStartupSignal)
+
+		case name := <-heartbeatExpired:
+			if !heartbeats[name].expire() {
 				continue
 			}
 
-			s.setAlive(isExternalAlive && isPingAlive)
-			logger.Debugf("alive status changed to %t", isExternalAlive && isPingAlive)
+			logger.Warnf("heartbeat %s is expired", name)
+
+			s.setHeartbeatsStatus(heartbeats)
+			s.setLiveness(livenessChecks())
+
+		case <-heartbeatTick:
+			isTouched, isMissing := s.heartbeatFile.check(s.pingInterval)
+
+			if isMissing && s.heartbeatFile.mustExist {
+				if isPingAlive {
+					logger.Warnf("the heartbeat file %s is missing", s.heartbeatFile.path)
+				}
+
+				isPingAlive = false
+				pingReason = fmt.Sprintf("the heartbeat file %s is missing", s.heartbeatFile.path)
+
+				s.setLiveness(livenessChecks())
+
+				continue
+			}
+
+			if isTouched {
+				ping(true)
+			}
+
+		case isServerReady = <-s.updateReady:
+			s.setReadiness(readinessChecks())
+			logger.Debugf("ready status changed to %t", ready())
+
+		case <-readiness.timer.C:
+			readiness.delayed = true
+
+			logger.Debugf("the readiness delay of the wrapped process is elapsed")
+			s.setReadiness(readinessChecks())
+
+		case <-maintenanceTick:
+			maintenance.file, _ = s.maintenanceFile.check(maintenance.file)
+			applyMaintenance()
+
+		case status := <-s.updateMaintenance:
+			if status.Enabled && maintenance.api.Enabled {
+				// the maintenance is still the same
+				status.Since = maintenance.api.Since
+			}
+
+			maintenance.api = status
+			applyMaintenance()
+
+		case isReady := <-s.childReady:
+			if isReady != isChildReady {
+				logger.Infof("the wrapped process declared itself ready: %t", isReady)
+			}
+
+			isChildReady = isReady
+
+			s.setReadiness(readinessChecks())
+
+		case result := <-s.updateCheck:
+			checks[result.Name] = result
+			readiness.check(result)
+
+			s.setLiveness(livenessChecks())
+			s.setReadiness(readinessChecks())
+			logger.Debugf("health check %s changed to %t", result.Name, result.Healthy)
+
+		case state := <-s.updateProcess:
+			s.setStarted(state.Started)
+			s.setProcessStatus(state.Status)
+			s.setPingToken(state.Token)
+			s.setProcessState(state)
+
+			if state.Pid == 0 {
+				// the next process declares its readiness from scratch
+				isChildReady = initialChildReady
+			}
+
+			readiness.update(state)
+			s.setReadiness(readinessChecks())
+
+			if !state.Started && progress.status.Reported {
+				// a restarted process reports its progress from scratch
+				progress.reset()
+				isProgressAlive = true
+
+				s.setProgressStatus(progress.status)
+				s.setLiveness(livenessChecks())
+			}
+
+			pingInterval := state.PingTimeout
+			if pingInterval == 0 {
+				pingInterval = configuredPingInterval
+			}
+
+			if pingInterval == s.pingInterval {
+				continue
+			}
+
+			s.pingInterval = pingInterval
+			s.setPingTimeout(s.pingInterval)
+			logger.Infof("ping timeout changed to %s", s.pingInterval)
 
 			if !timer.Stop() {
-				<-timer.C
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
 
 			timer.Reset(s.pingInterval)
-			logger.Debugf("timer restarted")
-
-		case isReady := <-s.updateReady:
-			s.setReady(isReady)
-			logger.Debugf("ready status changed to %t", isReady)
 
 		case <-timer.C:
 			if s.pingInterval == 0 {
@@ -139,17 +577,34 @@ func (s *server) do(ctx context.Context, serverError chan error, serverDone chan
 			}
 
 			isPingAlive = false
+			pingReason = fmt.Sprintf("no ping received within %s", s.pingInterval)
 
-			s.setAlive(isExternalAlive && isPingAlive)
+			s.setLiveness(livenessChecks())
 			timer.Reset(s.pingInterval)
 			logger.Debugf("timer is expired, restarted with interval %s", s.pingInterval)
 		}
 	}
 }
 
+// shutdown shuts down the http server, and the grpc and the metrics
+// servers if they're enabled.
+func (s *server) shutdown(ctx context.Context) {
+	httpServerShutdown(ctx, s.server, s.shutdownTimeout)
+
+	if s.metricsServer != nil {
+		httpServerShutdown(ctx, s.metricsServer, s.shutdownTimeout)
+	}
+
+	if s.grpcServer != nil {
+		grpcServerShutdown(s.grpcServer, s.grpcHealth)
+	}
+}
+
 func (s *server) Start(ctx context.Context) (chan<- bool, chan<- bool, <-chan struct{}) {
 	serverDone := make(chan struct{})
-	serverError := make(chan error)
+	// every listener sends at most one error, the channel is never
+	// closed, so the listeners failing after the first one don't block
+	serverError := make(chan error, 3)
 
 	s.mux.Lock()
 	addr := s.server.Addr
@@ -159,12 +614,46 @@ func (s *server) Start(ctx context.Context) (chan<- bool, chan<- bool, <-chan st
 
 	go s.do(ctx, serverError, serverDone)
 
+	if s.grpcServer != nil {
+		s.startGRPC(serverError)
+	}
+
+	if s.metricsServer != nil {
+		s.startMetrics(serverError)
+	}
+
 	go func() {
-		s.updateReady <- true
+		// the server may already be done, if another listener failed
+		select {
+		case s.updateReady <- true:
+		case <-serverDone:
+			return
+		}
 
-		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
 			logger.Errorf("cannot bind http server on %s: %s", addr, err)
 			serverError <- err
+
+			return
+		}
+
+		if s.tlsConfig != nil {
+			listener = tls.NewListener(listener, s.tlsConfig)
+		}
+
+		// the event is sent apart, the server must not wait for the
+		// wrapper to read it
+		go func() {
+			select {
+			case s.events <- ServerEventListening:
+			case <-ctx.Done():
+			}
+		}()
+
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("http server on %s failed: %s", addr, err)
+			serverError <- err
 		}
 	}()
 
@@ -174,11 +663,46 @@ func (s *server) Start(ctx context.Context) (chan<- bool, chan<- bool, <-chan st
 	return s.updateReady, s.externalAlive, serverDone
 }
 
+// Events returns the channel where the server sends the events
+// addressed to the wrapper.
+func (s *server) Events() <-chan ServerEvent {
+	return s.events
+}
+
+// UpdateProcess returns the channel used to update the state of
+// the wrapped process exposed by the server.
+func (s *server) UpdateProcess() chan<- ProcessState {
+	return s.updateProcess
+}
+
+// Ping returns the channel used to notify the server that the wrapped
+// process is still working, like a call to the /ping endpoint.
+func (s *server) Ping() chan<- bool {
+	return s.pingChannel
+}
+
+// UpdateCheck returns the channel used to update the results of
+// the health checks, which are part of the liveness or the readiness
+// exposed by the server, according to their target.
+func (s *server) UpdateCheck() chan<- health.Result {
+	return s.updateCheck
+}
+
+// sendEvent sends an event to the wrapper, without blocking the
+// server if the previous event is still pending.
+func (s *server) sendEvent(event ServerEvent) {
+	select {
+	case s.events <- event:
+	default:
+	}
+}
+
 func (s *server) setAlive(isAlive bool) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
 	s.isAlive = isAlive
+	s.setServingStatus(GRPCServiceLiveness, isAlive)
 }
 
 func (s *server) IsAlive() bool {
@@ -188,11 +712,21 @@ func (s *server) IsAlive() bool {
 	return s.isAlive
 }
 
+// Err returns the error of the listener which stopped the server, nil
+// if it's running or it was cancelled.
+func (s *server) Err() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.err
+}
+
 func (s *server) setReady(isReady bool) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
 	s.isReady = isReady
+	s.setServingStatus(GRPCServiceReadiness, isReady)
 }
 
 func (s *server) IsReady() bool {
@@ -201,3 +735,32 @@ func (s *server) IsReady() bool {
 
 	return s.isReady
 }
+
+func (s *server) setStarted(isStarted bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.isStarted = isStarted
+	s.setServingStatus(GRPCServiceStartup, isStarted)
+}
+
+func (s *server) IsStarted() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.isStarted
+}
+
+func (s *server) setProcessStatus(status string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.processStatus = status
+}
+
+func (s *server) ProcessStatus() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.processStatus
+}
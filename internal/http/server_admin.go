@@ -0,0 +1,158 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// processActionTimeout is the time the admin API waits for an action
+// to be accepted by the wrapper.
+const processActionTimeout = 10 * time.Second
+
+var ErrInvalidSignal = errors.New("invalid signal")
+
+// ProcessAction is an action on the wrapped process requested with the
+// admin API.
+type ProcessAction struct {
+	// Name is one of restart, stop, start or signal.
+	Name string
+	// Signal is the signal sent by the signal action.
+	Signal syscall.Signal
+	// RequestedBy describes who requested the action.
+	RequestedBy string
+}
+
+func (a ProcessAction) String() string {
+	if a.Name == "signal" {
+		return a.Name + " " + unix.SignalName(a.Signal)
+	}
+
+	return a.Name
+}
+
+// ProcessController applies an action on the wrapped process, it
+// returns an error if the action cannot be applied in the current
+// state of the process.
+type ProcessController func(ctx context.Context, action ProcessAction) error
+
+// WithProcessController enables the actions on the wrapped process of
+// the admin API.
+func WithProcessController(controller ProcessController) ServerOption {
+	return func(s *server) {
+		s.processController = controller
+	}
+}
+
+// requestedBy describes who sent an admin request: the principal
+// authenticated by the admin routes, if any, with the method, the path
+// and the address. The optional by parameter is not verified, so it's
+// only added as a note.
+func requestedBy(r *http.Request) string {
+	from := r.Method + " " + r.URL.Path + " from " + r.RemoteAddr
+	if principal := requestPrincipal(r); principal != "" {
+		from = principal + " (" + from + ")"
+	}
+
+	if by := r.FormValue("by"); by != "" {
+		from += fmt.Sprintf(", note %q", by)
+	}
+
+	return from
+}
+
+// parseSignal parses the name of a signal, with or without the SIG
+// prefix, like SIGHUP or HUP.
+func parseSignal(name string) (syscall.Signal, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSignal, name)
+	}
+
+	return sig, nil
+}
+
+// applyProcessAction applies an action of the admin API, every request
+// is logged and every applied action is recorded in the history.
+func (s *server) applyProcessAction(endpoint string, action ProcessAction, w http.ResponseWriter, r *http.Request) {
+	if s.processController == nil {
+		writeToResponse(endpoint, http.StatusNotImplemented, w)
+		return
+	}
+
+	action.RequestedBy = requestedBy(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), processActionTimeout)
+	defer cancel()
+
+	if err := s.processController(ctx, action); err != nil {
+		logger.Warnf("admin action %s requested by %s is refused: %s", action, action.RequestedBy, err)
+
+		status := http.StatusConflict
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeTextToResponse(endpoint, status, err.Error(), w)
+
+		return
+	}
+
+	logger.Warnf("admin action %s requested by %s", action, action.RequestedBy)
+
+	s.mux.Lock()
+	s.addTransition("admin", action.String(), "by "+action.RequestedBy)
+	s.mux.Unlock()
+
+	// the signal is sent, the other actions are started
+	status := http.StatusAccepted
+	if action.Name == "signal" {
+		status = http.StatusOK
+	}
+
+	writeToResponse(endpoint, status, w)
+}
+
+// ProcessRestartHandler restarts the wrapped process with the stop
+// sequence.
+func (s *server) ProcessRestartHandler(w http.ResponseWriter, r *http.Request) {
+	s.applyProcessAction("/admin/restart", ProcessAction{Name: "restart"}, w, r)
+}
+
+// ProcessStopHandler stops the wrapped process with the stop sequence,
+// it's not restarted until it's started with ProcessStartHandler.
+func (s *server) ProcessStopHandler(w http.ResponseWriter, r *http.Request) {
+	s.applyProcessAction("/admin/stop", ProcessAction{Name: "stop"}, w, r)
+}
+
+// ProcessStartHandler starts the wrapped process, if it's not running.
+func (s *server) ProcessStartHandler(w http.ResponseWriter, r *http.Request) {
+	s.applyProcessAction("/admin/start", ProcessAction{Name: "start"}, w, r)
+}
+
+// ProcessSignalHandler sends the signal in the sig parameter to the
+// wrapped process.
+func (s *server) ProcessSignalHandler(w http.ResponseWriter, r *http.Request) {
+	sig, err := parseSignal(r.FormValue("sig"))
+	if err != nil {
+		logger.Warnf("ignoring a signal request from %s: %s", r.RemoteAddr, err)
+		writeToResponse("/admin/signal", http.StatusBadRequest, w)
+
+		return
+	}
+
+	s.applyProcessAction("/admin/signal", ProcessAction{Name: "signal", Signal: sig}, w, r)
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func Test_parseSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{name: "HUP", want: syscall.SIGHUP},
+		{name: "sigusr1", want: syscall.SIGUSR1},
+		{name: "SIGTERM", want: syscall.SIGTERM},
+		{name: "", wantErr: true},
+		{name: "SIGNOPE", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSignal(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSignal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("parseSignal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_server_ProcessHandlers(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	errNotRunning := errors.New("the wrapped process is not running")
+
+	tests := []struct {
+		name       string
+		handler    func(s *server) http.HandlerFunc
+		path       string
+		principal  string
+		err        error
+		wantAction ProcessAction
+		wantStatus int
+		wantState  string
+	}{
+		{
+			name:       "Restart",
+			handler:    func(s *server) http.HandlerFunc { return s.ProcessRestartHandler },
+			path:       "/admin/restart?by=alice",
+			principal:  "token",
+			wantAction: ProcessAction{Name: "restart", RequestedBy: `token (POST /admin/restart from 192.0.2.1:1234), note "alice"`},
+			wantStatus: http.StatusAccepted,
+			wantState:  "restart",
+		},
+		{
+			name:       "Stop",
+			handler:    func(s *server) http.HandlerFunc { return s.ProcessStopHandler },
+			path:       "/admin/stop",
+			principal:  "user alice",
+			wantAction: ProcessAction{Name: "stop", RequestedBy: "user alice (POST /admin/stop from 192.0.2.1:1234)"},
+			wantStatus: http.StatusAccepted,
+			wantState:  "stop",
+		},
+		{
+			name:       "Start_refused",
+			handler:    func(s *server) http.HandlerFunc { return s.ProcessStartHandler },
+			path:       "/admin/start",
+			err:        errors.New("the wrapped process is already running"),
+			wantAction: ProcessAction{Name: "start", RequestedBy: "POST /admin/start from 192.0.2.1:1234"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Signal",
+			handler:    func(s *server) http.HandlerFunc { return s.ProcessSignalHandler },
+			path:       "/admin/signal?sig=HUP&by=bob",
+			wantAction: ProcessAction{Name: "signal", Signal: syscall.SIGHUP, RequestedBy: `POST /admin/signal from 192.0.2.1:1234, note "bob"`},
+			wantStatus: http.StatusOK,
+			wantState:  "signal SIGHUP",
+		},
+		{
+			name:       "Signal_not_running",
+			handler:    func(s *server) http.HandlerFunc { return s.ProcessSignalHandler },
+			path:       "/admin/signal?sig=USR1",
+			err:        errNotRunning,
+			wantAction: ProcessAction{Name: "signal", Signal: syscall.SIGUSR1, RequestedBy: "POST /admin/signal from 192.0.2.1:1234"},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "Signal_invalid",
+			handler:    func(s *server) http.HandlerFunc { return s.ProcessSignalHandler },
+			path:       "/admin/signal?sig=NOPE",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Timeout",
+			handler:    func(s *server) http.HandlerFunc { return s.ProcessRestartHandler },
+			path:       "/admin/restart",
+			err:        context.DeadlineExceeded,
+			wantAction: ProcessAction{Name: "restart", RequestedBy: "POST /admin/restart from 192.0.2.1:1234"},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ProcessAction
+
+			s := &server{}
+			WithProcessController(func(_ context.Context, action ProcessAction) error {
+				got = action
+				return tt.err
+			})(s)
+
+			r := httptest.NewRequest("POST", tt.path, nil)
+			if tt.principal != "" {
+				r = r.WithContext(context.WithValue(r.Context(), principalKey{}, tt.principal))
+			}
+
+			rr := httptest.NewRecorder()
+			tt.handler(s).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+
+			if got != tt.wantAction {
+				t.Errorf("expected the action %+v, got %+v", tt.wantAction, got)
+			}
+
+			// only the applied actions are recorded
+			history := s.History()
+
+			if tt.wantState == "" {
+				if len(history) != 0 {
+					t.Errorf("expected no transitions, got %+v", history)
+				}
+
+				return
+			}
+
+			if len(history) != 1 || history[0].Subject != "admin" || history[0].State != tt.wantState || history[0].Reason != "by "+tt.wantAction.RequestedBy {
+				t.Errorf("expected the admin transition %q, got %+v", tt.wantState, history)
+			}
+		})
+	}
+
+	t.Run("Not_configured", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc((&server{}).ProcessRestartHandler).ServeHTTP(rr, httptest.NewRequest("POST", "/admin/restart", nil))
+
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotImplemented)
+		}
+	})
+}
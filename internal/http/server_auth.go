@@ -0,0 +1,377 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+var ErrInvalidAuth = errors.New("invalid auth")
+
+// RouteGroup is a group of routes sharing the same authentication.
+type RouteGroup string
+
+const (
+	// RouteGroupProbes are the endpoints reporting the state of the
+	// wrapper: /alive, /ready, /startup, /livez, /readyz, /status and
+	// /metrics.
+	RouteGroupProbes RouteGroup = "probes"
+	// RouteGroupPing are the endpoints called by the wrapped process:
+	// /ping, /ping/{name}, /ready/set and /ready/unset.
+	RouteGroupPing RouteGroup = "ping"
+	// RouteGroupAdmin are the /admin endpoints.
+	RouteGroupAdmin RouteGroup = "admin"
+)
+
+// RouteGroups lists the groups of routes, in the order of the
+// configuration.
+var RouteGroups = []RouteGroup{RouteGroupProbes, RouteGroupPing, RouteGroupAdmin}
+
+// BasicAuthUser is a user of the HTTP basic authentication, with the
+// bcrypt hash of its password.
+type BasicAuthUser struct {
+	User         string `mapstructure:"user"`
+	PasswordHash string `mapstructure:"password-hash"`
+}
+
+// AuthConfig is the configuration of the authentication of a group of
+// routes. The client address must match the allow-list, if any; then,
+// if any credentials are configured, the request must have one of
+// them: the bearer token, a basic auth user, or a client certificate
+// with one of the subjects.
+type AuthConfig struct {
+	Token              string          `mapstructure:"token"`
+	TokenFile          string          `mapstructure:"token-file"`
+	Basic              []BasicAuthUser `mapstructure:"basic"`
+	Allow              []string        `mapstructure:"allow"`
+	ClientCertSubjects []string        `mapstructure:"client-cert-subjects"`
+}
+
+// Auth authenticates the requests to a group of routes.
+type Auth struct {
+	networks []*net.IPNet
+	subjects map[string]struct{}
+	token    []byte
+	users    map[string][]byte
+}
+
+// NewAuth validates the configuration of the authentication of a
+// group of routes, the token file is read once.
+func NewAuth(cfg AuthConfig) (*Auth, error) {
+	a := &Auth{
+		subjects: make(map[string]struct{}, len(cfg.ClientCertSubjects)),
+		users:    make(map[string][]byte, len(cfg.Basic)),
+	}
+
+	if cfg.Token != "" && cfg.TokenFile != "" {
+		return nil, fmt.Errorf("%w: the token and the token file cannot be used together", ErrInvalidAuth)
+	}
+
+	a.token = []byte(cfg.Token)
+
+	if cfg.TokenFile != "" {
+		content, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cannot read the token file: %s", ErrInvalidAuth, err)
+		}
+
+		if a.token = []byte(strings.TrimSpace(string(content))); len(a.token) == 0 {
+			return nil, fmt.Errorf("%w: the token file %s is empty", ErrInvalidAuth, cfg.TokenFile)
+		}
+	}
+
+	for _, user := range cfg.Basic {
+		if user.User == "" || strings.Contains(user.User, ":") {
+			return nil, fmt.Errorf("%w: the user %q is not valid", ErrInvalidAuth, user.User)
+		}
+
+		if _, err := bcrypt.Cost([]byte(user.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("%w: %s: the password hash is not a bcrypt hash: %s", ErrInvalidAuth, user.User, err)
+		}
+
+		a.users[user.User] = []byte(user.PasswordHash)
+	}
+
+	for _, allow := range cfg.Allow {
+		network, err := parseNetwork(allow)
+		if err != nil {
+			return nil, err
+		}
+
+		a.networks = append(a.networks, network)
+	}
+
+	for _, subject := range cfg.ClientCertSubjects {
+		a.subjects[subject] = struct{}{}
+	}
+
+	return a, nil
+}
+
+// parseNetwork parses an address or a network in the CIDR notation,
+// an address is a network of a single address.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a valid network", ErrInvalidAuth, value)
+		}
+
+		return network, nil
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: %q is not a valid address", ErrInvalidAuth, value)
+	}
+
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// WithAuth authenticates the requests to a group of routes.
+func WithAuth(group RouteGroup, auth *Auth) ServerOption {
+	return func(s *server) {
+		if s.auth == nil {
+			s.auth = make(map[RouteGroup]*Auth)
+		}
+
+		s.auth[group] = auth
+	}
+}
+
+// clientRequest is what is authenticated of a http request, or of a
+// grpc call: the address of the client and its credentials.
+type clientRequest struct {
+	remoteAddr    string
+	authorization string
+	tls           *tls.ConnectionState
+}
+
+// newClientRequest returns the address and the credentials of r.
+func newClientRequest(r *http.Request) clientRequest {
+	return clientRequest{
+		remoteAddr:    r.RemoteAddr,
+		authorization: r.Header.Get("Authorization"),
+		tls:           r.TLS,
+	}
+}
+
+// basicAuth parses the credentials of the HTTP basic authentication,
+// like http.Request.BasicAuth.
+func (c clientRequest) basicAuth() (user, password string, ok bool) {
+	const prefix = "Basic "
+
+	if len(c.authorization) < len(prefix) || !strings.EqualFold(c.authorization[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(c.authorization[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
+
+// hasCredentials returns true if the requests must have credentials.
+func (a *Auth) hasCredentials() bool {
+	return len(a.token) > 0 || len(a.users) > 0 || len(a.subjects) > 0
+}
+
+// isAllowed checks the client address against the allow-list.
+func (a *Auth) isAllowed(c clientRequest) bool {
+	if len(a.networks) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(c.remoteAddr)
+	if err != nil {
+		host = c.remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAuthenticated checks the credentials of the request: the principal
+// describes the accepted credentials, like "user alice", the reason
+// explains why they are refused.
+func (a *Auth) isAuthenticated(c clientRequest) (principal string, ok bool, reason string) {
+	if c.tls != nil && len(a.subjects) > 0 {
+		for _, chain := range c.tls.VerifiedChains {
+			if len(chain) > 0 && a.matchSubject(chain[0]) {
+				return "certificate " + chain[0].Subject.String(), true, ""
+			}
+		}
+	}
+
+	if token, ok := strings.CutPrefix(c.authorization, "Bearer "); ok && len(a.token) > 0 {
+		if subtle.ConstantTimeCompare([]byte(token), a.token) == 1 {
+			return "token", true, ""
+		}
+
+		return "", false, "invalid bearer token"
+	}
+
+	if user, password, ok := c.basicAuth(); ok && len(a.users) > 0 {
+		hash, found := a.users[user]
+		if found && bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil {
+			return "user " + user, true, ""
+		}
+
+		return "", false, fmt.Sprintf("invalid password for the user %q", user)
+	}
+
+	if c.tls != nil && len(c.tls.PeerCertificates) > 0 {
+		return "", false, fmt.Sprintf("client certificate %q not allowed", c.tls.PeerCertificates[0].Subject)
+	}
+
+	return "", false, "no credentials"
+}
+
+// matchSubject matches the subject of a client certificate, either in
+// full, like CN=ops,O=example, or by its common name.
+func (a *Auth) matchSubject(cert *x509.Certificate) bool {
+	if _, ok := a.subjects[cert.Subject.String()]; ok {
+		return true
+	}
+
+	_, ok := a.subjects[cert.Subject.CommonName]
+
+	return ok && cert.Subject.CommonName != ""
+}
+
+// challenge sets the WWW-Authenticate headers of the accepted schemes.
+func (a *Auth) challenge(w http.ResponseWriter) {
+	if len(a.token) > 0 {
+		w.Header().Add("WWW-Authenticate", `Bearer realm="liveness-wrapper"`)
+	}
+
+	if len(a.users) > 0 {
+		w.Header().Add("WWW-Authenticate", `Basic realm="liveness-wrapper"`)
+	}
+}
+
+// principalKey is the key of the authenticated principal in the
+// context of a request.
+type principalKey struct{}
+
+// requestPrincipal returns the principal authenticated by
+// AuthMiddleware, empty if the route doesn't require credentials.
+func requestPrincipal(r *http.Request) string {
+	principal, _ := r.Context().Value(principalKey{}).(string)
+
+	return principal
+}
+
+// AuthMiddleware refuses the requests not allowed by auth, with 403 if
+// the client address is not allowed, or 401 if the credentials are
+// missing or wrong; the refused requests are logged. The principal of
+// the accepted credentials is stored in the context of the request. A
+// nil auth allows every request.
+func AuthMiddleware(auth *Auth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if auth == nil {
+			return next
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			c := newClientRequest(r)
+
+			if !auth.isAllowed(c) {
+				logger.HTTPWarn(r, http.StatusForbidden)
+				logger.Debugf("refused a request from %s: the address is not allowed", r.RemoteAddr)
+				writeToResponse(r.URL.Path, http.StatusForbidden, w)
+
+				return
+			}
+
+			if !auth.hasCredentials() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, ok, reason := auth.isAuthenticated(c)
+			if !ok {
+				logger.HTTPWarn(r, http.StatusUnauthorized)
+				logger.Debugf("refused a request from %s: %s", r.RemoteAddr, reason)
+				auth.challenge(w)
+				writeToResponse(r.URL.Path, http.StatusUnauthorized, w)
+
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// NewTLSConfig loads the certificate of the server; if clientCAFile is
+// not empty, the client certificates signed by its authorities are
+// verified, to be matched by the client-cert-subjects of the routes.
+func NewTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the certificate of the server: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		content, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the client certificate authorities: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+
+		// the certificate is optional, a route can use other credentials
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		cfg.ClientCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// WithTLS serves the http server, the metrics one and the grpc one with
+// TLS.
+func WithTLS(cfg *tls.Config) ServerOption {
+	return func(s *server) {
+		s.tlsConfig = cfg
+	}
+}
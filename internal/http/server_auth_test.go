@@ -0,0 +1,377 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func testPasswordHash(t *testing.T, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(hash)
+}
+
+func TestNewAuth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyFile := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(emptyFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     AuthConfig
+		wantErr bool
+	}{
+		{name: "Empty", cfg: AuthConfig{}},
+		{name: "Token_file", cfg: AuthConfig{TokenFile: tokenFile}},
+		{name: "Token_and_token_file", cfg: AuthConfig{Token: "secret", TokenFile: tokenFile}, wantErr: true},
+		{name: "Missing_token_file", cfg: AuthConfig{TokenFile: filepath.Join(t.TempDir(), "missing")}, wantErr: true},
+		{name: "Empty_token_file", cfg: AuthConfig{TokenFile: emptyFile}, wantErr: true},
+		{name: "Basic", cfg: AuthConfig{Basic: []BasicAuthUser{{User: "alice", PasswordHash: testPasswordHash(t, "pass")}}}},
+		{name: "Basic_plain_password", cfg: AuthConfig{Basic: []BasicAuthUser{{User: "alice", PasswordHash: "pass"}}}, wantErr: true},
+		{name: "Basic_invalid_user", cfg: AuthConfig{Basic: []BasicAuthUser{{User: "a:b", PasswordHash: testPasswordHash(t, "pass")}}}, wantErr: true},
+		{name: "Allow", cfg: AuthConfig{Allow: []string{"127.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"}}},
+		{name: "Allow_invalid_address", cfg: AuthConfig{Allow: []string{"localhost"}}, wantErr: true},
+		{name: "Allow_invalid_network", cfg: AuthConfig{Allow: []string{"10.0.0.0/33"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAuth(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrInvalidAuth) {
+				t.Errorf("NewAuth() error = %v, want %v", err, ErrInvalidAuth)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	hash := testPasswordHash(t, "pass")
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops", Organization: []string{"example"}}}
+
+	tests := []struct {
+		name          string
+		cfg           AuthConfig
+		remoteAddr    string
+		prepare       func(r *http.Request)
+		want          int
+		wantPrincipal string
+	}{
+		{
+			name: "Open",
+			want: http.StatusOK,
+		},
+		{
+			name:       "Allowed_address",
+			cfg:        AuthConfig{Allow: []string{"10.0.0.0/8"}},
+			remoteAddr: "10.1.2.3:4567",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "Refused_address",
+			cfg:        AuthConfig{Allow: []string{"10.0.0.0/8", "127.0.0.1"}},
+			remoteAddr: "192.0.2.1:4567",
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "Refused_address_with_credentials",
+			cfg:        AuthConfig{Token: "secret", Allow: []string{"::1"}},
+			remoteAddr: "192.0.2.1:4567",
+			prepare:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			want:       http.StatusForbidden,
+		},
+		{
+			name:          "Token",
+			cfg:           AuthConfig{Token: "secret"},
+			prepare:       func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			want:          http.StatusOK,
+			wantPrincipal: "token",
+		},
+		{
+			name:    "Wrong_token",
+			cfg:     AuthConfig{Token: "secret"},
+			prepare: func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") },
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name: "No_credentials",
+			cfg:  AuthConfig{Token: "secret"},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:          "Basic",
+			cfg:           AuthConfig{Basic: []BasicAuthUser{{User: "alice", PasswordHash: hash}}},
+			prepare:       func(r *http.Request) { r.SetBasicAuth("alice", "pass") },
+			want:          http.StatusOK,
+			wantPrincipal: "user alice",
+		},
+		{
+			name:    "Basic_wrong_password",
+			cfg:     AuthConfig{Basic: []BasicAuthUser{{User: "alice", PasswordHash: hash}}},
+			prepare: func(r *http.Request) { r.SetBasicAuth("alice", "guess") },
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:    "Basic_unknown_user",
+			cfg:     AuthConfig{Basic: []BasicAuthUser{{User: "alice", PasswordHash: hash}}},
+			prepare: func(r *http.Request) { r.SetBasicAuth("bob", "pass") },
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:          "Basic_or_token",
+			cfg:           AuthConfig{Token: "secret", Basic: []BasicAuthUser{{User: "alice", PasswordHash: hash}}},
+			prepare:       func(r *http.Request) { r.SetBasicAuth("alice", "pass") },
+			want:          http.StatusOK,
+			wantPrincipal: "user alice",
+		},
+		{
+			name: "Client_certificate_subject",
+			cfg:  AuthConfig{ClientCertSubjects: []string{"CN=ops,O=example"}},
+			prepare: func(r *http.Request) {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+			},
+			want:          http.StatusOK,
+			wantPrincipal: "certificate CN=ops,O=example",
+		},
+		{
+			name: "Client_certificate_common_name",
+			cfg:  AuthConfig{ClientCertSubjects: []string{"ops"}},
+			prepare: func(r *http.Request) {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+			},
+			want:          http.StatusOK,
+			wantPrincipal: "certificate CN=ops,O=example",
+		},
+		{
+			name: "Client_certificate_not_verified",
+			cfg:  AuthConfig{ClientCertSubjects: []string{"ops"}},
+			prepare: func(r *http.Request) {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "Client_certificate_other_subject",
+			cfg:  AuthConfig{ClientCertSubjects: []string{"admin"}},
+			prepare: func(r *http.Request) {
+				r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+			},
+			want: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var auth *Auth
+
+			if tt.name != "Open" {
+				var err error
+				if auth, err = NewAuth(tt.cfg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := httptest.NewRequest("GET", "/admin/restart", nil)
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(r)
+			}
+
+			var principal string
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				principal = requestPrincipal(r)
+				testGetHandler().ServeHTTP(w, r)
+			}
+
+			rr := httptest.NewRecorder()
+			AuthMiddleware(auth)(http.HandlerFunc(handler)).ServeHTTP(rr, r)
+
+			if rr.Code != tt.want {
+				t.Errorf("expected the status code %d, got %d", tt.want, rr.Code)
+			}
+
+			if principal != tt.wantPrincipal {
+				t.Errorf("expected the principal %q, got %q", tt.wantPrincipal, principal)
+			}
+
+			if rr.Code == http.StatusUnauthorized && len(tt.cfg.Basic) > 0 && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+// writeTestCertificate writes a certificate signed by parent, or a self
+// signed one if parent is nil, and its key in dir.
+func writeTestCertificate(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	if err := os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// writeTestPKI writes in a temporary directory a certificate authority,
+// ca.crt, and the certificates it signed: server.crt for 127.0.0.1 and
+// client.crt with the common name ops, with their keys.
+func writeTestPKI(t *testing.T) (string, *x509.Certificate) {
+	t.Helper()
+
+	dir := t.TempDir()
+	notAfter := time.Now().Add(time.Hour)
+
+	ca, caKey := writeTestCertificate(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	writeTestCertificate(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotAfter:     notAfter,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	writeTestCertificate(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "ops"},
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	return dir, ca
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	dir, ca := writeTestPKI(t)
+
+	cfg, err := NewTLSConfig(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatalf("NewTLSConfig() error = %v", err)
+	}
+
+	auth, err := NewAuth(AuthConfig{ClientCertSubjects: []string{"ops"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(AuthMiddleware(auth)(testGetHandler()))
+	ts.TLS = cfg
+	ts.StartTLS()
+
+	defer ts.Close()
+
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	for name, certificates := range map[string][]tls.Certificate{"with_certificate": {clientCert}, "without_certificate": nil} {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			Certificates: certificates,
+			MinVersion:   tls.VersionTLS12,
+			RootCAs:      roots,
+		}}}
+
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		_ = resp.Body.Close()
+
+		want := http.StatusOK
+		if certificates == nil {
+			want = http.StatusUnauthorized
+		}
+
+		if resp.StatusCode != want {
+			t.Errorf("%s: expected the status code %d, got %d", name, want, resp.StatusCode)
+		}
+	}
+
+	if _, err := NewTLSConfig(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "server.key")); err == nil {
+		t.Errorf("NewTLSConfig() expected an error without authorities")
+	}
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// names of the services exposed by the grpc health server, they
+// report the same state of the /alive, /ready and /startup endpoints.
+const (
+	GRPCServiceLiveness  = "liveness"
+	GRPCServiceReadiness = "readiness"
+	GRPCServiceStartup   = "startup"
+)
+
+type ServerOption func(*server)
+
+// WithGRPCAddress enables the grpc health server, listening on addr
+// next to the http server.
+func WithGRPCAddress(addr string) ServerOption {
+	return func(s *server) {
+		s.grpcAddress = addr
+	}
+}
+
+func servingStatus(isServing bool) healthpb.HealthCheckResponse_ServingStatus {
+	if isServing {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// newGRPCServer creates the grpc server exposing the health service,
+// all the services are NOT_SERVING until their state is updated. The
+// server uses the TLS configuration of the http server, and the calls
+// are authenticated like the probes endpoints.
+func (s *server) newGRPCServer() {
+	s.grpcHealth = grpchealth.NewServer()
+
+	for _, service := range []string{GRPCServiceLiveness, GRPCServiceReadiness, GRPCServiceStartup} {
+		s.grpcHealth.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.authenticateGRPC(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authenticateGRPC(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+
+			return handler(srv, ss)
+		}),
+	}
+
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+
+	s.grpcServer = grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(s.grpcServer, s.grpcHealth)
+}
+
+// authenticateGRPC refuses the grpc calls not allowed by the
+// authentication of the probes: the address of the peer, the bearer
+// token or the basic auth user in the authorization metadata, and the
+// verified client certificate are checked like on the http server.
+func (s *server) authenticateGRPC(ctx context.Context, method string) error {
+	auth := s.auth[RouteGroupProbes]
+	if auth == nil {
+		return nil
+	}
+
+	var c clientRequest
+
+	if p, ok := peer.FromContext(ctx); ok {
+		c.remoteAddr = p.Addr.String()
+
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			c.tls = &info.State
+		}
+	}
+
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		c.authorization = values[0]
+	}
+
+	if !auth.isAllowed(c) {
+		logger.Warnf("refused the grpc call %s from %s", method, c.remoteAddr)
+		logger.Debugf("refused the grpc call %s from %s: the address is not allowed", method, c.remoteAddr)
+
+		return status.Error(codes.PermissionDenied, "the address is not allowed")
+	}
+
+	if !auth.hasCredentials() {
+		return nil
+	}
+
+	if _, ok, reason := auth.isAuthenticated(c); !ok {
+		logger.Warnf("refused the grpc call %s from %s", method, c.remoteAddr)
+		logger.Debugf("refused the grpc call %s from %s: %s", method, c.remoteAddr, reason)
+
+		return status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+
+	return nil
+}
+
+// setServingStatus updates the state of a service of the grpc health
+// server, the clients watching the service are notified of the change.
+func (s *server) setServingStatus(service string, isServing bool) {
+	if s.grpcHealth == nil {
+		return
+	}
+
+	s.grpcHealth.SetServingStatus(service, servingStatus(isServing))
+}
+
+func (s *server) startGRPC(serverError chan<- error) {
+	listener, err := net.Listen("tcp", s.grpcAddress)
+	if err != nil {
+		logger.Errorf("cannot bind grpc server on %s: %s", s.grpcAddress, err)
+		serverError <- err
+
+		return
+	}
+
+	logger.Infof("starting grpc server on %s...", listener.Addr())
+
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			logger.Errorf("grpc server on %s ended: %s", s.grpcAddress, err)
+		}
+	}()
+}
+
+var grpcServerShutdown = func(grpcServer *grpc.Server, grpcHealth *grpchealth.Server) {
+	logger.Infof("shutting down the grpc server...")
+
+	// notify the clients watching the services before closing the
+	// streams, the watch streams never end by themselves, so the
+	// server is stopped without waiting for them
+	grpcHealth.Shutdown()
+	grpcServer.Stop()
+
+	logger.Infof("grpc server shutdown complete...")
+}
@@ -0,0 +1,355 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+// startTestGRPCServer serves the grpc health server of s on a random
+// port, and returns a client connected to it, without TLS unless the
+// credentials are given.
+func startTestGRPCServer(t *testing.T, s *server, opts ...grpc.DialOption) healthpb.HealthClient {
+	t.Helper()
+
+	s.newGRPCServer()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = s.grpcServer.Serve(listener)
+	}()
+
+	t.Cleanup(s.grpcServer.Stop)
+
+	if len(opts) == 0 {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+
+	conn, err := grpc.Dial(listener.Addr().String(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func Test_server_grpc_Check(t *testing.T) {
+	s := &server{}
+	client := startTestGRPCServer(t, s)
+
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		rsp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%s): no error was expected, got %s", service, err)
+		}
+
+		return rsp.GetStatus()
+	}
+
+	tests := []struct {
+		name      string
+		isAlive   bool
+		isReady   bool
+		isStarted bool
+	}{
+		{name: "Initial_state"},
+		{name: "Started", isStarted: true},
+		{name: "Alive", isAlive: true, isStarted: true},
+		{name: "Ready", isAlive: true, isReady: true, isStarted: true},
+		{name: "Not_alive", isReady: true, isStarted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name != "Initial_state" {
+				s.setAlive(tt.isAlive)
+				s.setReady(tt.isReady)
+				s.setStarted(tt.isStarted)
+			}
+
+			if got, want := check(GRPCServiceLiveness), servingStatus(tt.isAlive); got != want {
+				t.Errorf("%s: expected %s, got %s", GRPCServiceLiveness, want, got)
+			}
+
+			if got, want := check(GRPCServiceReadiness), servingStatus(tt.isReady); got != want {
+				t.Errorf("%s: expected %s, got %s", GRPCServiceReadiness, want, got)
+			}
+
+			if got, want := check(GRPCServiceStartup), servingStatus(tt.isStarted); got != want {
+				t.Errorf("%s: expected %s, got %s", GRPCServiceStartup, want, got)
+			}
+		})
+	}
+
+	t.Run("Unknown_service", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("expected the %s error code, got %v", codes.NotFound, err)
+		}
+	})
+}
+
+func Test_server_grpc_Watch(t *testing.T) {
+	s := &server{}
+	client := startTestGRPCServer(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: GRPCServiceReadiness})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() healthpb.HealthCheckResponse_ServingStatus {
+		t.Helper()
+
+		rsp, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv: no error was expected, got %s", err)
+		}
+
+		return rsp.GetStatus()
+	}
+
+	if got := next(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected %s, got %s", healthpb.HealthCheckResponse_NOT_SERVING, got)
+	}
+
+	s.setReady(true)
+
+	if got := next(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected %s, got %s", healthpb.HealthCheckResponse_SERVING, got)
+	}
+
+	// the changes of other services are not streamed
+	s.setAlive(true)
+	s.setReady(false)
+
+	if got := next(); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("expected %s, got %s", healthpb.HealthCheckResponse_NOT_SERVING, got)
+	}
+
+	s.setReady(true)
+
+	if got := next(); got != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected %s, got %s", healthpb.HealthCheckResponse_SERVING, got)
+	}
+
+	// the stream is closed when the server shuts down
+	grpcServerShutdown(s.grpcServer, s.grpcHealth)
+
+	for {
+		rsp, err := stream.Recv()
+		if err != nil {
+			break
+		}
+
+		if rsp.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("expected %s, got %s", healthpb.HealthCheckResponse_NOT_SERVING, rsp.GetStatus())
+		}
+	}
+}
+
+func Test_server_grpc_Auth(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	hash := testPasswordHash(t, "pass")
+
+	tests := []struct {
+		name          string
+		cfg           AuthConfig
+		authorization string
+		want          codes.Code
+	}{
+		{
+			name: "Allowed_address",
+			cfg:  AuthConfig{Allow: []string{"127.0.0.0/8"}},
+			want: codes.OK,
+		},
+		{
+			name: "Refused_address",
+			cfg:  AuthConfig{Allow: []string{"10.0.0.0/8"}},
+			want: codes.PermissionDenied,
+		},
+		{
+			name:          "Token",
+			cfg:           AuthConfig{Token: "secret"},
+			authorization: "Bearer secret",
+			want:          codes.OK,
+		},
+		{
+			name:          "Wrong_token",
+			cfg:           AuthConfig{Token: "secret"},
+			authorization: "Bearer guess",
+			want:          codes.Unauthenticated,
+		},
+		{
+			name: "No_credentials",
+			cfg:  AuthConfig{Token: "secret"},
+			want: codes.Unauthenticated,
+		},
+		{
+			name:          "Basic",
+			cfg:           AuthConfig{Basic: []BasicAuthUser{{User: "alice", PasswordHash: hash}}},
+			authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:pass")),
+			want:          codes.OK,
+		},
+		{
+			name:          "Basic_wrong_password",
+			cfg:           AuthConfig{Basic: []BasicAuthUser{{User: "alice", PasswordHash: hash}}},
+			authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:guess")),
+			want:          codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := NewAuth(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &server{auth: map[RouteGroup]*Auth{RouteGroupProbes: auth}}
+			client := startTestGRPCServer(t, s)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+			defer cancel()
+
+			if tt.authorization != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.authorization)
+			}
+
+			_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: GRPCServiceLiveness})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Check: expected the %s code, got %s", tt.want, got)
+			}
+
+			// the streams are authenticated too
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: GRPCServiceLiveness})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("Watch: expected the %s code, got %s", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Client_certificate", func(t *testing.T) {
+		dir, ca := writeTestPKI(t)
+
+		cfg, err := NewTLSConfig(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		auth, err := NewAuth(AuthConfig{ClientCertSubjects: []string{"ops"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+
+		for name, certificates := range map[string][]tls.Certificate{"with_certificate": {clientCert}, "without_certificate": nil} {
+			s := &server{auth: map[RouteGroup]*Auth{RouteGroupProbes: auth}, tlsConfig: cfg}
+			client := startTestGRPCServer(t, s, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+				Certificates: certificates,
+				MinVersion:   tls.VersionTLS12,
+				RootCAs:      roots,
+			})))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: GRPCServiceLiveness})
+
+			cancel()
+
+			want := codes.OK
+			if certificates == nil {
+				want = codes.Unauthenticated
+			}
+
+			if got := status.Code(err); got != want {
+				t.Errorf("%s: expected the %s code, got %s (%v)", name, want, got, err)
+			}
+		}
+	})
+}
+
+func Test_server_Start_GRPC(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	tests := []struct {
+		name string
+		addr string
+	}{
+		{name: "GRPC_address_in_use", addr: "127.0.0.1:0"},
+		{name: "Both_addresses_in_use", addr: listener.Addr().String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the address of the grpc server is already in use
+			s := NewServer(tt.addr, 1*time.Second, 0, WithGRPCAddress(listener.Addr().String()))
+
+			_, _, serverDone := s.Start(context.Background())
+
+			select {
+			case <-serverDone:
+			case <-time.After(1 * time.Second):
+				t.Errorf("the server was expected to end")
+			}
+
+			// let the http server report its error too
+			time.Sleep(100 * time.Millisecond)
+		})
+	}
+}
@@ -3,21 +3,37 @@ package http
 import (
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
 )
 
 func writeToResponse(handler string, status int, w http.ResponseWriter) {
+	writeTextToResponse(handler, status, http.StatusText(status), w)
+}
+
+func writeTextToResponse(handler string, status int, text string, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(status)
 
-	if _, err := io.WriteString(w, http.StatusText(status)); err != nil {
+	if _, err := io.WriteString(w, text); err != nil {
 		logger.Errorf("cannot write response from %s handler: %s", handler, err)
 		return
 	}
 }
 
 func (s *server) ReadyHandler(w http.ResponseWriter, _ *http.Request) {
+	if maintenance := s.MaintenanceStatus(); maintenance.Enabled {
+		text := "maintenance"
+		if maintenance.Reason != "" {
+			text += ": " + maintenance.Reason
+		}
+
+		writeTextToResponse("/ready", http.StatusServiceUnavailable, text, w)
+
+		return
+	}
+
 	status := http.StatusOK
 
 	isReady := s.IsReady()
@@ -28,6 +44,30 @@ func (s *server) ReadyHandler(w http.ResponseWriter, _ *http.Request) {
 	writeToResponse("/ready", status, w)
 }
 
+// ReadySetHandler is called by the wrapped process to declare itself
+// ready.
+func (s *server) ReadySetHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPingToken("/ready/set", w, r) {
+		return
+	}
+
+	s.childReady <- true
+
+	writeToResponse("/ready/set", http.StatusOK, w)
+}
+
+// ReadyUnsetHandler is called by the wrapped process to declare itself
+// not ready, e.g. while it's warming its caches.
+func (s *server) ReadyUnsetHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPingToken("/ready/unset", w, r) {
+		return
+	}
+
+	s.childReady <- false
+
+	writeToResponse("/ready/unset", http.StatusOK, w)
+}
+
 func (s *server) AliveHandler(w http.ResponseWriter, _ *http.Request) {
 	status := http.StatusOK
 
@@ -39,12 +79,73 @@ func (s *server) AliveHandler(w http.ResponseWriter, _ *http.Request) {
 	writeToResponse("/alive", status, w)
 }
 
-func (s *server) PingHandler(w http.ResponseWriter, _ *http.Request) {
+func (s *server) StartupHandler(w http.ResponseWriter, _ *http.Request) {
+	status := http.StatusOK
+
+	isStarted := s.IsStarted()
+	if !isStarted {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeToResponse("/startup", status, w)
+}
+
+func (s *server) PingHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPingToken("/ping", w, r) {
+		return
+	}
+
+	value, hasProgress, err := parseProgress(r)
+	if err != nil {
+		logger.Warnf("ignoring a ping: %s", err)
+		writeToResponse("/ping", http.StatusBadRequest, w)
+
+		return
+	}
+
 	s.pingChannel <- true
 
+	if hasProgress {
+		s.progress <- value
+	}
+
 	writeToResponse("/ping", http.StatusOK, w)
 }
 
+// NamedPingHandler pings the named heartbeat in the path, like
+// /ping/{name}; the unknown heartbeats are not found.
+func (s *server) NamedPingHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkPingToken("/ping/{name}", w, r) {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/ping/")
+
+	if _, ok := s.heartbeats[name]; !ok {
+		writeToResponse("/ping/{name}", http.StatusNotFound, w)
+		return
+	}
+
+	s.namedPing <- name
+
+	writeToResponse("/ping/{name}", http.StatusOK, w)
+}
+
+// MaintenanceHandler enables or disables the maintenance mode.
+func (s *server) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := parseMaintenance(r)
+	if err != nil {
+		logger.Warnf("ignoring a maintenance request: %s", err)
+		writeToResponse("/admin/maintenance", http.StatusBadRequest, w)
+
+		return
+	}
+
+	s.updateMaintenance <- status
+
+	writeToResponse("/admin/maintenance", http.StatusOK, w)
+}
+
 func RootHandler(w http.ResponseWriter, _ *http.Request) {
 	writeToResponse("/*", http.StatusNotFound, w)
 }
@@ -129,6 +129,55 @@ func Test_server_AliveHandler(t *testing.T) {
 	}
 }
 
+func Test_server_StartupHandler(t *testing.T) {
+	type fields struct {
+		isStarted bool
+	}
+	type args struct {
+		method string
+		path   string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   int
+	}{
+		{
+			name:   "StartupHandler_IsStarted",
+			fields: fields{isStarted: true},
+			args:   args{method: "GET", path: "/startup"},
+			want:   http.StatusOK,
+		},
+		{
+			name:   "StartupHandler_IsNotStarted",
+			fields: fields{isStarted: false},
+			args:   args{method: "GET", path: "/startup"},
+			want:   http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{
+				isStarted: tt.fields.isStarted,
+			}
+
+			req, err := http.NewRequest(tt.args.method, tt.args.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(s.StartupHandler)
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.want {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tt.want)
+			}
+		})
+	}
+}
+
 func Test_server_PingHandler(t *testing.T) {
 	type fields struct {
 		externalAlive chan bool
@@ -0,0 +1,262 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// CheckStatus is the state of one of the checks contributing to the
+// liveness or the readiness, as reported by /livez and /readyz.
+type CheckStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Reason explains why the check is failing, it's empty if the
+	// check is healthy.
+	Reason string `json:"reason,omitempty"`
+}
+
+func newCheckStatus(name string, isHealthy bool, reason string) CheckStatus {
+	if isHealthy {
+		return CheckStatus{Name: name, Healthy: true}
+	}
+
+	return CheckStatus{Name: name, Reason: reason}
+}
+
+// checksPassed returns true if all the checks are healthy.
+func checksPassed(checks []CheckStatus) bool {
+	for _, check := range checks {
+		if !check.Healthy {
+			return false
+		}
+	}
+
+	return true
+}
+
+// healthChecksStatus returns the state of the health checks with the
+// given target, sorted by name.
+func healthChecksStatus(checks map[string]health.Result, target health.Target) []CheckStatus {
+	list := make([]CheckStatus, 0, len(checks))
+
+	for _, result := range checks {
+		if result.Target != target {
+			continue
+		}
+
+		reason := "unhealthy"
+
+		switch {
+		case result.Err != nil:
+			reason = result.Err.Error()
+		case !result.Probed:
+			reason = "not probed yet"
+		}
+
+		list = append(list, newCheckStatus("check:"+result.Name, result.Healthy, reason))
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// heartbeatsChecksStatus returns the state of the required heartbeats,
+// sorted by name.
+func heartbeatsChecksStatus(timers map[string]*heartbeatTimer) []CheckStatus {
+	list := make([]CheckStatus, 0, len(timers))
+
+	for _, h := range timers {
+		if !h.required {
+			continue
+		}
+
+		reason := fmt.Sprintf("not pinged within %s", h.timeout)
+		list = append(list, newCheckStatus("heartbeat:"+h.name, !h.expired, reason))
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// healthzReport is the JSON document returned by /livez and /readyz.
+type healthzReport struct {
+	Status   string        `json:"status"`
+	Checks   []CheckStatus `json:"checks"`
+	Excluded []string      `json:"excluded,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+}
+
+// newHealthzReport applies the exclusions of the request to the checks.
+func newHealthzReport(checks []CheckStatus, exclude []string) healthzReport {
+	report := healthzReport{Checks: make([]CheckStatus, 0, len(checks))}
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		excluded[name] = false
+	}
+
+	for _, check := range checks {
+		if _, ok := excluded[check.Name]; ok {
+			excluded[check.Name] = true
+			report.Excluded = append(report.Excluded, check.Name)
+
+			continue
+		}
+
+		report.Checks = append(report.Checks, check)
+	}
+
+	var unmatched []string
+
+	for _, name := range exclude {
+		if !excluded[name] {
+			unmatched = append(unmatched, fmt.Sprintf("%q", name))
+			// the same name is reported only once
+			excluded[name] = true
+		}
+	}
+
+	if len(unmatched) > 0 {
+		report.Warnings = append(report.Warnings,
+			"some health checks cannot be excluded: no matches for "+strings.Join(unmatched, ","))
+	}
+
+	report.Status = "ok"
+	if !checksPassed(report.Checks) {
+		report.Status = "failed"
+	}
+
+	return report
+}
+
+// text renders the report like the kube-apiserver: the checks are
+// listed only if they are failing, there are warnings or the request
+// is verbose.
+func (r healthzReport) text(endpoint string, isVerbose bool) string {
+	if r.Status == "ok" && len(r.Warnings) == 0 && !isVerbose {
+		return "ok"
+	}
+
+	var b strings.Builder
+
+	for _, check := range r.Checks {
+		if check.Healthy {
+			fmt.Fprintf(&b, "[+]%s ok\n", check.Name)
+		} else {
+			fmt.Fprintf(&b, "[-]%s failed: %s\n", check.Name, check.Reason)
+		}
+	}
+
+	for _, name := range r.Excluded {
+		fmt.Fprintf(&b, "[+]%s excluded: ok\n", name)
+	}
+
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&b, "warn: %s\n", warning)
+	}
+
+	result := "passed"
+	if r.Status != "ok" {
+		result = "failed"
+	}
+
+	fmt.Fprintf(&b, "%s check %s", strings.TrimPrefix(endpoint, "/"), result)
+
+	return b.String()
+}
+
+func writeHealthzToResponse(endpoint string, checks []CheckStatus, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	report := newHealthzReport(checks, query["exclude"])
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeTextToResponse(endpoint, status, report.text(endpoint, query.Has("verbose")), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logger.Errorf("cannot write response from %s handler: %s", endpoint, err)
+	}
+}
+
+// LivezHandler reports the checks contributing to the liveness.
+func (s *server) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthzToResponse("/livez", s.Liveness(), w, r)
+}
+
+// ReadyzHandler reports the checks contributing to the readiness.
+func (s *server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthzToResponse("/readyz", s.Readiness(), w, r)
+}
+
+func (s *server) setLiveness(checks []CheckStatus) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	isAlive := checksPassed(checks)
+	if isAlive != s.isAlive {
+		state := "alive"
+		if !isAlive {
+			state = "not alive"
+		}
+
+		s.addTransition("liveness", state, failedReasons(checks))
+	}
+
+	s.liveness = checks
+	s.isAlive = isAlive
+	s.setServingStatus(GRPCServiceLiveness, s.isAlive)
+}
+
+// Liveness returns the state of the checks contributing to the
+// liveness.
+func (s *server) Liveness() []CheckStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]CheckStatus(nil), s.liveness...)
+}
+
+func (s *server) setReadiness(checks []CheckStatus) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	isReady := checksPassed(checks)
+	if isReady != s.isReady {
+		state := "ready"
+		if !isReady {
+			state = "not ready"
+		}
+
+		s.addTransition("readiness", state, failedReasons(checks))
+	}
+
+	s.readinessChecks = checks
+	s.isReady = isReady
+	s.setServingStatus(GRPCServiceReadiness, s.isReady)
+}
+
+// Readiness returns the state of the checks contributing to the
+// readiness.
+func (s *server) Readiness() []CheckStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]CheckStatus(nil), s.readinessChecks...)
+}
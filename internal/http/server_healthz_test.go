@@ -0,0 +1,257 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func Test_healthChecksStatus(t *testing.T) {
+	checks := map[string]health.Result{
+		"web":   {Name: "web", Target: health.TargetReady, Healthy: false, Err: errors.New("connection refused"), Probed: true},
+		"db":    {Name: "db", Target: health.TargetReady, Healthy: false},
+		"cache": {Name: "cache", Target: health.TargetReady, Healthy: false, Probed: true},
+		"disk":  {Name: "disk", Target: health.TargetAlive, Healthy: true, Probed: true},
+	}
+
+	want := []CheckStatus{
+		{Name: "check:cache", Reason: "unhealthy"},
+		{Name: "check:db", Reason: "not probed yet"},
+		{Name: "check:web", Reason: "connection refused"},
+	}
+
+	if got := healthChecksStatus(checks, health.TargetReady); !reflect.DeepEqual(got, want) {
+		t.Errorf("healthChecksStatus() = %+v, want %+v", got, want)
+	}
+
+	want = []CheckStatus{{Name: "check:disk", Healthy: true}}
+
+	if got := healthChecksStatus(checks, health.TargetAlive); !reflect.DeepEqual(got, want) {
+		t.Errorf("healthChecksStatus() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_server_LivezHandler(t *testing.T) {
+	healthy := []CheckStatus{
+		{Name: "process", Healthy: true},
+		{Name: "ping", Healthy: true},
+	}
+
+	failed := []CheckStatus{
+		{Name: "process", Healthy: true},
+		{Name: "ping", Reason: "no ping received within 10s"},
+	}
+
+	tests := []struct {
+		name       string
+		liveness   []CheckStatus
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "Healthy",
+			liveness:   healthy,
+			path:       "/livez",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "Healthy_verbose",
+			liveness:   healthy,
+			path:       "/livez?verbose",
+			wantStatus: http.StatusOK,
+			wantBody:   "[+]process ok\n[+]ping ok\nlivez check passed",
+		},
+		{
+			name:       "Failed",
+			liveness:   failed,
+			path:       "/livez",
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "[+]process ok\n[-]ping failed: no ping received within 10s\nlivez check failed",
+		},
+		{
+			name:       "Failed_excluded",
+			liveness:   failed,
+			path:       "/livez?exclude=ping",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "Failed_excluded_verbose",
+			liveness:   failed,
+			path:       "/livez?exclude=ping&verbose",
+			wantStatus: http.StatusOK,
+			wantBody:   "[+]process ok\n[+]ping excluded: ok\nlivez check passed",
+		},
+		{
+			name:       "Unknown_excluded",
+			liveness:   failed,
+			path:       "/livez?exclude=ping&exclude=unknown&exclude=unknown",
+			wantStatus: http.StatusOK,
+			wantBody:   "[+]process ok\n[+]ping excluded: ok\nwarn: some health checks cannot be excluded: no matches for \"unknown\"\nlivez check passed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{liveness: tt.liveness}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.LivezHandler).ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantStatus)
+			}
+
+			if body := rr.Body.String(); body != tt.wantBody {
+				t.Errorf("handler returned wrong body: got %q want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_server_ReadyzHandler_JSON(t *testing.T) {
+	s := &server{readinessChecks: []CheckStatus{
+		{Name: "server", Healthy: true},
+		{Name: "maintenance", Reason: "enabled by alice: upgrade"},
+		{Name: "check:web", Reason: "connection refused"},
+	}}
+
+	req := httptest.NewRequest("GET", "/readyz?exclude=check:web", nil)
+	req.Header.Set("Accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.ReadyzHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("handler returned wrong content type: %q", contentType)
+	}
+
+	var got healthzReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := healthzReport{
+		Status: "failed",
+		Checks: []CheckStatus{
+			{Name: "server", Healthy: true},
+			{Name: "maintenance", Reason: "enabled by alice: upgrade"},
+		},
+		Excluded: []string{"check:web"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("handler returned %+v, want %+v", got, want)
+	}
+}
+
+func Test_server_do_Healthz(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		childReady:        make(chan bool),
+		events:            make(chan ServerEvent, 1),
+		externalAlive:     make(chan bool),
+		maintenance:       make(chan bool, 1),
+		pingChannel:       make(chan bool),
+		updateCheck:       make(chan health.Result),
+		updateMaintenance: make(chan MaintenanceStatus),
+		updateProcess:     make(chan ProcessState),
+		updateReady:       make(chan bool),
+	}
+
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	// every update is sent twice, to wait for the first one to be handled
+	s.updateReady <- true
+	s.updateReady <- true
+
+	wantLiveness := []CheckStatus{
+		{Name: "process", Reason: "the wrapped process is not running"},
+		{Name: "ping", Healthy: true},
+	}
+
+	if got := s.Liveness(); !reflect.DeepEqual(got, wantLiveness) {
+		t.Errorf("before start: expected the liveness %+v, got %+v", wantLiveness, got)
+	}
+
+	s.externalAlive <- true
+	s.externalAlive <- true
+
+	result := health.Result{Name: "web", Target: health.TargetReady, Err: errors.New("connection refused"), Probed: true}
+	s.updateCheck <- result
+	s.updateCheck <- result
+
+	maintenance := MaintenanceStatus{Enabled: true, Reason: "upgrade", EnabledBy: "alice"}
+	s.updateMaintenance <- maintenance
+	s.updateMaintenance <- maintenance
+
+	wantLiveness[0] = CheckStatus{Name: "process", Healthy: true}
+
+	if got := s.Liveness(); !reflect.DeepEqual(got, wantLiveness) {
+		t.Errorf("expected the liveness %+v, got %+v", wantLiveness, got)
+	}
+
+	if !s.IsAlive() {
+		t.Errorf("the server must be alive")
+	}
+
+	wantReadiness := []CheckStatus{
+		{Name: "server", Healthy: true},
+		{Name: "child", Healthy: true},
+		{Name: "maintenance", Reason: "enabled by alice: upgrade"},
+		{Name: "check:web", Reason: "connection refused"},
+	}
+
+	if got := s.Readiness(); !reflect.DeepEqual(got, wantReadiness) {
+		t.Errorf("expected the readiness %+v, got %+v", wantReadiness, got)
+	}
+
+	if s.IsReady() {
+		t.Errorf("the server must not be ready")
+	}
+
+	// the readiness follows the checks
+	result.Healthy, result.Err = true, nil
+	s.updateCheck <- result
+	s.updateCheck <- result
+	s.updateMaintenance <- MaintenanceStatus{}
+	s.updateMaintenance <- MaintenanceStatus{}
+
+	if !checksPassed(s.Readiness()) || !s.IsReady() {
+		t.Errorf("the server must be ready, got %+v", s.Readiness())
+	}
+
+	cancel()
+	<-serverDone
+
+	if s.IsReady() || checksPassed(s.Readiness()) {
+		t.Errorf("the server must not be ready after the shutdown, got %+v", s.Readiness())
+	}
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// defaultHeartbeatFileInterval is used when the interval of the
+// heartbeat file is not positive.
+const defaultHeartbeatFileInterval = 1 * time.Second
+
+// heartbeatFile is a file touched by the wrapped process as a
+// heartbeat, every change of its mtime is handled like a ping.
+type heartbeatFile struct {
+	interval  time.Duration
+	modTime   time.Time
+	mustExist bool
+	path      string
+}
+
+// WithHeartbeatFile enables the heartbeat file in path, its mtime is
+// checked every interval. If mustExist is true, the process is not
+// alive while the file is missing.
+func WithHeartbeatFile(path string, mustExist bool, interval time.Duration) ServerOption {
+	if interval <= 0 {
+		interval = defaultHeartbeatFileInterval
+	}
+
+	return func(s *server) {
+		s.heartbeatFile = &heartbeatFile{
+			interval:  interval,
+			mustExist: mustExist,
+			path:      path,
+		}
+	}
+}
+
+// check returns true if the file was touched since the last check,
+// and within the ping timeout, and if the file is missing.
+func (h *heartbeatFile) check(pingInterval time.Duration) (isTouched, isMissing bool) {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Warnf("cannot read the heartbeat file %s: %s", h.path, err)
+		}
+
+		return false, true
+	}
+
+	if !info.ModTime().After(h.modTime) {
+		return false, false
+	}
+
+	h.modTime = info.ModTime()
+
+	// a file touched before the ping timeout is not a heartbeat, e.g.
+	// it's left by a previous execution
+	if pingInterval > 0 && time.Since(h.modTime) > pingInterval {
+		return false, false
+	}
+
+	return true, false
+}
@@ -0,0 +1,134 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_heartbeatFile_check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "heartbeat")
+	h := &heartbeatFile{path: path}
+
+	touch := func(modTime time.Time) {
+		t.Helper()
+
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		prepare     func()
+		wantTouched bool
+		wantMissing bool
+	}{
+		{name: "missing", prepare: func() {}, wantMissing: true},
+		{name: "stale", prepare: func() { touch(now.Add(-1 * time.Hour)) }},
+		{name: "touched", prepare: func() { touch(now) }, wantTouched: true},
+		{name: "not_touched_again", prepare: func() {}},
+		{name: "touched_again", prepare: func() { touch(now.Add(1 * time.Second)) }, wantTouched: true},
+		{name: "removed", prepare: func() { _ = os.Remove(path) }, wantMissing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare()
+
+			isTouched, isMissing := h.check(1 * time.Minute)
+			if isTouched != tt.wantTouched {
+				t.Errorf("check() isTouched = %v, want %v", isTouched, tt.wantTouched)
+			}
+
+			if isMissing != tt.wantMissing {
+				t.Errorf("check() isMissing = %v, want %v", isMissing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func Test_server_do_HeartbeatFile(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	for _, mustExist := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "heartbeat")
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		s := &server{
+			events:        make(chan ServerEvent, 1),
+			externalAlive: make(chan bool),
+			pingChannel:   make(chan bool),
+			pingInterval:  200 * time.Millisecond,
+			updateProcess: make(chan ProcessState),
+			updateReady:   make(chan bool),
+		}
+		WithHeartbeatFile(path, mustExist, 10*time.Millisecond)(s)
+
+		serverError := make(chan error)
+		serverDone := make(chan struct{})
+		go s.do(ctx, serverError, serverDone)
+
+		s.externalAlive <- true
+
+		// the file is touched before the ping timeout
+		for i := 0; i < 5; i++ {
+			if err := os.WriteFile(path, []byte(time.Now().String()), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			if !s.IsAlive() {
+				t.Errorf("must exist %v: isAlive must be true while the file is touched", mustExist)
+			}
+		}
+
+		// the heartbeat is a startup signal
+		select {
+		case event := <-s.Events():
+			if event != ServerEventStartupSignal {
+				t.Errorf("must exist %v: expected event %v, got %v", mustExist, ServerEventStartupSignal, event)
+			}
+		default:
+			t.Errorf("must exist %v: expected a startup signal event", mustExist)
+		}
+
+		// the http pings share the same timeout
+		s.pingChannel <- true
+
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		if s.IsAlive() == mustExist {
+			t.Errorf("must exist %v: isAlive expected %v after the file is removed, got %v", mustExist, !mustExist, s.IsAlive())
+		}
+
+		time.Sleep(200 * time.Millisecond)
+
+		if s.IsAlive() {
+			t.Errorf("must exist %v: isAlive must be false after the ping timeout", mustExist)
+		}
+
+		cancel()
+		<-serverDone
+	}
+}
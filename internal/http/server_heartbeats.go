@@ -0,0 +1,162 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidHeartbeat = errors.New("invalid heartbeat")
+
+// HeartbeatConfig is the configuration of a named heartbeat, the
+// wrapped process pings it on /ping/{name}.
+type HeartbeatConfig struct {
+	Name     string        `mapstructure:"name"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Optional bool          `mapstructure:"optional"`
+}
+
+// Heartbeat is a named heartbeat, with its own timeout: the wrapped
+// process is not alive if a required heartbeat is not pinged within
+// its timeout.
+type Heartbeat struct {
+	name     string
+	required bool
+	timeout  time.Duration
+}
+
+// HeartbeatStatus is the state of a named heartbeat, LastSeen is zero
+// if the heartbeat was never pinged.
+type HeartbeatStatus struct {
+	Name     string
+	Required bool
+	Timeout  time.Duration
+	LastSeen time.Time
+	Expired  bool
+}
+
+// NewHeartbeat validates the configuration of a named heartbeat.
+func NewHeartbeat(cfg HeartbeatConfig) (*Heartbeat, error) {
+	if cfg.Name == "" || strings.ContainsAny(cfg.Name, "/?#") {
+		return nil, fmt.Errorf("%w: the name %q is not valid", ErrInvalidHeartbeat, cfg.Name)
+	}
+
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("%w: %s: the timeout must be positive", ErrInvalidHeartbeat, cfg.Name)
+	}
+
+	return &Heartbeat{
+		name:     cfg.Name,
+		required: !cfg.Optional,
+		timeout:  cfg.Timeout,
+	}, nil
+}
+
+// Name returns the name of the heartbeat.
+func (h *Heartbeat) Name() string {
+	return h.name
+}
+
+// WithHeartbeats enables the named heartbeats, pinged on /ping/{name}.
+func WithHeartbeats(list ...*Heartbeat) ServerOption {
+	return func(s *server) {
+		s.heartbeats = make(map[string]*Heartbeat, len(list))
+
+		for _, h := range list {
+			s.heartbeats[h.name] = h
+		}
+	}
+}
+
+// heartbeatTimer is the state of a named heartbeat in the server loop.
+type heartbeatTimer struct {
+	*Heartbeat
+	deadline time.Time
+	expired  bool
+	lastSeen time.Time
+	timer    *time.Timer
+}
+
+// startHeartbeatTimers starts the timers of the named heartbeats, the
+// name of a heartbeat is sent on expired when its timer expires.
+func (s *server) startHeartbeatTimers(ctx context.Context, expired chan<- string) map[string]*heartbeatTimer {
+	timers := make(map[string]*heartbeatTimer, len(s.heartbeats))
+
+	for name, h := range s.heartbeats {
+		name := name
+
+		timers[name] = &heartbeatTimer{
+			Heartbeat: h,
+			deadline:  time.Now().Add(h.timeout),
+			timer: time.AfterFunc(h.timeout, func() {
+				select {
+				case expired <- name:
+				case <-ctx.Done():
+				}
+			}),
+		}
+	}
+
+	return timers
+}
+
+// ping restarts the timer of the heartbeat.
+func (h *heartbeatTimer) ping() {
+	h.lastSeen = time.Now()
+	h.deadline = h.lastSeen.Add(h.timeout)
+	h.expired = false
+
+	h.timer.Stop()
+	h.timer.Reset(h.timeout)
+}
+
+// expire marks the heartbeat as expired, unless it was pinged after
+// its timer fired.
+func (h *heartbeatTimer) expire() bool {
+	if time.Now().Before(h.deadline) {
+		return false
+	}
+
+	h.expired = true
+
+	return true
+}
+
+func stopHeartbeatTimers(timers map[string]*heartbeatTimer) {
+	for _, h := range timers {
+		h.timer.Stop()
+	}
+}
+
+func (s *server) setHeartbeatsStatus(timers map[string]*heartbeatTimer) {
+	status := make([]HeartbeatStatus, 0, len(timers))
+
+	for _, h := range timers {
+		status = append(status, HeartbeatStatus{
+			Name:     h.name,
+			Required: h.required,
+			Timeout:  h.timeout,
+			LastSeen: h.lastSeen,
+			Expired:  h.expired,
+		})
+	}
+
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.heartbeatsStatus = status
+}
+
+// HeartbeatsStatus returns the state of the named heartbeats, sorted
+// by name.
+func (s *server) HeartbeatsStatus() []HeartbeatStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]HeartbeatStatus(nil), s.heartbeatsStatus...)
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewHeartbeat(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     HeartbeatConfig
+		want    *Heartbeat
+		wantErr error
+	}{
+		{
+			name: "required",
+			cfg:  HeartbeatConfig{Name: "worker", Timeout: 1 * time.Minute},
+			want: &Heartbeat{name: "worker", required: true, timeout: 1 * time.Minute},
+		},
+		{
+			name: "optional",
+			cfg:  HeartbeatConfig{Name: "cleanup", Timeout: 1 * time.Hour, Optional: true},
+			want: &Heartbeat{name: "cleanup", required: false, timeout: 1 * time.Hour},
+		},
+		{name: "missing_name", cfg: HeartbeatConfig{Timeout: 1 * time.Minute}, wantErr: ErrInvalidHeartbeat},
+		{name: "invalid_name", cfg: HeartbeatConfig{Name: "a/b", Timeout: 1 * time.Minute}, wantErr: ErrInvalidHeartbeat},
+		{name: "missing_timeout", cfg: HeartbeatConfig{Name: "worker"}, wantErr: ErrInvalidHeartbeat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewHeartbeat(tt.cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewHeartbeat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("NewHeartbeat() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_server_NamedPingHandler(t *testing.T) {
+	worker, _ := NewHeartbeat(HeartbeatConfig{Name: "worker", Timeout: 1 * time.Minute})
+
+	s := &server{namedPing: make(chan string, 1)}
+	WithHeartbeats(worker)(s)
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		want       string
+	}{
+		{name: "Known_heartbeat", path: "/ping/worker", statusCode: http.StatusOK, want: "worker"},
+		{name: "Unknown_heartbeat", path: "/ping/unknown", statusCode: http.StatusNotFound},
+		{name: "Empty_name", path: "/ping/", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.NamedPingHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.statusCode)
+			}
+
+			select {
+			case name := <-s.namedPing:
+				if name != tt.want {
+					t.Errorf("expected a ping of %q, got %q", tt.want, name)
+				}
+			default:
+				if tt.want != "" {
+					t.Errorf("expected a ping of %q", tt.want)
+				}
+			}
+		})
+	}
+}
+
+func Test_server_do_Heartbeats(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	worker, _ := NewHeartbeat(HeartbeatConfig{Name: "worker", Timeout: 100 * time.Millisecond})
+	cleanup, _ := NewHeartbeat(HeartbeatConfig{Name: "cleanup", Timeout: 100 * time.Millisecond, Optional: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		events:        make(chan ServerEvent, 1),
+		externalAlive: make(chan bool),
+		namedPing:     make(chan string),
+		pingChannel:   make(chan bool),
+		updateProcess: make(chan ProcessState),
+		updateReady:   make(chan bool),
+	}
+	WithHeartbeats(worker, cleanup)(s)
+
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	s.externalAlive <- true
+
+	// the worker is pinged, the optional heartbeat expires
+	for i := 0; i < 4; i++ {
+		s.namedPing <- "worker"
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if !s.IsAlive() {
+		t.Errorf("isAlive must be true while the required heartbeats are pinged")
+	}
+
+	status := s.HeartbeatsStatus()
+	if len(status) != 2 || status[0].Name != "cleanup" || status[1].Name != "worker" {
+		t.Fatalf("expected the status of cleanup and worker, got %+v", status)
+	}
+
+	if !status[0].Expired || !status[0].LastSeen.IsZero() {
+		t.Errorf("expected cleanup to be expired and never seen, got %+v", status[0])
+	}
+
+	if status[1].Expired || time.Since(status[1].LastSeen) > 100*time.Millisecond {
+		t.Errorf("expected worker to be seen recently, got %+v", status[1])
+	}
+
+	// the worker stops, while the main ping keeps arriving
+	s.pingChannel <- true
+
+	time.Sleep(150 * time.Millisecond)
+
+	if s.IsAlive() {
+		t.Errorf("isAlive must be false after a required heartbeat expires")
+	}
+
+	if status := s.HeartbeatsStatus(); !status[1].Expired {
+		t.Errorf("expected worker to be expired, got %+v", status[1])
+	}
+
+	s.namedPing <- "worker"
+
+	// waiting for the status to be updated
+	time.Sleep(1 * time.Millisecond)
+
+	if !s.IsAlive() {
+		t.Errorf("isAlive must be true after the heartbeat is pinged again")
+	}
+
+	cancel()
+	<-serverDone
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// defaultMaintenanceFileInterval is used when the interval of the
+// maintenance file is not positive.
+const defaultMaintenanceFileInterval = 1 * time.Second
+
+// maxMaintenanceReasonSize is the maximum size of the reason of the
+// maintenance, read from the first line of the maintenance file.
+const maxMaintenanceReasonSize = 1024
+
+var ErrInvalidMaintenance = errors.New("invalid maintenance request")
+
+// MaintenanceStatus is the state of the maintenance mode: while it's
+// enabled, the wrapped process is not ready.
+type MaintenanceStatus struct {
+	Enabled bool
+	Reason  string
+	// EnabledBy describes who or what enabled the maintenance mode.
+	EnabledBy string
+	Since     time.Time
+}
+
+// maintenanceFile is a file enabling the maintenance mode while it
+// exists, its first line is the reason of the maintenance.
+type maintenanceFile struct {
+	interval time.Duration
+	path     string
+}
+
+// WithMaintenanceFile enables the maintenance mode while the file in
+// path exists, it's checked every interval.
+func WithMaintenanceFile(path string, interval time.Duration) ServerOption {
+	if interval <= 0 {
+		interval = defaultMaintenanceFileInterval
+	}
+
+	return func(s *server) {
+		s.maintenanceFile = &maintenanceFile{
+			interval: interval,
+			path:     path,
+		}
+	}
+}
+
+// check returns the maintenance status set by the file, ok is false if
+// the file cannot be read.
+func (m *maintenanceFile) check(current MaintenanceStatus) (status MaintenanceStatus, ok bool) {
+	f, err := os.Open(m.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return MaintenanceStatus{}, true
+		}
+
+		logger.Warnf("cannot read the maintenance file %s: %s", m.path, err)
+
+		return current, false
+	}
+	defer f.Close()
+
+	reason, err := bufio.NewReader(io.LimitReader(f, maxMaintenanceReasonSize)).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		logger.Warnf("cannot read the maintenance file %s: %s", m.path, err)
+
+		return current, false
+	}
+
+	status = MaintenanceStatus{
+		Enabled:   true,
+		Reason:    strings.TrimSpace(reason),
+		EnabledBy: "file " + m.path,
+		Since:     current.Since,
+	}
+
+	if !current.Enabled {
+		status.Since = time.Now()
+	}
+
+	return status, true
+}
+
+// parseMaintenance reads a maintenance request of the admin API, from
+// the enabled, reason and by parameters, in the query or in a form.
+func parseMaintenance(r *http.Request) (MaintenanceStatus, error) {
+	enabled := true
+
+	if value := r.FormValue("enabled"); value != "" {
+		var err error
+
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			return MaintenanceStatus{}, fmt.Errorf("%w: enabled must be a boolean, got %q", ErrInvalidMaintenance, value)
+		}
+	}
+
+	if !enabled {
+		return MaintenanceStatus{}, nil
+	}
+
+	return MaintenanceStatus{
+		Enabled:   true,
+		Reason:    r.FormValue("reason"),
+		EnabledBy: requestedBy(r),
+		Since:     time.Now(),
+	}, nil
+}
+
+// maintenanceTracker merges the maintenance status set by the file and
+// by the admin API, in the server loop; the file takes precedence.
+type maintenanceTracker struct {
+	api  MaintenanceStatus
+	file MaintenanceStatus
+}
+
+func (m *maintenanceTracker) status() MaintenanceStatus {
+	if m.file.Enabled {
+		return m.file
+	}
+
+	return m.api
+}
+
+func (s *server) setMaintenanceStatus(status MaintenanceStatus) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	switch {
+	case status.Enabled && (!s.maintenanceStatus.Enabled || status.EnabledBy != s.maintenanceStatus.EnabledBy):
+		s.addTransition("maintenance", "enabled", "by "+status.EnabledBy+": "+status.Reason)
+	case !status.Enabled && s.maintenanceStatus.Enabled:
+		s.addTransition("maintenance", "disabled", "")
+	}
+
+	s.maintenanceStatus = status
+}
+
+// MaintenanceStatus returns the state of the maintenance mode.
+func (s *server) MaintenanceStatus() MaintenanceStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.maintenanceStatus
+}
+
+// Maintenance returns the channel receiving the changes of the
+// maintenance mode, only the last change is kept if it's not read.
+func (s *server) Maintenance() <-chan bool {
+	return s.maintenance
+}
+
+// sendMaintenance sends a change of the maintenance mode, replacing
+// the pending one.
+func (s *server) sendMaintenance(isEnabled bool) {
+	select {
+	case <-s.maintenance:
+	default:
+	}
+
+	s.maintenance <- isEnabled
+}
@@ -0,0 +1,260 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func Test_parseMaintenance(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        string
+		form          url.Values
+		principal     string
+		wantEnabled   bool
+		wantReason    string
+		wantEnabledBy string
+		wantErr       error
+	}{
+		{
+			name:          "Enable",
+			target:        "/admin/maintenance",
+			wantEnabled:   true,
+			wantEnabledBy: "POST /admin/maintenance from 192.0.2.1:1234",
+		},
+		{
+			name:          "Query",
+			target:        "/admin/maintenance?reason=upgrade&by=alice",
+			wantEnabled:   true,
+			wantReason:    "upgrade",
+			wantEnabledBy: `POST /admin/maintenance from 192.0.2.1:1234, note "alice"`,
+		},
+		{
+			name:          "Authenticated",
+			target:        "/admin/maintenance?reason=upgrade&by=alice",
+			principal:     "user ops",
+			wantEnabled:   true,
+			wantReason:    "upgrade",
+			wantEnabledBy: `user ops (POST /admin/maintenance from 192.0.2.1:1234), note "alice"`,
+		},
+		{
+			name:          "Form",
+			target:        "/admin/maintenance",
+			form:          url.Values{"enabled": {"true"}, "reason": {"disk full"}},
+			wantEnabled:   true,
+			wantReason:    "disk full",
+			wantEnabledBy: "POST /admin/maintenance from 192.0.2.1:1234",
+		},
+		{
+			name:   "Disable",
+			target: "/admin/maintenance?enabled=false&reason=ignored",
+		},
+		{
+			name:    "Invalid_enabled",
+			target:  "/admin/maintenance?enabled=maybe",
+			wantErr: ErrInvalidMaintenance,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.form.Encode()))
+			if tt.form != nil {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+
+			if tt.principal != "" {
+				r = r.WithContext(context.WithValue(r.Context(), principalKey{}, tt.principal))
+			}
+
+			got, err := parseMaintenance(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseMaintenance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got.Enabled != tt.wantEnabled || got.Reason != tt.wantReason || got.EnabledBy != tt.wantEnabledBy {
+				t.Errorf("parseMaintenance() = %+v, want enabled %t, reason %q, by %q", got, tt.wantEnabled, tt.wantReason, tt.wantEnabledBy)
+			}
+
+			if got.Enabled == got.Since.IsZero() {
+				t.Errorf("parseMaintenance() since = %v, expected only when enabled", got.Since)
+			}
+		})
+	}
+}
+
+func Test_maintenanceFile_check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "maintenance")
+	m := &maintenanceFile{path: path}
+
+	status, ok := m.check(MaintenanceStatus{})
+	if !ok || status.Enabled {
+		t.Errorf("a missing file must disable the maintenance, got %+v", status)
+	}
+
+	if err := os.WriteFile(path, []byte("  node upgrade \nsecond line\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	status, ok = m.check(status)
+	if !ok || !status.Enabled || status.Reason != "node upgrade" || status.EnabledBy != "file "+path || status.Since.IsZero() {
+		t.Errorf("the file must enable the maintenance, got %+v", status)
+	}
+
+	// the time the maintenance started is kept
+	since := status.Since
+
+	status, _ = m.check(status)
+	if status.Since != since {
+		t.Errorf("expected the maintenance since %v, got %v", since, status.Since)
+	}
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _ = m.check(status)
+	if !status.Enabled || status.Reason != "" {
+		t.Errorf("an empty file must enable the maintenance without a reason, got %+v", status)
+	}
+}
+
+func Test_server_do_Maintenance(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	path := filepath.Join(t.TempDir(), "maintenance")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		events:            make(chan ServerEvent, 1),
+		externalAlive:     make(chan bool),
+		maintenance:       make(chan bool, 1),
+		pingChannel:       make(chan bool),
+		updateMaintenance: make(chan MaintenanceStatus),
+		updateProcess:     make(chan ProcessState),
+		updateReady:       make(chan bool),
+	}
+	WithMaintenanceFile(path, 20*time.Millisecond)(s)
+
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	// every update is sent twice, to wait for the first one to be handled
+	s.updateReady <- true
+	s.updateReady <- true
+	s.externalAlive <- true
+	s.externalAlive <- true
+
+	ready := func() (int, string) {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.ReadyHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/ready", nil))
+
+		return rr.Code, rr.Body.String()
+	}
+
+	nextMaintenance := func(want bool) {
+		t.Helper()
+
+		select {
+		case got := <-s.Maintenance():
+			if got != want {
+				t.Errorf("expected the maintenance %t, got %t", want, got)
+			}
+		case <-time.After(1 * time.Second):
+			t.Errorf("a change of the maintenance was expected")
+		}
+	}
+
+	if code, _ := ready(); code != http.StatusOK {
+		t.Fatalf("the server must be ready, got %d", code)
+	}
+
+	// the maintenance is enabled by the admin API
+	api := MaintenanceStatus{Enabled: true, Reason: "upgrade", EnabledBy: "alice", Since: time.Now()}
+	s.updateMaintenance <- api
+	s.updateMaintenance <- MaintenanceStatus{Enabled: true, Reason: "upgrade", EnabledBy: "alice", Since: time.Now()}
+
+	nextMaintenance(true)
+
+	if code, body := ready(); code != http.StatusServiceUnavailable || body != "maintenance: upgrade" {
+		t.Errorf("the server must not be ready during the maintenance, got %d %q", code, body)
+	}
+
+	if !s.IsAlive() {
+		t.Errorf("the maintenance must not change the liveness")
+	}
+
+	if status := s.MaintenanceStatus(); status != api {
+		t.Errorf("expected the maintenance %+v, got %+v", api, status)
+	}
+
+	// the file takes precedence
+	if err := os.WriteFile(path, []byte("node drain\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if status := s.MaintenanceStatus(); status.Reason != "node drain" || status.EnabledBy != "file "+path {
+		t.Errorf("expected the maintenance of the file, got %+v", status)
+	}
+
+	s.updateMaintenance <- MaintenanceStatus{}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	nextMaintenance(false)
+
+	if code, _ := ready(); code != http.StatusOK {
+		t.Errorf("the server must be ready after the maintenance, got %d", code)
+	}
+
+	cancel()
+	<-serverDone
+}
+
+func Test_server_MaintenanceHandler(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	s := &server{updateMaintenance: make(chan MaintenanceStatus, 1)}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.MaintenanceHandler).ServeHTTP(rr, httptest.NewRequest("POST", "/admin/maintenance?reason=upgrade", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if status := <-s.updateMaintenance; !status.Enabled || status.Reason != "upgrade" {
+		t.Errorf("expected the maintenance to be enabled, got %+v", status)
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.MaintenanceHandler).ServeHTTP(rr, httptest.NewRequest("POST", "/admin/maintenance?enabled=maybe", nil))
+
+	if rr.Code != http.StatusBadRequest || len(s.updateMaintenance) != 0 {
+		t.Errorf("an invalid request must be rejected, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,370 @@
+package http
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// metricsPrefix is the prefix of the names of all the metrics.
+const metricsPrefix = "liveness_wrapper_"
+
+// labelValueReplacer escapes the values of the labels.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// requestDurationBuckets are the upper bounds of the buckets of the
+// request durations, in seconds.
+var requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricsWriter writes the metrics in the Prometheus text format.
+type MetricsWriter struct {
+	w io.Writer
+}
+
+// Family starts a family of metrics, of the given type: counter,
+// gauge or histogram; its samples must follow it. The name is
+// prefixed with liveness_wrapper_.
+func (m *MetricsWriter) Family(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(m.w, "# TYPE %s%s %s\n", metricsPrefix, name, typ)
+}
+
+// Sample writes a sample of the current family, the labels are pairs
+// of names and values.
+func (m *MetricsWriter) Sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+
+	b.WriteString(metricsPrefix + name)
+
+	if len(labels) > 0 {
+		b.WriteByte('{')
+
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			fmt.Fprintf(&b, `%s="%s"`, labels[i], labelValueReplacer.Replace(labels[i+1]))
+		}
+
+		b.WriteByte('}')
+	}
+
+	fmt.Fprintf(m.w, "%s %s\n", b.String(), formatMetricValue(value))
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		// the counters and the sizes are written without an exponent
+		return strconv.FormatInt(int64(value), 10)
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func boolMetric(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+// MetricsCollector writes metrics which are not known by the server,
+// like the ones of the wrapped process.
+type MetricsCollector func(m *MetricsWriter)
+
+// WithMetricsCollector adds the metrics written by collector to the
+// /metrics endpoint.
+func WithMetricsCollector(collector MetricsCollector) ServerOption {
+	return func(s *server) {
+		s.metricsCollectors = append(s.metricsCollectors, collector)
+	}
+}
+
+// WithMetricsAddress serves /metrics on its own listener, instead of
+// the address of the http server.
+func WithMetricsAddress(addr string) ServerOption {
+	return func(s *server) {
+		s.metricsAddress = addr
+	}
+}
+
+// WithProcFS samples the resources used by the wrapped process from
+// the proc filesystem, they are exposed by /metrics.
+func WithProcFS(fs procfs.FS) ServerOption {
+	return func(s *server) {
+		s.procfs = &fs
+	}
+}
+
+// histogram counts the observations in cumulative buckets.
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range requestDurationBuckets {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+type requestKey struct {
+	path string
+	code int
+}
+
+// requestMetrics counts the requests served by the http server, by
+// route; the path of a route is its pattern, not the requested path.
+type requestMetrics struct {
+	durations map[string]*histogram
+	requests  map[requestKey]uint64
+	mux       sync.Mutex
+}
+
+func newRequestMetrics() *requestMetrics {
+	return &requestMetrics{
+		durations: make(map[string]*histogram),
+		requests:  make(map[requestKey]uint64),
+	}
+}
+
+// observer returns the RequestObserver of the route with the given path.
+func (m *requestMetrics) observer(path string) RequestObserver {
+	return func(_ *http.Request, status int, duration time.Duration) {
+		if status == 0 {
+			// the status is implicit, if the handler didn't write it
+			status = http.StatusOK
+		}
+
+		m.mux.Lock()
+		defer m.mux.Unlock()
+
+		m.requests[requestKey{path: path, code: status}]++
+
+		h, ok := m.durations[path]
+		if !ok {
+			h = &histogram{buckets: make([]uint64, len(requestDurationBuckets))}
+			m.durations[path] = h
+		}
+
+		h.observe(duration.Seconds())
+	}
+}
+
+func (m *requestMetrics) write(w *MetricsWriter) {
+	if m == nil {
+		return
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+
+		return keys[i].code < keys[j].code
+	})
+
+	w.Family("http_requests_total", "counter", "Number of requests served by the http server, by route and status code.")
+
+	for _, key := range keys {
+		w.Sample("http_requests_total", float64(m.requests[key]), "path", key.path, "code", strconv.Itoa(key.code))
+	}
+
+	paths := make([]string, 0, len(m.durations))
+	for path := range m.durations {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	w.Family("http_request_duration_seconds", "histogram", "Time spent serving the requests, by route.")
+
+	for _, path := range paths {
+		h := m.durations[path]
+
+		for i, bound := range requestDurationBuckets {
+			w.Sample("http_request_duration_seconds_bucket", float64(h.buckets[i]), "path", path, "le", formatMetricValue(bound))
+		}
+
+		w.Sample("http_request_duration_seconds_bucket", float64(h.count), "path", path, "le", "+Inf")
+		w.Sample("http_request_duration_seconds_sum", h.sum, "path", path)
+		w.Sample("http_request_duration_seconds_count", float64(h.count), "path", path)
+	}
+}
+
+// writeMetrics writes the metrics of the server, from a consistent
+// snapshot of its state.
+func (s *server) writeMetrics(w *MetricsWriter, now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	w.Family("process_up", "gauge", "Whether the wrapped process is running.")
+	w.Sample("process_up", boolMetric(s.processState.Pid != 0))
+
+	w.Family("process_restarts_total", "counter", "Number of restarts of the wrapped process, by the cause of the end of the previous execution.")
+
+	causes := make([]string, 0, len(s.restarts))
+	for cause := range s.restarts {
+		causes = append(causes, cause)
+	}
+
+	sort.Strings(causes)
+
+	for _, cause := range causes {
+		w.Sample("process_restarts_total", float64(s.restarts[cause]), "reason", cause)
+	}
+
+	if exit := s.processState.LastExit; exit != nil {
+		w.Family("process_last_exit_code", "gauge", "Exit status of the last execution of the wrapped process, 128 plus the signal if it was killed.")
+		w.Sample("process_last_exit_code", float64(exit.ExitStatus))
+	}
+
+	if !s.processState.StartTime.IsZero() {
+		w.Family("process_start_time_seconds", "gauge", "Start time of the wrapped process, since the epoch.")
+		w.Sample("process_start_time_seconds", float64(s.processState.StartTime.UnixNano())/1e9)
+	}
+
+	w.Family("alive", "gauge", "Whether the wrapped process is alive, like the /alive endpoint.")
+	w.Sample("alive", boolMetric(s.isAlive))
+	w.Family("ready", "gauge", "Whether the wrapped process is ready, like the /ready endpoint.")
+	w.Sample("ready", boolMetric(s.isReady))
+	w.Family("started", "gauge", "Whether the wrapped process completed its startup, like the /startup endpoint.")
+	w.Sample("started", boolMetric(s.isStarted))
+	w.Family("maintenance", "gauge", "Whether the maintenance mode is enabled.")
+	w.Sample("maintenance", boolMetric(s.maintenanceStatus.Enabled))
+
+	w.Family("check_healthy", "gauge", "Whether a check contributing to the liveness or the readiness passes, like /livez and /readyz.")
+
+	for _, check := range s.liveness {
+		w.Sample("check_healthy", boolMetric(check.Healthy), "probe", "livez", "check", check.Name)
+	}
+
+	for _, check := range s.readinessChecks {
+		w.Sample("check_healthy", boolMetric(check.Healthy), "probe", "readyz", "check", check.Name)
+	}
+
+	if !s.lastPing.IsZero() {
+		w.Family("seconds_since_last_ping", "gauge", "Time elapsed since the last ping of the wrapped process.")
+		w.Sample("seconds_since_last_ping", now.Sub(s.lastPing).Seconds())
+	}
+
+	w.Family("ping_rejected_total", "counter", "Number of pings rejected because of their ping token, by reason.")
+	w.Sample("ping_rejected_total", float64(s.pingTokenStatus.Stale), "reason", "stale")
+	w.Sample("ping_rejected_total", float64(s.pingTokenStatus.Unauthenticated), "reason", "unauthenticated")
+}
+
+// writeResourceMetrics writes the resources used by the wrapped
+// process, sampled from the proc filesystem.
+func (s *server) writeResourceMetrics(w *MetricsWriter) {
+	s.mux.Lock()
+	pid := s.processState.Pid
+	s.mux.Unlock()
+
+	if s.procfs == nil || pid == 0 {
+		return
+	}
+
+	// the process may end while it's sampled
+	stat, err := s.procfs.ReadStat(pid)
+	if err != nil {
+		logger.Debugf("cannot sample the resources of the wrapped process %d: %s", pid, err)
+		return
+	}
+
+	w.Family("process_cpu_seconds_total", "counter", "User and system CPU time spent by the wrapped process.")
+	w.Sample("process_cpu_seconds_total", stat.CPUSeconds)
+	w.Family("process_resident_memory_bytes", "gauge", "Resident memory size of the wrapped process.")
+	w.Sample("process_resident_memory_bytes", float64(stat.ResidentMemoryBytes))
+	w.Family("process_virtual_memory_bytes", "gauge", "Virtual memory size of the wrapped process.")
+	w.Sample("process_virtual_memory_bytes", float64(stat.VirtualMemoryBytes))
+	w.Family("process_threads", "gauge", "Number of threads of the wrapped process.")
+	w.Sample("process_threads", float64(stat.Threads))
+
+	if files, err := s.procfs.OpenFiles(pid); err == nil {
+		w.Family("process_open_fds", "gauge", "Number of files opened by the wrapped process.")
+		w.Sample("process_open_fds", float64(files))
+	}
+}
+
+// MetricsHandler exposes the metrics in the Prometheus text format.
+func (s *server) MetricsHandler(w http.ResponseWriter, _ *http.Request) {
+	var b strings.Builder
+
+	m := &MetricsWriter{w: &b}
+
+	s.writeMetrics(m, time.Now())
+	s.writeResourceMetrics(m)
+	s.requestMetrics.write(m)
+
+	for _, collector := range s.metricsCollectors {
+		collector(m)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		logger.Errorf("cannot write response from /metrics handler: %s", err)
+	}
+}
+
+// startMetrics starts the listener of /metrics, when it's apart from
+// the http server.
+func (s *server) startMetrics(serverError chan<- error) {
+	listener, err := net.Listen("tcp", s.metricsServer.Addr)
+	if err != nil {
+		logger.Errorf("cannot bind metrics server on %s: %s", s.metricsServer.Addr, err)
+		serverError <- err
+
+		return
+	}
+
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+
+	logger.Infof("starting metrics server on %s...", listener.Addr())
+
+	go func() {
+		if err := s.metricsServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("metrics server on %s failed: %s", s.metricsServer.Addr, err)
+		}
+	}()
+}
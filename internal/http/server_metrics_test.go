@@ -0,0 +1,237 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/procfs"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func TestMetricsWriter(t *testing.T) {
+	var b strings.Builder
+
+	m := &MetricsWriter{w: &b}
+	m.Family("checks", "gauge", "Some checks.")
+	m.Sample("checks", 1)
+	m.Sample("checks", 0.25, "name", "web", "reason", "a \"quoted\"\\reason\non two lines")
+	m.Sample("checks", 0, "le", "+Inf")
+
+	want := `# HELP liveness_wrapper_checks Some checks.
+# TYPE liveness_wrapper_checks gauge
+liveness_wrapper_checks 1
+liveness_wrapper_checks{name="web",reason="a \"quoted\"\\reason\non two lines"} 0.25
+liveness_wrapper_checks{le="+Inf"} 0
+`
+
+	if got := b.String(); got != want {
+		t.Errorf("expected the metrics\n%s\ngot\n%s", want, got)
+	}
+}
+
+func Test_requestMetrics(t *testing.T) {
+	m := newRequestMetrics()
+
+	alive := m.observer("/alive")
+	alive(nil, 0, 20*time.Millisecond)
+	alive(nil, http.StatusServiceUnavailable, 3*time.Second)
+	m.observer("/ping/{name}")(nil, http.StatusNotFound, time.Millisecond)
+
+	var b strings.Builder
+
+	m.write(&MetricsWriter{w: &b})
+	got := b.String()
+
+	for _, want := range []string{
+		`liveness_wrapper_http_requests_total{path="/alive",code="200"} 1`,
+		`liveness_wrapper_http_requests_total{path="/alive",code="503"} 1`,
+		`liveness_wrapper_http_requests_total{path="/ping/{name}",code="404"} 1`,
+		`liveness_wrapper_http_request_duration_seconds_bucket{path="/alive",le="0.01"} 0`,
+		`liveness_wrapper_http_request_duration_seconds_bucket{path="/alive",le="0.025"} 1`,
+		`liveness_wrapper_http_request_duration_seconds_bucket{path="/alive",le="5"} 2`,
+		`liveness_wrapper_http_request_duration_seconds_bucket{path="/alive",le="+Inf"} 2`,
+		`liveness_wrapper_http_request_duration_seconds_sum{path="/alive"} 3.02`,
+		`liveness_wrapper_http_request_duration_seconds_count{path="/alive"} 2`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("expected the metric %s, got\n%s", want, got)
+		}
+	}
+}
+
+func Test_server_MetricsHandler(t *testing.T) {
+	// the resources of the wrapped process are sampled from a fake /proc
+	root := t.TempDir()
+	stat := "100 (app) S 1 100 100 0 -1 4194560 1000 0 0 0 250 50 0 0 20 0 4 0 12345 104857600 2560 18446744073709551615\n"
+
+	if err := os.MkdirAll(filepath.Join(root, "100", "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "100", "stat"), []byte(stat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fd := range []string{"0", "1", "2"} {
+		if err := os.WriteFile(filepath.Join(root, "100", "fd", fd), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &server{
+		isAlive:        true,
+		lastPing:       time.Now().Add(-2 * time.Second),
+		liveness:       []CheckStatus{{Name: "process", Healthy: true}},
+		requestMetrics: newRequestMetrics(),
+		readinessChecks: []CheckStatus{
+			{Name: "server", Healthy: true},
+			{Name: "maintenance", Reason: "enabled by alice"},
+		},
+	}
+	WithProcFS(procfs.NewFS(root))(s)
+	WithMetricsCollector(func(m *MetricsWriter) {
+		m.Family("process_output_lines_total", "counter", "Lines.")
+		m.Sample("process_output_lines_total", 7, "stream", "stdout")
+	})(s)
+
+	// the restarts are counted by the cause of the previous exit
+	exited := &ProcessExit{ExitStatus: 1, Cause: "exit"}
+	killed := &ProcessExit{ExitStatus: 137, Signal: "SIGKILL", Cause: "signal"}
+	s.setProcessState(ProcessState{State: "running", Pid: 99})
+	s.setProcessState(ProcessState{State: "error", LastExit: exited})
+	s.setProcessState(ProcessState{State: "running", Pid: 99, Restarts: 1, LastExit: exited})
+	s.setProcessState(ProcessState{State: "error", Restarts: 1, LastExit: killed})
+	s.setProcessState(ProcessState{State: "running", Pid: 100, Restarts: 2, LastExit: killed})
+
+	s.requestMetrics.observer("/alive")(nil, http.StatusOK, time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.MetricsHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("handler returned wrong content type: %q", contentType)
+	}
+
+	got := rr.Body.String()
+
+	for _, want := range []string{
+		"liveness_wrapper_process_up 1",
+		`liveness_wrapper_process_restarts_total{reason="exit"} 1`,
+		`liveness_wrapper_process_restarts_total{reason="signal"} 1`,
+		"liveness_wrapper_process_last_exit_code 137",
+		"liveness_wrapper_alive 1",
+		"liveness_wrapper_ready 0",
+		"liveness_wrapper_maintenance 0",
+		`liveness_wrapper_check_healthy{probe="livez",check="process"} 1`,
+		`liveness_wrapper_check_healthy{probe="readyz",check="maintenance"} 0`,
+		`liveness_wrapper_ping_rejected_total{reason="stale"} 0`,
+		"liveness_wrapper_process_cpu_seconds_total 3",
+		"liveness_wrapper_process_resident_memory_bytes " + strconv.Itoa(2560*os.Getpagesize()),
+		"liveness_wrapper_process_virtual_memory_bytes 104857600",
+		"liveness_wrapper_process_threads 4",
+		"liveness_wrapper_process_open_fds 3",
+		`liveness_wrapper_http_requests_total{path="/alive",code="200"} 1`,
+		`liveness_wrapper_process_output_lines_total{stream="stdout"} 7`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("expected the metric %s, got\n%s", want, got)
+		}
+	}
+
+	if !strings.Contains(got, "liveness_wrapper_seconds_since_last_ping 2.") {
+		t.Errorf("expected the time since the last ping, got\n%s", got)
+	}
+
+	// the resources are not sampled while the process is not running
+	s.setProcessState(ProcessState{State: "stopped", Restarts: 2})
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.MetricsHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got := rr.Body.String(); !strings.Contains(got, "liveness_wrapper_process_up 0\n") || strings.Contains(got, "process_threads") {
+		t.Errorf("expected a process down, without resources, got\n%s", got)
+	}
+}
+
+func Test_server_Start_Metrics(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	// freeAddress returns an address nobody is listening on
+	freeAddress := func() string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer listener.Close()
+
+		return listener.Addr().String()
+	}
+
+	tests := []struct {
+		name        string
+		addr        string
+		grpcAddress string
+	}{
+		{name: "Metrics_address_in_use", addr: freeAddress()},
+		{name: "HTTP_and_metrics_addresses_in_use", addr: busy.Addr().String()},
+		{name: "GRPC_and_metrics_addresses_in_use", addr: freeAddress(), grpcAddress: busy.Addr().String()},
+		{name: "Metrics_address_in_use_with_GRPC", addr: freeAddress(), grpcAddress: freeAddress()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []ServerOption{WithMetricsAddress(busy.Addr().String())}
+			if tt.grpcAddress != "" {
+				opts = append(opts, WithGRPCAddress(tt.grpcAddress))
+			}
+
+			s := NewServer(tt.addr, 1*time.Second, 0, opts...)
+
+			_, _, serverDone := s.Start(context.Background())
+
+			select {
+			case <-serverDone:
+			case <-time.After(1 * time.Second):
+				t.Fatalf("the server was expected to end")
+			}
+
+			if s.Err() == nil {
+				t.Errorf("the error of the failed listener was expected")
+			}
+
+			// let the other listeners report their errors too
+			time.Sleep(100 * time.Millisecond)
+
+			// the servers which didn't fail are shut down
+			for _, addr := range []string{tt.addr, tt.grpcAddress} {
+				if addr == "" || addr == busy.Addr().String() {
+					continue
+				}
+
+				if conn, err := net.Dial("tcp", addr); err == nil {
+					conn.Close()
+					t.Errorf("expected nothing listening on %s", addr)
+				}
+			}
+		})
+	}
+}
@@ -31,13 +31,23 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.wroteHeader = true
 }
 
-func LoggingMiddleware() func(http.Handler) http.Handler {
+// RequestObserver is notified of every request served by the
+// LoggingMiddleware, with its status and its duration.
+type RequestObserver func(r *http.Request, status int, duration time.Duration)
+
+func LoggingMiddleware(observers ...RequestObserver) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			wrapped := wrapResponseWriter(w)
 			next.ServeHTTP(wrapped, r)
-			logger.HTTPDebugWithDuration(r, wrapped.status, time.Since(start))
+
+			duration := time.Since(start)
+			logger.HTTPDebugWithDuration(r, wrapped.status, duration)
+
+			for _, observe := range observers {
+				observe(r, wrapped.status, duration)
+			}
 		}
 
 		return http.HandlerFunc(fn)
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_inStringSlice(t *testing.T) {
@@ -63,8 +64,9 @@ func TestLoggingMiddleware(t *testing.T) {
 			_ = wc.Close()
 		}()
 
-		// Redirect the logger to a buffer
-		logger.Configure(wc, "test", "DEBUG")
+		// Redirect the logger to a buffer, replacing the logger
+		// created by the tests executed before this one
+		logger.New(wc, "test", "DEBUG")
 
 		// Create test HTTP server
 		ts := httptest.NewServer(LoggingMiddleware()(testGetHandler()))
@@ -73,7 +75,7 @@ func TestLoggingMiddleware(t *testing.T) {
 		// Trigger a request to get output to log
 		_, _ = http.Get(fmt.Sprintf("%s/", ts.URL))
 
-		logger.Configure(os.Stdout, "test", "DEBUG")
+		logger.New(os.Stdout, "test", "DEBUG")
 
 		// Test output
 		t.Log(buf.String())
@@ -87,6 +89,24 @@ func TestLoggingMiddleware(t *testing.T) {
 			t.Error("The output mus contains the go agent string: Go-http-client/1.1")
 		}
 	})
+
+	t.Run("observers", func(t *testing.T) {
+		var got []string
+
+		observer := func(r *http.Request, status int, _ time.Duration) {
+			got = append(got, fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status))
+		}
+
+		handler := LoggingMiddleware(observer, observer)(MethodsMiddleware([]string{"GET"})(testGetHandler()))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/ready", nil))
+
+		want := []string{"POST /ready 405", "POST /ready 405"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("expected the observations %q, got %q", want, got)
+		}
+	})
 }
 
 func TestMethodsMiddleware(t *testing.T) {
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxProgressBodySize is the maximum size of the JSON body of a ping.
+const maxProgressBodySize = 4096
+
+var ErrInvalidProgress = errors.New("invalid progress")
+
+// ProgressStatus is the state of the progress reported by the wrapped
+// process on the /ping endpoint.
+type ProgressStatus struct {
+	// Reported is false until the process reports its progress.
+	Reported bool
+	Value    uint64
+	// LastChange is the last time the value increased.
+	LastChange time.Time
+	Stalled    bool
+}
+
+// WithStallTimeout enables the stall detection: if the progress
+// reported on /ping doesn't increase within timeout, the process is
+// not alive, even if the pings keep arriving.
+func WithStallTimeout(timeout time.Duration) ServerOption {
+	return func(s *server) {
+		s.stallTimeout = timeout
+	}
+}
+
+// parseProgress reads the progress of a ping, from the progress query
+// parameter or from a JSON body like {"progress": 10}; ok is false if
+// the ping doesn't report it.
+func parseProgress(r *http.Request) (value uint64, ok bool, err error) {
+	if query := r.URL.Query().Get("progress"); query != "" {
+		value, err = strconv.ParseUint(query, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: %s", ErrInvalidProgress, query)
+		}
+
+		return value, true, nil
+	}
+
+	if r.Body == nil {
+		return 0, false, nil
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return 0, false, nil
+	}
+
+	var body struct {
+		Progress *uint64 `json:"progress"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxProgressBodySize)).Decode(&body); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("%w: %s", ErrInvalidProgress, err)
+	}
+
+	if body.Progress == nil {
+		return 0, false, nil
+	}
+
+	return *body.Progress, true, nil
+}
+
+// progressTracker detects a stalled progress in the server loop.
+type progressTracker struct {
+	status  ProgressStatus
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newProgressTracker(timeout time.Duration) *progressTracker {
+	timer := time.NewTimer(timeout)
+	stopTimer(timer)
+
+	return &progressTracker{timeout: timeout, timer: timer}
+}
+
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// update applies a progress value, the stall timer is restarted only
+// when the value increases; a lower value is ignored, the counter is
+// reset when the process restarts.
+func (p *progressTracker) update(value uint64) {
+	if p.status.Reported && value <= p.status.Value {
+		return
+	}
+
+	p.status = ProgressStatus{Reported: true, Value: value, LastChange: time.Now()}
+
+	stopTimer(p.timer)
+
+	if p.timeout > 0 {
+		p.timer.Reset(p.timeout)
+	}
+}
+
+// reset forgets the progress, e.g. after the process is restarted.
+func (p *progressTracker) reset() {
+	p.status = ProgressStatus{}
+
+	stopTimer(p.timer)
+}
+
+func (s *server) setProgressStatus(status ProgressStatus) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.progressStatus = status
+}
+
+// ProgressStatus returns the state of the progress reported by the
+// wrapped process.
+func (s *server) ProgressStatus() ProgressStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.progressStatus
+}
@@ -0,0 +1,181 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseProgress(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		want        uint64
+		wantOk      bool
+		wantErr     error
+	}{
+		{name: "no_progress", target: "/ping"},
+		{name: "query", target: "/ping?progress=42", want: 42, wantOk: true},
+		{name: "invalid_query", target: "/ping?progress=-1", wantErr: ErrInvalidProgress},
+		{name: "json", target: "/ping", contentType: "application/json", body: `{"progress": 10}`, want: 10, wantOk: true},
+		{name: "json_charset", target: "/ping", contentType: "application/json; charset=utf-8", body: `{"progress": 0}`, want: 0, wantOk: true},
+		{name: "json_without_progress", target: "/ping", contentType: "application/json", body: `{}`},
+		{name: "empty_json", target: "/ping", contentType: "application/json"},
+		{name: "invalid_json", target: "/ping", contentType: "application/json", body: `{"progress": "a"}`, wantErr: ErrInvalidProgress},
+		{name: "not_json", target: "/ping", contentType: "text/plain", body: `{"progress": 10}`},
+		{name: "query_first", target: "/ping?progress=5", contentType: "application/json", body: `{"progress": 10}`, want: 5, wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			got, ok, err := parseProgress(r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseProgress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseProgress() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_server_PingHandler_Progress(t *testing.T) {
+	s := &server{
+		pingChannel: make(chan bool, 1),
+		progress:    make(chan uint64, 1),
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.PingHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/ping?progress=7", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if <-s.pingChannel != true || <-s.progress != 7 {
+		t.Errorf("expected a ping with progress 7")
+	}
+
+	// an invalid progress is not a ping
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.PingHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/ping?progress=a", nil))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	if len(s.pingChannel) != 0 || len(s.progress) != 0 {
+		t.Errorf("no ping was expected")
+	}
+}
+
+func Test_server_do_Progress(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		events:        make(chan ServerEvent, 1),
+		externalAlive: make(chan bool),
+		pingChannel:   make(chan bool),
+		progress:      make(chan uint64),
+		updateProcess: make(chan ProcessState),
+		updateReady:   make(chan bool),
+	}
+	WithStallTimeout(100 * time.Millisecond)(s)
+
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	s.externalAlive <- true
+	s.UpdateProcess() <- ProcessState{Started: true}
+
+	// the stall detection starts with the first progress
+	time.Sleep(150 * time.Millisecond)
+
+	if !s.IsAlive() || s.ProgressStatus().Reported {
+		t.Errorf("isAlive must be true before the progress is reported")
+	}
+
+	// the progress increases
+	for i := uint64(1); i <= 3; i++ {
+		s.progress <- i
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if !s.IsAlive() {
+		t.Errorf("isAlive must be true while the progress increases")
+	}
+
+	// the pings keep arriving, but the progress doesn't increase
+	for i := 0; i < 4; i++ {
+		s.pingChannel <- true
+		s.progress <- 3
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if s.IsAlive() {
+		t.Errorf("isAlive must be false when the progress is stalled")
+	}
+
+	status := s.ProgressStatus()
+	if !status.Stalled || status.Value != 3 || time.Since(status.LastChange) < 100*time.Millisecond {
+		t.Errorf("expected a progress stalled at 3, got %+v", status)
+	}
+
+	s.progress <- 4
+
+	// waiting for the status to be updated
+	time.Sleep(1 * time.Millisecond)
+
+	if !s.IsAlive() {
+		t.Errorf("isAlive must be true after the progress increases")
+	}
+
+	// a value going back and forth doesn't increase
+	for i := 0; i < 4; i++ {
+		s.progress <- 3 + uint64(i%2)
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if s.IsAlive() {
+		t.Errorf("isAlive must be false when the progress goes back and forth")
+	}
+
+	if status := s.ProgressStatus(); !status.Stalled || status.Value != 4 {
+		t.Errorf("expected a progress stalled at 4, got %+v", status)
+	}
+
+	// the progress is forgotten when the process restarts
+	s.UpdateProcess() <- ProcessState{Started: false}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if !s.IsAlive() || s.ProgressStatus().Reported {
+		t.Errorf("isAlive must be true after a restart, got progress %+v", s.ProgressStatus())
+	}
+
+	cancel()
+	<-serverDone
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
+)
+
+var ErrInvalidReadiness = errors.New("invalid readiness policy")
+
+type ReadinessPolicy int
+
+const (
+	// ReadinessWrapper makes the wrapper ready as soon as the http
+	// server is started, whatever the state of the wrapped process.
+	ReadinessWrapper ReadinessPolicy = iota
+	// ReadinessProcess makes the wrapper ready only while the wrapped
+	// process is running and its startup is completed, it's not ready
+	// while the process is stopped or waiting to be restarted.
+	ReadinessProcess
+)
+
+func (p ReadinessPolicy) String() string {
+	switch p {
+	case ReadinessWrapper:
+		return "wrapper"
+	case ReadinessProcess:
+		return "process"
+	}
+
+	return "unknown"
+}
+
+// ParseReadinessPolicy parses a readiness policy, wrapper or process.
+func ParseReadinessPolicy(value string) (ReadinessPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "wrapper":
+		return ReadinessWrapper, nil
+	case "process":
+		return ReadinessProcess, nil
+	}
+
+	return 0, fmt.Errorf("%w: unknown policy %q", ErrInvalidReadiness, value)
+}
+
+// ReadinessConfig is the readiness policy of the wrapped process.
+type ReadinessConfig struct {
+	Policy ReadinessPolicy
+	// Delay is the time to wait after the startup of the process is
+	// completed, before it's ready.
+	Delay time.Duration
+	// AfterCheck makes the process ready only after the first
+	// successful health check of every execution.
+	AfterCheck bool
+}
+
+// WithReadiness sets the readiness policy, the delay and the health
+// checks are used only by the ReadinessProcess policy.
+func WithReadiness(cfg ReadinessConfig) ServerOption {
+	return func(s *server) {
+		s.readiness = cfg
+	}
+}
+
+// readinessTracker applies the readiness policy in the server loop,
+// following the lifecycle of the wrapped process.
+type readinessTracker struct {
+	ReadinessConfig
+	// checked is true after the first successful health check
+	checked bool
+	// delayed is true when the delay is elapsed
+	delayed bool
+	pid     int
+	started bool
+	timer   *time.Timer
+}
+
+func newReadinessTracker(cfg ReadinessConfig) *readinessTracker {
+	timer := time.NewTimer(cfg.Delay)
+	stopTimer(timer)
+
+	return &readinessTracker{ReadinessConfig: cfg, timer: timer}
+}
+
+// update applies the state of the process: the delay starts when the
+// startup is completed, and everything starts again with a new process.
+func (r *readinessTracker) update(state ProcessState) {
+	if state.Pid != r.pid {
+		r.pid = state.Pid
+		r.checked = false
+		r.delayed = false
+		r.started = false
+
+		stopTimer(r.timer)
+	}
+
+	if r.pid == 0 || !state.Started || r.started {
+		return
+	}
+
+	r.started = true
+
+	if r.Delay > 0 {
+		r.timer.Reset(r.Delay)
+		return
+	}
+
+	r.delayed = true
+}
+
+// check applies the result of a health check of the running process.
+func (r *readinessTracker) check(result health.Result) {
+	if r.pid != 0 && result.Probed && result.Healthy {
+		r.checked = true
+	}
+}
+
+func (r *readinessTracker) isReady() bool {
+	if r.Policy == ReadinessWrapper {
+		return true
+	}
+
+	return r.started && r.delayed && (r.checked || !r.AfterCheck)
+}
+
+// reason explains why the process is not ready yet.
+func (r *readinessTracker) reason() string {
+	switch {
+	case r.pid == 0:
+		return "the wrapped process is not running"
+	case !r.started:
+		return "the startup of the wrapped process is not completed"
+	case !r.delayed:
+		return fmt.Sprintf("the readiness delay of %s is not elapsed", r.Delay)
+	case r.AfterCheck && !r.checked:
+		return "no health check succeeded yet"
+	}
+
+	return ""
+}
@@ -0,0 +1,203 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
+)
+
+func TestParseReadinessPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ReadinessPolicy
+		wantErr error
+	}{
+		{value: "wrapper", want: ReadinessWrapper},
+		{value: " Process ", want: ReadinessProcess},
+		{value: "", wantErr: ErrInvalidReadiness},
+		{value: "running", wantErr: ErrInvalidReadiness},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseReadinessPolicy(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseReadinessPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseReadinessPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readinessTracker(t *testing.T) {
+	// a step is either a state of the process, a health check result,
+	// or the delay elapsed
+	type step struct {
+		name    string
+		state   *ProcessState
+		result  *health.Result
+		elapsed bool
+		want    bool
+	}
+
+	running := &ProcessState{Pid: 1234, Started: true}
+	starting := &ProcessState{Pid: 1234}
+	restarted := &ProcessState{Pid: 5678, Started: true}
+	stopped := &ProcessState{}
+	success := &health.Result{Name: "check", Healthy: true, Probed: true}
+	initial := &health.Result{Name: "check", Healthy: true}
+	failure := &health.Result{Name: "check", Probed: true}
+
+	tests := []struct {
+		name  string
+		cfg   ReadinessConfig
+		steps []step
+	}{
+		{
+			name: "Wrapper",
+			cfg:  ReadinessConfig{Policy: ReadinessWrapper},
+			steps: []step{
+				{name: "before_start", want: true},
+				{name: "running", state: running, want: true},
+				{name: "stopped", state: stopped, want: true},
+			},
+		},
+		{
+			name: "Process",
+			cfg:  ReadinessConfig{Policy: ReadinessProcess},
+			steps: []step{
+				{name: "before_start", want: false},
+				{name: "starting", state: starting, want: false},
+				{name: "started", state: running, want: true},
+				{name: "status_update", state: running, want: true},
+				{name: "backoff", state: stopped, want: false},
+				{name: "restarted", state: restarted, want: true},
+				{name: "stopped", state: stopped, want: false},
+			},
+		},
+		{
+			name: "Process_Delay",
+			cfg:  ReadinessConfig{Policy: ReadinessProcess, Delay: time.Minute},
+			steps: []step{
+				{name: "starting", state: starting, want: false},
+				{name: "started", state: running, want: false},
+				{name: "delay_elapsed", elapsed: true, want: true},
+				{name: "status_update", state: running, want: true},
+				{name: "backoff", state: stopped, want: false},
+				{name: "restarted", state: restarted, want: false},
+				{name: "delay_elapsed_again", elapsed: true, want: true},
+			},
+		},
+		{
+			name: "Process_After_check",
+			cfg:  ReadinessConfig{Policy: ReadinessProcess, AfterCheck: true},
+			steps: []step{
+				{name: "check_before_start", result: success, want: false},
+				{name: "starting", state: starting, want: false},
+				{name: "check_while_starting", result: success, want: false},
+				{name: "started", state: running, want: true},
+				{name: "check_failed", result: failure, want: true},
+				{name: "backoff", state: stopped, want: false},
+				{name: "restarted", state: restarted, want: false},
+				{name: "initial_result", result: initial, want: false},
+				{name: "failed_check", result: failure, want: false},
+				{name: "successful_check", result: success, want: true},
+			},
+		},
+		{
+			name: "Process_Delay_After_check",
+			cfg:  ReadinessConfig{Policy: ReadinessProcess, Delay: time.Minute, AfterCheck: true},
+			steps: []step{
+				{name: "started", state: running, want: false},
+				{name: "successful_check", result: success, want: false},
+				{name: "delay_elapsed", elapsed: true, want: true},
+				{name: "stopped", state: stopped, want: false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReadinessTracker(tt.cfg)
+			defer r.timer.Stop()
+
+			for _, s := range tt.steps {
+				switch {
+				case s.state != nil:
+					r.update(*s.state)
+				case s.result != nil:
+					r.check(*s.result)
+				case s.elapsed:
+					r.delayed = true
+				}
+
+				if got := r.isReady(); got != s.want {
+					t.Errorf("%s: expected the readiness %t, got %t", s.name, s.want, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_server_do_Readiness(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		childReady:    make(chan bool),
+		events:        make(chan ServerEvent, 1),
+		externalAlive: make(chan bool),
+		pingChannel:   make(chan bool),
+		updateCheck:   make(chan health.Result),
+		updateProcess: make(chan ProcessState),
+		updateReady:   make(chan bool),
+	}
+	WithReadiness(ReadinessConfig{Policy: ReadinessProcess, Delay: 50 * time.Millisecond, AfterCheck: true})(s)
+
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	// every state is sent twice, to wait for the first one to be handled
+	sendState := func(state ProcessState) {
+		s.updateProcess <- state
+		s.updateProcess <- state
+	}
+
+	s.updateReady <- true
+	sendState(ProcessState{Pid: 1234, Started: true})
+
+	if s.IsReady() {
+		t.Errorf("the process must not be ready before the delay")
+	}
+
+	s.updateCheck <- health.Result{Name: "check", Healthy: true, Probed: true}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if !s.IsReady() {
+		t.Errorf("the process must be ready after the delay and the health check")
+	}
+
+	// the process is waiting to be restarted
+	sendState(ProcessState{})
+
+	if s.IsReady() {
+		t.Errorf("the process must not be ready while it's not running")
+	}
+
+	cancel()
+	<-serverDone
+}
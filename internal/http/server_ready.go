@@ -0,0 +1,17 @@
+package http
+
+// WithWaitChildReady marks the wrapped process as not ready until it
+// declares itself ready, after every start; by default the process is
+// ready until it declares the opposite.
+func WithWaitChildReady() ServerOption {
+	return func(s *server) {
+		s.waitChildReady = true
+	}
+}
+
+// ChildReady returns the channel used to update the readiness
+// declared by the wrapped process; the server is ready only if both
+// the wrapper and the wrapped process are ready.
+func (s *server) ChildReady() chan<- bool {
+	return s.childReady
+}
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_server_ReadyHandlers(t *testing.T) {
+	s := &server{childReady: make(chan bool, 1)}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    bool
+	}{
+		{name: "Set", handler: s.ReadySetHandler, want: true},
+		{name: "Unset", handler: s.ReadyUnsetHandler, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, httptest.NewRequest("POST", "/ready/"+tt.name, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+
+			if got := <-s.childReady; got != tt.want {
+				t.Errorf("expected the readiness %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_server_do_ChildReady(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	tests := []struct {
+		name           string
+		waitChildReady bool
+	}{
+		{name: "Ready_by_default"},
+		{name: "Wait_child_ready", waitChildReady: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			s := &server{
+				childReady:     make(chan bool),
+				events:         make(chan ServerEvent, 1),
+				externalAlive:  make(chan bool),
+				pingChannel:    make(chan bool),
+				updateProcess:  make(chan ProcessState),
+				updateReady:    make(chan bool),
+				waitChildReady: tt.waitChildReady,
+			}
+
+			serverError := make(chan error)
+			serverDone := make(chan struct{})
+			go s.do(ctx, serverError, serverDone)
+
+			// every update is sent twice, to wait for the first one to
+			// be handled
+			send := func(c chan bool, value bool) {
+				c <- value
+				c <- value
+			}
+
+			sendState := func(state ProcessState) {
+				s.updateProcess <- state
+				s.updateProcess <- state
+			}
+
+			if s.IsReady() {
+				t.Errorf("the server must not be ready before it starts")
+			}
+
+			send(s.updateReady, true)
+			sendState(ProcessState{Started: true, Pid: 1234})
+
+			if s.IsReady() != !tt.waitChildReady {
+				t.Errorf("after start: expected the readiness %t, got %t", !tt.waitChildReady, s.IsReady())
+			}
+
+			send(s.childReady, true)
+
+			if !s.IsReady() {
+				t.Errorf("the server must be ready when the child is ready")
+			}
+
+			send(s.childReady, false)
+
+			if s.IsReady() {
+				t.Errorf("the server must not be ready when the child is not ready")
+			}
+
+			// the wrapper readiness is still required
+			send(s.childReady, true)
+			send(s.updateReady, false)
+
+			if s.IsReady() {
+				t.Errorf("the server must not be ready when the wrapper is not ready")
+			}
+
+			send(s.updateReady, true)
+			send(s.childReady, !tt.waitChildReady)
+
+			// the readiness of the child is reset when it stops
+			sendState(ProcessState{Started: false})
+
+			if s.IsReady() != !tt.waitChildReady {
+				t.Errorf("after stop: expected the readiness %t, got %t", !tt.waitChildReady, s.IsReady())
+			}
+
+			cancel()
+			<-serverDone
+		})
+	}
+}
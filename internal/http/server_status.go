@@ -0,0 +1,352 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// StatusVersion is the version of the document returned by /status,
+// it's increased on every incompatible change of the document.
+const StatusVersion = 1
+
+// maxStatusHistory is the number of state transitions kept by the
+// server, the oldest ones are dropped.
+const maxStatusHistory = 50
+
+// ProcessExit describes how an execution of the wrapped process ended.
+type ProcessExit struct {
+	Time       time.Time
+	ExitStatus int
+	// Signal is the name of the signal which killed the process,
+	// empty if the process exited.
+	Signal string
+	// Cause is a short machine-readable reason, like exit or signal.
+	Cause  string
+	Reason string
+}
+
+// Transition is a change of the state of the wrapped process, of its
+// liveness, of its readiness or of the maintenance mode.
+type Transition struct {
+	Time time.Time `json:"time"`
+	// Subject is what changed: process, liveness, readiness or
+	// maintenance; admin records the actions of the admin API.
+	Subject string `json:"subject"`
+	State   string `json:"state"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// StatusConfig is the part of the configuration reported by /status
+// which is not known by the server.
+type StatusConfig struct {
+	Version        string
+	Path           string
+	RestartMode    string
+	StopTimeout    time.Duration
+	StartupTimeout time.Duration
+}
+
+// WithStatusConfig adds the configuration of the wrapper to the
+// document returned by /status.
+func WithStatusConfig(cfg StatusConfig) ServerOption {
+	return func(s *server) {
+		s.statusConfig = cfg
+	}
+}
+
+type statusDocument struct {
+	Version     int               `json:"version"`
+	Time        time.Time         `json:"time"`
+	Wrapper     statusWrapper     `json:"wrapper"`
+	Process     statusProcess     `json:"process"`
+	Alive       bool              `json:"alive"`
+	Ready       bool              `json:"ready"`
+	Started     bool              `json:"started"`
+	Liveness    []CheckStatus     `json:"liveness"`
+	Readiness   []CheckStatus     `json:"readiness"`
+	Ping        statusPing        `json:"ping"`
+	Progress    *statusProgress   `json:"progress,omitempty"`
+	Heartbeats  []statusHeartbeat `json:"heartbeats,omitempty"`
+	Maintenance statusMaintenance `json:"maintenance"`
+	History     []Transition      `json:"history"`
+}
+
+type statusWrapper struct {
+	Version       string       `json:"version,omitempty"`
+	StartTime     time.Time    `json:"start_time"`
+	UptimeSeconds float64      `json:"uptime_seconds"`
+	Config        statusConfig `json:"config"`
+}
+
+type statusConfig struct {
+	Path                  string  `json:"path,omitempty"`
+	RestartMode           string  `json:"restart_mode,omitempty"`
+	StopTimeoutSeconds    float64 `json:"stop_timeout_seconds"`
+	StartupTimeoutSeconds float64 `json:"startup_timeout_seconds"`
+	StallTimeoutSeconds   float64 `json:"stall_timeout_seconds"`
+	PingToken             bool    `json:"ping_token"`
+	Readiness             string  `json:"readiness"`
+	ReadinessDelaySeconds float64 `json:"readiness_delay_seconds"`
+	ReadinessAfterCheck   bool    `json:"readiness_after_check"`
+	WaitChildReady        bool    `json:"wait_child_ready"`
+	GRPCAddress           string  `json:"grpc_address,omitempty"`
+	HeartbeatFile         string  `json:"heartbeat_file,omitempty"`
+	MaintenanceFile       string  `json:"maintenance_file,omitempty"`
+}
+
+type statusProcess struct {
+	State string `json:"state"`
+	// Status is the free-form status reported by the process
+	Status                string      `json:"status,omitempty"`
+	Pid                   int         `json:"pid,omitempty"`
+	Started               bool        `json:"started"`
+	StartTime             *time.Time  `json:"start_time,omitempty"`
+	UptimeSeconds         float64     `json:"uptime_seconds"`
+	Restarts              int         `json:"restarts"`
+	RestartBackoffSeconds float64     `json:"restart_backoff_seconds"`
+	LastExit              *statusExit `json:"last_exit,omitempty"`
+}
+
+type statusExit struct {
+	Time   time.Time `json:"time"`
+	Code   int       `json:"code"`
+	Signal string    `json:"signal,omitempty"`
+	Cause  string    `json:"cause"`
+	Reason string    `json:"reason"`
+}
+
+type statusPing struct {
+	LastPing             *time.Time `json:"last_ping,omitempty"`
+	SecondsSinceLastPing *float64   `json:"seconds_since_last_ping,omitempty"`
+	TimeoutSeconds       float64    `json:"timeout_seconds"`
+	// the counters of the rejected pings, with the ping tokens
+	StaleTokens           *uint64 `json:"stale_tokens,omitempty"`
+	UnauthenticatedTokens *uint64 `json:"unauthenticated_tokens,omitempty"`
+}
+
+type statusProgress struct {
+	Value            uint64    `json:"value"`
+	LastChange       time.Time `json:"last_change"`
+	UnchangedSeconds float64   `json:"unchanged_seconds"`
+	Stalled          bool      `json:"stalled"`
+}
+
+type statusHeartbeat struct {
+	Name           string     `json:"name"`
+	Required       bool       `json:"required"`
+	TimeoutSeconds float64    `json:"timeout_seconds"`
+	LastSeen       *time.Time `json:"last_seen,omitempty"`
+	Expired        bool       `json:"expired"`
+}
+
+type statusMaintenance struct {
+	Enabled   bool       `json:"enabled"`
+	Reason    string     `json:"reason,omitempty"`
+	EnabledBy string     `json:"enabled_by,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+}
+
+// timeOrNil returns nil for the zero time, so that it's omitted from
+// the document.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// failedReasons joins the reasons of the failed checks.
+func failedReasons(checks []CheckStatus) string {
+	var reasons []string
+
+	for _, check := range checks {
+		if !check.Healthy {
+			reasons = append(reasons, check.Name+": "+check.Reason)
+		}
+	}
+
+	return strings.Join(reasons, "; ")
+}
+
+// addTransition records a state transition, the caller must hold the
+// lock of the server.
+func (s *server) addTransition(subject, state, reason string) {
+	s.history = append(s.history, Transition{Time: time.Now(), Subject: subject, State: state, Reason: reason})
+
+	if len(s.history) > maxStatusHistory {
+		s.history = append([]Transition(nil), s.history[len(s.history)-maxStatusHistory:]...)
+	}
+}
+
+// setProcessState keeps the state of the process, a transition is
+// recorded when the process is started, completes its startup or
+// stops.
+func (s *server) setProcessState(state ProcessState) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	previous := s.processState
+	s.processState = state
+
+	if state.Restarts > previous.Restarts {
+		cause := "unknown"
+		if state.LastExit != nil {
+			cause = state.LastExit.Cause
+		}
+
+		if s.restarts == nil {
+			s.restarts = make(map[string]uint64)
+		}
+
+		s.restarts[cause] += uint64(state.Restarts - previous.Restarts)
+	}
+
+	if state.State == previous.State && state.Pid == previous.Pid && state.Started == previous.Started {
+		return
+	}
+
+	s.addTransition("process", state.State, state.Reason)
+}
+
+func (s *server) setLastPing(t time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.lastPing = t
+}
+
+func (s *server) setPingTimeout(timeout time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.pingTimeout = timeout
+}
+
+// History returns the recent state transitions, the oldest first.
+func (s *server) History() []Transition {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]Transition(nil), s.history...)
+}
+
+// status returns the document reported by /status, from a consistent
+// snapshot of the state of the server.
+func (s *server) status(now time.Time) statusDocument {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	doc := statusDocument{
+		Version: StatusVersion,
+		Time:    now,
+		Wrapper: statusWrapper{
+			Version:   s.statusConfig.Version,
+			StartTime: s.startTime,
+			Config: statusConfig{
+				Path:                  s.statusConfig.Path,
+				RestartMode:           s.statusConfig.RestartMode,
+				StopTimeoutSeconds:    s.statusConfig.StopTimeout.Seconds(),
+				StartupTimeoutSeconds: s.statusConfig.StartupTimeout.Seconds(),
+				StallTimeoutSeconds:   s.stallTimeout.Seconds(),
+				PingToken:             s.pingTokenRequired,
+				Readiness:             s.readiness.Policy.String(),
+				ReadinessDelaySeconds: s.readiness.Delay.Seconds(),
+				ReadinessAfterCheck:   s.readiness.AfterCheck,
+				WaitChildReady:        s.waitChildReady,
+				GRPCAddress:           s.grpcAddress,
+			},
+		},
+		Process: statusProcess{
+			State:                 s.processState.State,
+			Status:                s.processStatus,
+			Pid:                   s.processState.Pid,
+			Started:               s.isStarted,
+			StartTime:             timeOrNil(s.processState.StartTime),
+			Restarts:              s.processState.Restarts,
+			RestartBackoffSeconds: s.processState.RestartDelay.Seconds(),
+		},
+		Alive:     s.isAlive,
+		Ready:     s.isReady,
+		Started:   s.isStarted,
+		Liveness:  append([]CheckStatus{}, s.liveness...),
+		Readiness: append([]CheckStatus{}, s.readinessChecks...),
+		Ping: statusPing{
+			LastPing:       timeOrNil(s.lastPing),
+			TimeoutSeconds: s.pingTimeout.Seconds(),
+		},
+		Maintenance: statusMaintenance{
+			Enabled:   s.maintenanceStatus.Enabled,
+			Reason:    s.maintenanceStatus.Reason,
+			EnabledBy: s.maintenanceStatus.EnabledBy,
+			Since:     timeOrNil(s.maintenanceStatus.Since),
+		},
+		History: append([]Transition{}, s.history...),
+	}
+
+	if !s.startTime.IsZero() {
+		doc.Wrapper.UptimeSeconds = now.Sub(s.startTime).Seconds()
+	}
+
+	if s.heartbeatFile != nil {
+		doc.Wrapper.Config.HeartbeatFile = s.heartbeatFile.path
+	}
+
+	if s.maintenanceFile != nil {
+		doc.Wrapper.Config.MaintenanceFile = s.maintenanceFile.path
+	}
+
+	if !s.processState.StartTime.IsZero() {
+		doc.Process.UptimeSeconds = now.Sub(s.processState.StartTime).Seconds()
+	}
+
+	if exit := s.processState.LastExit; exit != nil {
+		doc.Process.LastExit = &statusExit{Time: exit.Time, Code: exit.ExitStatus, Signal: exit.Signal, Cause: exit.Cause, Reason: exit.Reason}
+	}
+
+	if !s.lastPing.IsZero() {
+		since := now.Sub(s.lastPing).Seconds()
+		doc.Ping.SecondsSinceLastPing = &since
+	}
+
+	if s.pingTokenRequired {
+		stale, unauthenticated := s.pingTokenStatus.Stale, s.pingTokenStatus.Unauthenticated
+		doc.Ping.StaleTokens, doc.Ping.UnauthenticatedTokens = &stale, &unauthenticated
+	}
+
+	if s.progressStatus.Reported {
+		doc.Progress = &statusProgress{
+			Value:            s.progressStatus.Value,
+			LastChange:       s.progressStatus.LastChange,
+			UnchangedSeconds: now.Sub(s.progressStatus.LastChange).Seconds(),
+			Stalled:          s.progressStatus.Stalled,
+		}
+	}
+
+	for _, h := range s.heartbeatsStatus {
+		doc.Heartbeats = append(doc.Heartbeats, statusHeartbeat{
+			Name:           h.Name,
+			Required:       h.Required,
+			TimeoutSeconds: h.Timeout.Seconds(),
+			LastSeen:       timeOrNil(h.LastSeen),
+			Expired:        h.Expired,
+		})
+	}
+
+	return doc
+}
+
+// StatusHandler reports the state of the wrapper and of the wrapped
+// process as a JSON document.
+func (s *server) StatusHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(s.status(time.Now())); err != nil {
+		logger.Errorf("cannot write response from /status handler: %s", err)
+	}
+}
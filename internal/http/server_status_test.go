@@ -0,0 +1,181 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func Test_server_setProcessState(t *testing.T) {
+	s := &server{}
+
+	steps := []ProcessState{
+		{State: "running", Pid: 1234, Reason: "started"},
+		// a change of the status reported by the process is not a transition
+		{State: "running", Pid: 1234, Reason: "started", Status: "loading"},
+		{State: "running", Pid: 1234, Reason: "startup completed", Started: true},
+		{State: "error", Reason: "exited with status 1", RestartDelay: time.Second},
+		{State: "running", Pid: 1235, Reason: "started", Restarts: 1},
+	}
+
+	for _, state := range steps {
+		s.setProcessState(state)
+	}
+
+	var got []string
+	for _, transition := range s.History() {
+		got = append(got, fmt.Sprintf("%s %s: %s", transition.Subject, transition.State, transition.Reason))
+	}
+
+	want := []string{
+		"process running: started",
+		"process running: startup completed",
+		"process error: exited with status 1",
+		"process running: started",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the history %q, got %q", want, got)
+	}
+}
+
+func Test_server_addTransition(t *testing.T) {
+	s := &server{}
+
+	for i := 0; i < maxStatusHistory+10; i++ {
+		s.addTransition("process", "running", fmt.Sprint(i))
+	}
+
+	history := s.History()
+	if len(history) != maxStatusHistory {
+		t.Fatalf("expected %d transitions, got %d", maxStatusHistory, len(history))
+	}
+
+	if first, last := history[0].Reason, history[len(history)-1].Reason; first != "10" || last != fmt.Sprint(maxStatusHistory+9) {
+		t.Errorf("expected the most recent transitions, got %s to %s", first, last)
+	}
+}
+
+func Test_server_StatusHandler(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		childReady:        make(chan bool),
+		events:            make(chan ServerEvent, 1),
+		externalAlive:     make(chan bool),
+		maintenance:       make(chan bool, 1),
+		pingChannel:       make(chan bool),
+		pingInterval:      10 * time.Second,
+		progress:          make(chan uint64),
+		startTime:         time.Now().Add(-1 * time.Minute),
+		updateMaintenance: make(chan MaintenanceStatus),
+		updateProcess:     make(chan ProcessState),
+		updateReady:       make(chan bool),
+	}
+	WithStatusConfig(StatusConfig{Version: "v1.2.3", Path: "/bin/app", RestartMode: "always", StopTimeout: 30 * time.Second})(s)
+	WithStallTimeout(1 * time.Minute)(s)
+
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	startTime := time.Now().Add(-5 * time.Second)
+	exit := &ProcessExit{Time: startTime, ExitStatus: 137, Signal: "SIGKILL", Reason: "killed by SIGKILL"}
+	state := ProcessState{State: "running", Reason: "started", Pid: 1234, Started: true, Restarts: 1, StartTime: startTime, LastExit: exit}
+
+	// every update is sent twice, to wait for the first one to be handled
+	s.updateReady <- true
+	s.updateReady <- true
+	s.updateProcess <- state
+	s.updateProcess <- state
+	s.externalAlive <- true
+	s.externalAlive <- true
+	s.pingChannel <- true
+	s.progress <- 42
+	s.progress <- 42
+	s.updateMaintenance <- MaintenanceStatus{Enabled: true, Reason: "upgrade", EnabledBy: "alice"}
+	s.updateMaintenance <- MaintenanceStatus{Enabled: true, Reason: "upgrade", EnabledBy: "alice"}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.StatusHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/status", nil))
+
+	cancel()
+	<-serverDone
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var doc statusDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Version != StatusVersion || doc.Wrapper.Version != "v1.2.3" || doc.Wrapper.UptimeSeconds < 60 {
+		t.Errorf("unexpected wrapper status %d %+v", doc.Version, doc.Wrapper)
+	}
+
+	wantConfig := statusConfig{
+		Path:                "/bin/app",
+		RestartMode:         "always",
+		StopTimeoutSeconds:  30,
+		StallTimeoutSeconds: 60,
+		Readiness:           "wrapper",
+	}
+
+	if doc.Wrapper.Config != wantConfig {
+		t.Errorf("expected the configuration %+v, got %+v", wantConfig, doc.Wrapper.Config)
+	}
+
+	if p := doc.Process; p.State != "running" || p.Pid != 1234 || !p.Started || p.Restarts != 1 || p.UptimeSeconds < 5 {
+		t.Errorf("unexpected process status %+v", p)
+	}
+
+	if p := doc.Process; p.LastExit == nil || p.LastExit.Code != 137 || p.LastExit.Signal != "SIGKILL" {
+		t.Errorf("unexpected last exit %+v", p.LastExit)
+	}
+
+	if !doc.Alive || doc.Ready || !doc.Started {
+		t.Errorf("expected an alive process, not ready during the maintenance, got alive %t, ready %t", doc.Alive, doc.Ready)
+	}
+
+	if doc.Ping.LastPing == nil || doc.Ping.SecondsSinceLastPing == nil || doc.Ping.TimeoutSeconds != 10 {
+		t.Errorf("unexpected ping status %+v", doc.Ping)
+	}
+
+	if doc.Progress == nil || doc.Progress.Value != 42 || doc.Progress.Stalled {
+		t.Errorf("unexpected progress %+v", doc.Progress)
+	}
+
+	if !doc.Maintenance.Enabled || doc.Maintenance.EnabledBy != "alice" {
+		t.Errorf("unexpected maintenance %+v", doc.Maintenance)
+	}
+
+	var got []string
+	for _, transition := range doc.History {
+		got = append(got, transition.Subject+" "+transition.State)
+	}
+
+	want := []string{"readiness ready", "process running", "liveness alive", "maintenance enabled", "readiness not ready"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the history %q, got %q", want, got)
+	}
+}
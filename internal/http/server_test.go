@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"github.com/gandalfmagic/liveness-wrapper/internal/health"
 	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
 	"net/http"
 	"os"
@@ -219,6 +220,246 @@ func Test_server_do(t *testing.T) {
 	})
 }
 
+func Test_server_do_Checks(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		events:        make(chan ServerEvent, 1),
+		externalAlive: make(chan bool),
+		pingChannel:   make(chan bool),
+		updateCheck:   make(chan health.Result),
+		updateProcess: make(chan ProcessState),
+		updateReady:   make(chan bool),
+	}
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	s.updateReady <- true
+	s.externalAlive <- true
+
+	// waiting for the status to be updated
+	time.Sleep(1 * time.Millisecond)
+
+	if !s.IsAlive() || !s.IsReady() {
+		t.Errorf("expected alive and ready, got alive %v, ready %v", s.IsAlive(), s.IsReady())
+	}
+
+	tests := []struct {
+		name      string
+		result    health.Result
+		wantAlive bool
+		wantReady bool
+	}{
+		{
+			name:      "ready_check_unhealthy",
+			result:    health.Result{Name: "ready", Target: health.TargetReady, Healthy: false},
+			wantAlive: true,
+			wantReady: false,
+		},
+		{
+			name:      "alive_check_healthy",
+			result:    health.Result{Name: "alive", Target: health.TargetAlive, Healthy: true},
+			wantAlive: true,
+			wantReady: false,
+		},
+		{
+			name:      "ready_check_healthy",
+			result:    health.Result{Name: "ready", Target: health.TargetReady, Healthy: true},
+			wantAlive: true,
+			wantReady: true,
+		},
+		{
+			name:      "alive_check_unhealthy",
+			result:    health.Result{Name: "alive", Target: health.TargetAlive, Healthy: false},
+			wantAlive: false,
+			wantReady: true,
+		},
+		{
+			name:      "alive_check_healthy_again",
+			result:    health.Result{Name: "alive", Target: health.TargetAlive, Healthy: true},
+			wantAlive: true,
+			wantReady: true,
+		},
+	}
+	for _, tt := range tests {
+		s.UpdateCheck() <- tt.result
+
+		// waiting for the status to be updated
+		time.Sleep(1 * time.Millisecond)
+
+		if s.IsAlive() != tt.wantAlive {
+			t.Errorf("%s: isAlive expected %v, got %v", tt.name, tt.wantAlive, s.IsAlive())
+		}
+
+		if s.IsReady() != tt.wantReady {
+			t.Errorf("%s: isReady expected %v, got %v", tt.name, tt.wantReady, s.IsReady())
+		}
+	}
+
+	// the process state must not override the checks
+	s.UpdateCheck() <- health.Result{Name: "alive", Target: health.TargetAlive, Healthy: false}
+	s.externalAlive <- true
+
+	// waiting for the status to be updated
+	time.Sleep(1 * time.Millisecond)
+
+	if s.IsAlive() {
+		t.Errorf("isAlive must be false with an unhealthy check")
+	}
+
+	cancel()
+	<-serverDone
+}
+
+func Test_server_do_Startup(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		events:        make(chan ServerEvent, 1),
+		externalAlive: make(chan bool),
+		pingChannel:   make(chan bool),
+		pingInterval:  100 * time.Millisecond,
+		updateProcess: make(chan ProcessState),
+		updateReady:   make(chan bool),
+	}
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	if s.IsStarted() != false {
+		t.Errorf("isStarted must be false: got %v", s.IsStarted())
+	}
+
+	// a ping is a startup signal for the wrapper
+	s.pingChannel <- true
+
+	select {
+	case event := <-s.Events():
+		if event != ServerEventStartupSignal {
+			t.Errorf("expected event %v, got %v", ServerEventStartupSignal, event)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("expected a startup signal event")
+	}
+
+	// the server must not block if nobody reads the events
+	s.pingChannel <- true
+	s.pingChannel <- true
+
+	// the wrapper marks the process as started
+	s.UpdateProcess() <- ProcessState{Started: true}
+	// waiting for the status of isStarted to be updated
+	time.Sleep(1 * time.Millisecond)
+
+	if s.IsStarted() != true {
+		t.Errorf("isStarted must be true: got %v", s.IsStarted())
+	}
+
+	s.UpdateProcess() <- ProcessState{Started: false}
+	// waiting for the status of isStarted to be updated
+	time.Sleep(1 * time.Millisecond)
+
+	if s.IsStarted() != false {
+		t.Errorf("isStarted must be false: got %v", s.IsStarted())
+	}
+
+	cancel()
+	<-serverDone
+}
+
+func Test_server_do_ProcessState(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		events:        make(chan ServerEvent, 1),
+		externalAlive: make(chan bool),
+		pingChannel:   make(chan bool),
+		pingInterval:  50 * time.Millisecond,
+		updateProcess: make(chan ProcessState),
+		updateReady:   make(chan bool),
+	}
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	s.externalAlive <- true
+
+	// the process changes its status and the ping timeout
+	s.UpdateProcess() <- ProcessState{Started: true, Status: "loading", PingTimeout: 300 * time.Millisecond}
+
+	// the original timeout is expired
+	time.Sleep(150 * time.Millisecond)
+
+	if !s.IsAlive() {
+		t.Errorf("isAlive must be true before the new ping timeout")
+	}
+
+	if s.ProcessStatus() != "loading" {
+		t.Errorf("expected the process status %q, got %q", "loading", s.ProcessStatus())
+	}
+
+	// a ping restarts the new timeout
+	s.Ping() <- true
+
+	time.Sleep(150 * time.Millisecond)
+
+	if !s.IsAlive() {
+		t.Errorf("isAlive must be true after a ping")
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if s.IsAlive() {
+		t.Errorf("isAlive must be false after the new ping timeout")
+	}
+
+	// a state without a status clears it
+	s.UpdateProcess() <- ProcessState{Started: true}
+	// waiting for the status to be updated
+	time.Sleep(1 * time.Millisecond)
+
+	if s.ProcessStatus() != "" {
+		t.Errorf("expected an empty process status, got %q", s.ProcessStatus())
+	}
+
+	// a state without a ping timeout restores the configured one
+	s.Ping() <- true
+
+	time.Sleep(100 * time.Millisecond)
+
+	if s.IsAlive() {
+		t.Errorf("isAlive must be false after the configured ping timeout")
+	}
+
+	cancel()
+	<-serverDone
+}
+
 func TestServer(t *testing.T) {
 	t.Run("Graceful_shutdown", func(t *testing.T) {
 		logger.Configure(os.Stdout, "test", "ERROR")
@@ -238,6 +479,24 @@ func TestServer(t *testing.T) {
 		_, _, server2Done := server2.Start(ctx)
 		<-server2Done
 
+		cancel()
+		<-serverDone
+	})
+	t.Run("Listening_event", func(t *testing.T) {
+		logger.Configure(os.Stdout, "test", "ERROR")
+		ctx, cancel := context.WithCancel(context.Background())
+		server := NewServer("127.0.0.1:6060", 15*time.Second, 100*time.Millisecond)
+		_, _, serverDone := server.Start(ctx)
+
+		select {
+		case event := <-server.Events():
+			if event != ServerEventListening {
+				t.Errorf("expected event %v, got %v", ServerEventListening, event)
+			}
+		case <-time.After(1 * time.Second):
+			t.Errorf("expected a listening event")
+		}
+
 		cancel()
 		<-serverDone
 	})
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// PingTokenHeader is the header with the ping token, as an alternative
+// to the token query parameter.
+const PingTokenHeader = "X-Liveness-Wrapper-Token"
+
+// PingTokenStatus counts the pings rejected because of their token.
+type PingTokenStatus struct {
+	// Stale is the number of pings with the token of a previous
+	// generation of the process, or sent while it's not running.
+	Stale uint64
+	// Unauthenticated is the number of pings without a token.
+	Unauthenticated uint64
+}
+
+// WithPingToken enables the ping tokens: the pings are accepted only
+// if they carry the token of the running process, set in the
+// ProcessState.
+func WithPingToken() ServerOption {
+	return func(s *server) {
+		s.pingTokenRequired = true
+	}
+}
+
+func (s *server) setPingToken(token string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.pingToken = token
+}
+
+// checkPingToken returns true if the ping r carries the current token,
+// otherwise it writes the error response and counts the rejected ping.
+func (s *server) checkPingToken(handler string, w http.ResponseWriter, r *http.Request) bool {
+	if !s.pingTokenRequired {
+		return true
+	}
+
+	token := r.Header.Get(PingTokenHeader)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+
+	s.mux.Lock()
+
+	if token == "" {
+		s.pingTokenStatus.Unauthenticated++
+		count := s.pingTokenStatus.Unauthenticated
+		s.mux.Unlock()
+
+		logger.Warnf("ignoring a ping on %s from %s without a token (%d unauthenticated pings)", handler, r.RemoteAddr, count)
+		writeToResponse(handler, http.StatusUnauthorized, w)
+
+		return false
+	}
+
+	if s.pingToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.pingToken)) != 1 {
+		s.pingTokenStatus.Stale++
+		count := s.pingTokenStatus.Stale
+		s.mux.Unlock()
+
+		logger.Warnf("ignoring a ping on %s from %s with a stale token (%d stale pings)", handler, r.RemoteAddr, count)
+		writeToResponse(handler, http.StatusForbidden, w)
+
+		return false
+	}
+
+	s.mux.Unlock()
+
+	return true
+}
+
+// PingTokenStatus returns the number of pings rejected because of
+// their token.
+func (s *server) PingTokenStatus() PingTokenStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.pingTokenStatus
+}
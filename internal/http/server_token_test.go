@@ -0,0 +1,150 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func Test_server_PingHandler_Token(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	s := &server{pingChannel: make(chan bool, 1)}
+	WithPingToken()(s)
+
+	tests := []struct {
+		name       string
+		current    string
+		target     string
+		header     string
+		statusCode int
+		want       PingTokenStatus
+	}{
+		{name: "Query_token", current: "abc", target: "/ping?token=abc", statusCode: http.StatusOK},
+		{name: "Header_token", current: "abc", target: "/ping", header: "abc", statusCode: http.StatusOK},
+		{name: "Header_first", current: "abc", target: "/ping?token=old", header: "abc", statusCode: http.StatusOK},
+		{name: "No_token", current: "abc", target: "/ping", statusCode: http.StatusUnauthorized, want: PingTokenStatus{Unauthenticated: 1}},
+		{name: "Stale_token", current: "abc", target: "/ping?token=old", statusCode: http.StatusForbidden, want: PingTokenStatus{Unauthenticated: 1, Stale: 1}},
+		{name: "Not_running", target: "/ping?token=abc", statusCode: http.StatusForbidden, want: PingTokenStatus{Unauthenticated: 1, Stale: 2}},
+		{name: "Not_running_No_token", target: "/ping", statusCode: http.StatusUnauthorized, want: PingTokenStatus{Unauthenticated: 2, Stale: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.setPingToken(tt.current)
+
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set(PingTokenHeader, tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.PingHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.statusCode)
+			}
+
+			select {
+			case <-s.pingChannel:
+				if tt.statusCode != http.StatusOK {
+					t.Errorf("no ping was expected")
+				}
+			default:
+				if tt.statusCode == http.StatusOK {
+					t.Errorf("a ping was expected")
+				}
+			}
+
+			if got := s.PingTokenStatus(); got != tt.want {
+				t.Errorf("expected the rejected pings %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_server_NamedPingHandler_Token(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	worker, _ := NewHeartbeat(HeartbeatConfig{Name: "worker", Timeout: 1 * time.Minute})
+
+	s := &server{namedPing: make(chan string, 1)}
+	WithHeartbeats(worker)(s)
+	WithPingToken()(s)
+
+	s.setPingToken("abc")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(s.NamedPingHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/ping/worker?token=old", nil))
+
+	if rr.Code != http.StatusForbidden || len(s.namedPing) != 0 {
+		t.Errorf("expected a stale ping to be rejected, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(s.NamedPingHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/ping/worker?token=abc", nil))
+
+	if rr.Code != http.StatusOK || len(s.namedPing) != 1 {
+		t.Errorf("expected a ping of worker, got %v", rr.Code)
+	}
+}
+
+func Test_server_do_PingToken(t *testing.T) {
+	// mock the server shutdown function
+	oldHttpServerShutdown := httpServerShutdown
+	httpServerShutdown = func(context.Context, *http.Server, time.Duration) {}
+
+	defer func() {
+		httpServerShutdown = oldHttpServerShutdown
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &server{
+		events:        make(chan ServerEvent, 1),
+		externalAlive: make(chan bool),
+		pingChannel:   make(chan bool),
+		updateProcess: make(chan ProcessState),
+		updateReady:   make(chan bool),
+	}
+	WithPingToken()(s)
+
+	serverError := make(chan error)
+	serverDone := make(chan struct{})
+	go s.do(ctx, serverError, serverDone)
+
+	isValid := func(token string) bool {
+		rr := httptest.NewRecorder()
+		s.checkPingToken("/ping", rr, httptest.NewRequest("GET", "/ping?token="+token, nil))
+
+		return rr.Code == http.StatusOK
+	}
+
+	// every state is sent twice, to wait for the first one to be handled
+	s.UpdateProcess() <- ProcessState{Started: true, Token: "first"}
+	s.UpdateProcess() <- ProcessState{Started: true, Token: "first"}
+
+	if !isValid("first") {
+		t.Errorf("the token of the running process must be accepted")
+	}
+
+	// the process is restarted
+	s.UpdateProcess() <- ProcessState{Started: false}
+	s.UpdateProcess() <- ProcessState{Started: true, Token: "second"}
+	s.UpdateProcess() <- ProcessState{Started: true, Token: "second"}
+
+	if isValid("first") {
+		t.Errorf("the token of the previous process must be rejected")
+	}
+
+	if !isValid("second") {
+		t.Errorf("the token of the new process must be accepted")
+	}
+
+	cancel()
+	<-serverDone
+}
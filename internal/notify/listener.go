@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// EnvSocket is the environment variable with the path of the socket
+// where the sd_notify messages are sent.
+const EnvSocket = "NOTIFY_SOCKET"
+
+// EnvWatchdogUsec is the environment variable with the timeout of the
+// watchdog, in microseconds; the process should send WATCHDOG=1 at
+// least once in this time.
+const EnvWatchdogUsec = "WATCHDOG_USEC"
+
+// maxMessageSize is the maximum size of a datagram, systemd accepts
+// messages up to the size of a page.
+const maxMessageSize = 4096
+
+// Listener receives the sd_notify messages sent by the wrapped process.
+type Listener interface {
+	Start(ctx context.Context) <-chan Message
+	Path() string
+	Close() error
+}
+
+type listener struct {
+	conn *net.UnixConn
+	dir  string
+	path string
+}
+
+// Listen creates a unix datagram socket receiving the sd_notify
+// messages, in a new temporary directory; the socket and the
+// directory are removed when the listener is stopped, or closed if
+// it's never started.
+func Listen() (Listener, error) {
+	dir, err := os.MkdirTemp("", "liveness-wrapper-")
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+
+		return nil, err
+	}
+
+	return &listener{
+		conn: conn,
+		dir:  dir,
+		path: path,
+	}, nil
+}
+
+// Path returns the path of the socket, to be passed to the wrapped
+// process in the NOTIFY_SOCKET environment variable.
+func (l *listener) Path() string {
+	return l.path
+}
+
+// Close closes the socket, and removes it with its directory.
+func (l *listener) Close() error {
+	err := l.conn.Close()
+
+	if rmErr := os.RemoveAll(l.dir); err == nil {
+		err = rmErr
+	}
+
+	return err
+}
+
+func (l *listener) do(ctx context.Context, messages chan<- Message) {
+	buf := make([]byte, maxMessageSize)
+
+	for {
+		n, err := l.conn.Read(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Errorf("cannot read the sd_notify socket %s: %s", l.path, err)
+			}
+
+			return
+		}
+
+		msg := ParseMessage(buf[:n])
+
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Start receives the sd_notify messages until ctx is done, the
+// returned channel receives a Message for every datagram.
+func (l *listener) Start(ctx context.Context) <-chan Message {
+	messages := make(chan Message)
+
+	go l.do(ctx, messages)
+
+	go func() {
+		<-ctx.Done()
+
+		_ = l.Close()
+	}()
+
+	return messages
+}
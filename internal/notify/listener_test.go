@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListener_Start(t *testing.T) {
+	l, err := Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages := l.Start(ctx)
+
+	conn, err := net.Dial("unixgram", l.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("READY=1\nSTATUS=ready")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-messages:
+		if want := (Message{Ready: true, Status: "ready", HasStatus: true}); msg != want {
+			t.Errorf("expected %+v, got %+v", want, msg)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("a message was expected")
+	}
+
+	cancel()
+
+	// the socket is removed when the listener is stopped
+	deadline := time.Now().Add(1 * time.Second)
+	for {
+		if _, err := os.Stat(l.Path()); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("the socket %s was expected to be removed", l.Path())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListener_Close(t *testing.T) {
+	l, err := Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a listener which is never started removes its directory
+	if err := l.Close(); err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Dir(l.Path())); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the directory of the socket %s was expected to be removed", l.Path())
+	}
+}
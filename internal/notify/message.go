@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+)
+
+// Message is a notification sent with the sd_notify protocol, only
+// the variables handled by the wrapper are parsed.
+type Message struct {
+	// Ready is set by READY=1, the process completed its startup.
+	Ready bool
+	// Stopping is set by STOPPING=1, the process is shutting down.
+	Stopping bool
+	// Watchdog is set by WATCHDOG=1, the process is still working.
+	Watchdog bool
+	// Status is the text sent with STATUS=, HasStatus is true if
+	// the variable was in the message, even if its text is empty.
+	Status    string
+	HasStatus bool
+	// WatchdogTimeout is set by WATCHDOG_USEC=, the new timeout of
+	// the watchdog.
+	WatchdogTimeout time.Duration
+	// ExtendTimeout is set by EXTEND_TIMEOUT_USEC=, the process asks
+	// for more time to complete its startup.
+	ExtendTimeout time.Duration
+}
+
+// ParseMessage parses a datagram sent with the sd_notify protocol,
+// made of newline separated VARIABLE=value assignments.
+func ParseMessage(data []byte) Message {
+	var msg Message
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			logger.Debugf("invalid sd_notify assignment: %q", line)
+			continue
+		}
+
+		switch name {
+		case "READY":
+			msg.Ready = value == "1"
+		case "STOPPING":
+			msg.Stopping = value == "1"
+		case "WATCHDOG":
+			msg.Watchdog = value == "1"
+		case "STATUS":
+			msg.Status = value
+			msg.HasStatus = true
+		case "WATCHDOG_USEC":
+			msg.WatchdogTimeout = parseUsec(name, value)
+		case "EXTEND_TIMEOUT_USEC":
+			msg.ExtendTimeout = parseUsec(name, value)
+		default:
+			logger.Debugf("ignoring the sd_notify variable %s", name)
+		}
+	}
+
+	return msg
+}
+
+func parseUsec(name, value string) time.Duration {
+	usec, err := strconv.ParseUint(value, 10, 63)
+	if err != nil {
+		logger.Debugf("invalid sd_notify value %s=%s", name, value)
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
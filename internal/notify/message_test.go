@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Message
+	}{
+		{name: "empty", data: "", want: Message{}},
+		{name: "ready", data: "READY=1", want: Message{Ready: true}},
+		{name: "ready_not_set", data: "READY=0", want: Message{}},
+		{name: "stopping", data: "STOPPING=1\n", want: Message{Stopping: true}},
+		{name: "watchdog", data: "WATCHDOG=1", want: Message{Watchdog: true}},
+		{
+			name: "status",
+			data: "STATUS=loading the data: 50%",
+			want: Message{Status: "loading the data: 50%", HasStatus: true},
+		},
+		{name: "empty_status", data: "STATUS=", want: Message{HasStatus: true}},
+		{
+			name: "timeouts",
+			data: "WATCHDOG_USEC=5000000\nEXTEND_TIMEOUT_USEC=1500",
+			want: Message{WatchdogTimeout: 5 * time.Second, ExtendTimeout: 1500 * time.Microsecond},
+		},
+		{name: "invalid_timeout", data: "WATCHDOG_USEC=5s", want: Message{}},
+		{
+			name: "many_variables",
+			data: "READY=1\nSTATUS=ready\nMAINPID=1234\ninvalid\nWATCHDOG=1\n",
+			want: Message{Ready: true, Watchdog: true, Status: "ready", HasStatus: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMessage([]byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvWatchdogPid is the environment variable with the pid of the
+// process expected to send the watchdog keep-alive messages.
+const EnvWatchdogPid = "WATCHDOG_PID"
+
+// Sender sends sd_notify messages to the service manager running the
+// wrapper, e.g. systemd with a Type=notify unit.
+type Sender interface {
+	// Send sends a message made of VARIABLE=value assignments.
+	Send(assignments ...string) error
+	// WatchdogTimeout returns the timeout of the watchdog of the
+	// service manager, or 0 if it's disabled.
+	WatchdogTimeout() time.Duration
+	Close() error
+}
+
+type sender struct {
+	conn            *net.UnixConn
+	watchdogTimeout time.Duration
+}
+
+// NewSender returns a Sender writing to the socket in path, which can
+// be an abstract socket if it starts with "@".
+func NewSender(path string, watchdogTimeout time.Duration) (Sender, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sender{conn: conn, watchdogTimeout: watchdogTimeout}, nil
+}
+
+// SenderFromEnv returns a Sender to the socket in NOTIFY_SOCKET, or nil
+// if the variable is not set. The variables of the protocol are removed
+// from the environment, so that they are not inherited by the wrapped
+// process.
+func SenderFromEnv() (Sender, error) {
+	path := os.Getenv(EnvSocket)
+	watchdogTimeout := watchdogTimeoutFromEnv()
+
+	for _, name := range []string{EnvSocket, EnvWatchdogUsec, EnvWatchdogPid} {
+		_ = os.Unsetenv(name)
+	}
+
+	if path == "" {
+		return nil, nil
+	}
+
+	return NewSender(path, watchdogTimeout)
+}
+
+// watchdogTimeoutFromEnv reads the timeout of the watchdog from the
+// environment, it's 0 if the watchdog is addressed to another process.
+func watchdogTimeoutFromEnv() time.Duration {
+	if pid := os.Getenv(EnvWatchdogPid); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	value := os.Getenv(EnvWatchdogUsec)
+	if value == "" {
+		return 0
+	}
+
+	return parseUsec(EnvWatchdogUsec, value)
+}
+
+func (s *sender) Send(assignments ...string) error {
+	_, err := s.conn.Write([]byte(strings.Join(assignments, "\n")))
+
+	return err
+}
+
+func (s *sender) WatchdogTimeout() time.Duration {
+	return s.watchdogTimeout
+}
+
+func (s *sender) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenTestSocket creates a unix datagram socket receiving the
+// messages of a Sender.
+func listenTestSocket(t *testing.T) (*net.UnixConn, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn, path
+}
+
+func TestSenderFromEnv(t *testing.T) {
+	t.Run("Not_set", func(t *testing.T) {
+		t.Setenv(EnvSocket, "")
+
+		s, err := SenderFromEnv()
+		if err != nil || s != nil {
+			t.Errorf("SenderFromEnv() = %v, %v, expected no sender", s, err)
+		}
+	})
+
+	t.Run("Missing_socket", func(t *testing.T) {
+		t.Setenv(EnvSocket, filepath.Join(t.TempDir(), "missing.sock"))
+
+		if _, err := SenderFromEnv(); err == nil {
+			t.Errorf("SenderFromEnv() an error was expected")
+		}
+	})
+
+	tests := []struct {
+		name        string
+		watchdogPid string
+		want        time.Duration
+	}{
+		{name: "Watchdog", want: 2 * time.Second},
+		{name: "Watchdog_pid", watchdogPid: strconv.Itoa(os.Getpid()), want: 2 * time.Second},
+		{name: "Watchdog_other_pid", watchdogPid: "1", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, path := listenTestSocket(t)
+
+			t.Setenv(EnvSocket, path)
+			t.Setenv(EnvWatchdogUsec, "2000000")
+			t.Setenv(EnvWatchdogPid, tt.watchdogPid)
+
+			s, err := SenderFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if got := s.WatchdogTimeout(); got != tt.want {
+				t.Errorf("WatchdogTimeout() = %s, want %s", got, tt.want)
+			}
+
+			// the variables are not inherited by the wrapped process
+			for _, name := range []string{EnvSocket, EnvWatchdogUsec, EnvWatchdogPid} {
+				if value, ok := os.LookupEnv(name); ok {
+					t.Errorf("the variable %s was expected to be removed, got %q", name, value)
+				}
+			}
+
+			if err := s.Send("READY=1", "STATUS=running"); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, maxMessageSize)
+
+			_ = conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := string(buf[:n]); got != "READY=1\nSTATUS=running" {
+				t.Errorf("expected the message %q, got %q", "READY=1\nSTATUS=running", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package procfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultRoot is the mount point of the proc filesystem.
+const DefaultRoot = "/proc"
+
+// tcpListen is the state of a listening socket in /proc/<pid>/net/tcp.
+const tcpListen = "0A"
+
+// userHZ is the number of clock ticks per second of the times in
+// /proc/<pid>/stat, it's 100 on all the architectures supported by go.
+const userHZ = 100
+
+// positions of the fields of /proc/<pid>/stat, counting from the
+// state of the process.
+const (
+	statUtime   = 11
+	statStime   = 12
+	statThreads = 17
+	statVsize   = 20
+	statRss     = 21
+)
+
+var ErrInvalidFormat = errors.New("invalid procfs format")
+
+// FS reads the information about the processes from a proc
+// filesystem, the root can be changed to use a fake one in the tests.
+type FS struct {
+	root string
+}
+
+// NewFS returns a FS reading the proc filesystem mounted on root.
+func NewFS(root string) FS {
+	return FS{root: root}
+}
+
+func (fs FS) path(elem ...string) string {
+	return filepath.Join(append([]string{fs.root}, elem...)...)
+}
+
+// statFields returns the fields of /proc/<pid>/stat following the
+// name of the command, starting from the state of the process.
+func (fs FS) statFields(pid int) ([]string, error) {
+	data, err := os.ReadFile(fs.path(strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// the name of the command is in parentheses, and it can
+	// contain spaces, the other fields follow the last one
+	stat := string(data)
+
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("%w: %s/stat", ErrInvalidFormat, strconv.Itoa(pid))
+	}
+
+	return strings.Fields(stat[end+1:]), nil
+}
+
+// ParentPid returns the pid of the parent of the process pid.
+func (fs FS) ParentPid(pid int) (int, error) {
+	fields, err := fs.statFields(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	// the fields after the name are the state and the parent pid
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("%w: %s/stat", ErrInvalidFormat, strconv.Itoa(pid))
+	}
+
+	return strconv.Atoi(fields[1])
+}
+
+// Stat is a sample of the resources used by a process.
+type Stat struct {
+	CPUSeconds          float64
+	Threads             int
+	VirtualMemoryBytes  uint64
+	ResidentMemoryBytes uint64
+}
+
+// ReadStat samples the resources used by the process pid.
+func (fs FS) ReadStat(pid int) (Stat, error) {
+	fields, err := fs.statFields(pid)
+	if err != nil {
+		return Stat{}, err
+	}
+
+	// the positions of utime, stime, num_threads, vsize and rss,
+	// counting from the state of the process
+	if len(fields) <= statRss {
+		return Stat{}, fmt.Errorf("%w: %s/stat", ErrInvalidFormat, strconv.Itoa(pid))
+	}
+
+	var values [statRss + 1]uint64
+
+	for _, i := range []int{statUtime, statStime, statThreads, statVsize, statRss} {
+		if values[i], err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+			return Stat{}, fmt.Errorf("%w: %s/stat", ErrInvalidFormat, strconv.Itoa(pid))
+		}
+	}
+
+	return Stat{
+		CPUSeconds:          float64(values[statUtime]+values[statStime]) / userHZ,
+		Threads:             int(values[statThreads]),
+		VirtualMemoryBytes:  values[statVsize],
+		ResidentMemoryBytes: values[statRss] * uint64(os.Getpagesize()),
+	}, nil
+}
+
+// OpenFiles returns the number of files opened by the process pid.
+func (fs FS) OpenFiles(pid int) (int, error) {
+	entries, err := os.ReadDir(fs.path(strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
+
+// Tree returns pid and the pids of all its descendants.
+func (fs FS) Tree(pid int) ([]int, error) {
+	entries, err := os.ReadDir(fs.root)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// the process may end while reading the list
+		parent, err := fs.ParentPid(child)
+		if err != nil {
+			continue
+		}
+
+		children[parent] = append(children[parent], child)
+	}
+
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+
+	return tree, nil
+}
+
+// IsDescendant returns true if pid is ancestor or one of its
+// descendants.
+func (fs FS) IsDescendant(pid, ancestor int) (bool, error) {
+	for pid > 0 {
+		if pid == ancestor {
+			return true, nil
+		}
+
+		parent, err := fs.ParentPid(pid)
+		if err != nil {
+			return false, err
+		}
+
+		pid = parent
+	}
+
+	return false, nil
+}
+
+// SocketInodes returns the inodes of the sockets opened by pid.
+func (fs FS) SocketInodes(pid int) (map[uint64]struct{}, error) {
+	dir := fs.path(strconv.Itoa(pid), "fd")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	inodes := make(map[uint64]struct{})
+
+	for _, entry := range entries {
+		// the target of the link is "socket:[<inode>]"
+		target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil || !strings.HasPrefix(target, "socket:[") || !strings.HasSuffix(target, "]") {
+			continue
+		}
+
+		inode, err := strconv.ParseUint(target[len("socket:["):len(target)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		inodes[inode] = struct{}{}
+	}
+
+	return inodes, nil
+}
+
+// ListeningPorts returns the tcp ports in LISTEN state, read from the
+// net/tcp and net/tcp6 tables of pid, mapped to the inodes of their
+// sockets; the tables contain the sockets of all the processes in the
+// same network namespace of pid.
+func (fs FS) ListeningPorts(pid int) (map[uint64]int, error) {
+	ports := make(map[uint64]int)
+
+	for _, table := range []string{"tcp", "tcp6"} {
+		err := fs.readListeningPorts(fs.path(strconv.Itoa(pid), "net", table), ports)
+		if errors.Is(err, os.ErrNotExist) && table == "tcp6" {
+			// ipv6 may be disabled
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ports, nil
+}
+
+func (fs FS) readListeningPorts(path string, ports map[uint64]int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	// skip the header
+	scanner.Scan()
+
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 { //nolint:gomnd
+			return fmt.Errorf("%w: %s", ErrInvalidFormat, path)
+		}
+
+		if fields[3] != tcpListen {
+			continue
+		}
+
+		// the local address is "<hex ip>:<hex port>"
+		_, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidFormat, path)
+		}
+
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidFormat, path)
+		}
+
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidFormat, path)
+		}
+
+		ports[inode] = int(port)
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,328 @@
+package procfs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+const tcpHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+// fakeProcess writes the files of a process in a fake proc filesystem.
+func fakeProcess(t *testing.T, root string, pid, ppid int, inodes ...uint64) {
+	t.Helper()
+
+	dir := filepath.Join(root, strconv.Itoa(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	stat := strconv.Itoa(pid) + " (a command) S " + strconv.Itoa(ppid) + " 1 1 0 -1\n"
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("/dev/null", filepath.Join(dir, "fd", "0")); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, inode := range inodes {
+		target := "socket:[" + strconv.FormatUint(inode, 10) + "]"
+		if err := os.Symlink(target, filepath.Join(dir, "fd", strconv.Itoa(i+3))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fakeTCPTable writes the net/tcp or net/tcp6 table of a process.
+func fakeTCPTable(t *testing.T, root string, pid int, table string, lines ...string) {
+	t.Helper()
+
+	dir := filepath.Join(root, strconv.Itoa(pid), "net")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := tcpHeader
+	for _, line := range lines {
+		content += line + "\n"
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, table), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFS_ParentPid(t *testing.T) {
+	root := t.TempDir()
+	fakeProcess(t, root, 100, 1)
+
+	if err := os.MkdirAll(filepath.Join(root, "200"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "200", "stat"), []byte("200 no parentheses"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewFS(root)
+
+	tests := []struct {
+		name    string
+		pid     int
+		want    int
+		wantErr bool
+	}{
+		{name: "found", pid: 100, want: 1},
+		{name: "not_found", pid: 300, wantErr: true},
+		{name: "invalid_format", pid: 200, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.ParentPid(tt.pid)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParentPid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParentPid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFS_Tree(t *testing.T) {
+	root := t.TempDir()
+	fakeProcess(t, root, 1, 0)
+	fakeProcess(t, root, 100, 1)
+	fakeProcess(t, root, 101, 100)
+	fakeProcess(t, root, 102, 101)
+	fakeProcess(t, root, 103, 100)
+	fakeProcess(t, root, 200, 1)
+
+	// not a process
+	if err := os.MkdirAll(filepath.Join(root, "net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewFS(root).Tree(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Ints(got)
+
+	if want := []int{100, 101, 102, 103}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tree() = %v, want %v", got, want)
+	}
+}
+
+func TestFS_IsDescendant(t *testing.T) {
+	root := t.TempDir()
+	fakeProcess(t, root, 1, 0)
+	fakeProcess(t, root, 100, 1)
+	fakeProcess(t, root, 101, 100)
+	fakeProcess(t, root, 102, 101)
+	fakeProcess(t, root, 200, 1)
+
+	fs := NewFS(root)
+
+	tests := []struct {
+		name     string
+		pid      int
+		ancestor int
+		want     bool
+		wantErr  bool
+	}{
+		{name: "same_process", pid: 100, ancestor: 100, want: true},
+		{name: "child", pid: 101, ancestor: 100, want: true},
+		{name: "grandchild", pid: 102, ancestor: 100, want: true},
+		{name: "parent", pid: 100, ancestor: 101, want: false},
+		{name: "other_tree", pid: 200, ancestor: 100, want: false},
+		{name: "no_ancestor", pid: 101, ancestor: 0, want: false},
+		{name: "missing_process", pid: 300, ancestor: 100, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fs.IsDescendant(tt.pid, tt.ancestor)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IsDescendant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("IsDescendant() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFS_SocketInodes(t *testing.T) {
+	root := t.TempDir()
+	fakeProcess(t, root, 100, 1, 1234, 5678)
+
+	got, err := NewFS(root).SocketInodes(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[uint64]struct{}{1234: {}, 5678: {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SocketInodes() = %v, want %v", got, want)
+	}
+
+	if _, err := NewFS(root).SocketInodes(200); err == nil {
+		t.Errorf("SocketInodes() an error was expected for a missing process")
+	}
+}
+
+func TestFS_ListeningPorts(t *testing.T) {
+	t.Run("tcp_and_tcp6", func(t *testing.T) {
+		root := t.TempDir()
+		fakeTCPTable(t, root, 100, "tcp",
+			// 127.0.0.1:8080 listening
+			"   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1234 1 0000000000000000 100 0 0 10 0",
+			// 127.0.0.1:8080 connected to 127.0.0.1:40000
+			"   1: 0100007F:1F90 0100007F:9C40 01 00000000:00000000 00:00000000 00000000  1000        0 1235 1 0000000000000000 100 0 0 10 0",
+		)
+		fakeTCPTable(t, root, 100, "tcp6",
+			// [::]:9090 listening
+			"   0: 00000000000000000000000000000000:2382 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 5678 1 0000000000000000 100 0 0 10 0",
+		)
+
+		got, err := NewFS(root).ListeningPorts(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := map[uint64]int{1234: 8080, 5678: 9090}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ListeningPorts() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("tcp6_disabled", func(t *testing.T) {
+		root := t.TempDir()
+		fakeTCPTable(t, root, 100, "tcp",
+			"   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1234 1 0000000000000000 100 0 0 10 0",
+		)
+
+		got, err := NewFS(root).ListeningPorts(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := map[uint64]int{1234: 8080}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ListeningPorts() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("invalid_format", func(t *testing.T) {
+		root := t.TempDir()
+		fakeTCPTable(t, root, 100, "tcp", "   0: 0100007F:1F90 00000000:0000 0A")
+
+		if _, err := NewFS(root).ListeningPorts(100); !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("ListeningPorts() error = %v, expected %v", err, ErrInvalidFormat)
+		}
+	})
+
+	t.Run("missing_process", func(t *testing.T) {
+		if _, err := NewFS(t.TempDir()).ListeningPorts(100); err == nil {
+			t.Errorf("ListeningPorts() an error was expected")
+		}
+	})
+}
+
+func TestFS_real(t *testing.T) {
+	fs := NewFS(DefaultRoot)
+	pid := os.Getpid()
+
+	if _, err := os.Stat(DefaultRoot); err != nil {
+		t.Skip("the proc filesystem is not available")
+	}
+
+	ppid, err := fs.ParentPid(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ppid != os.Getppid() {
+		t.Errorf("ParentPid() = %v, want %v", ppid, os.Getppid())
+	}
+
+	tree, err := fs.Tree(ppid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+
+	for _, treePid := range tree {
+		if treePid == pid {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("Tree() the pid %d is missing from %v", pid, tree)
+	}
+}
+
+func TestFS_ReadStat(t *testing.T) {
+	root := t.TempDir()
+
+	// the fields of a real stat, with a command name containing spaces
+	// and parentheses
+	stat := "100 (a (b) c) S 1 100 100 0 -1 4194560 1000 0 0 0 250 50 0 0 20 0 4 0 12345 104857600 2560 18446744073709551615\n"
+	if err := os.MkdirAll(filepath.Join(root, "100"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "100", "stat"), []byte(stat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a process with a short stat
+	fakeProcess(t, root, 200, 1)
+
+	fs := NewFS(root)
+
+	got, err := fs.ReadStat(100)
+	if err != nil {
+		t.Fatalf("ReadStat() error = %v", err)
+	}
+
+	want := Stat{
+		CPUSeconds:          3,
+		Threads:             4,
+		VirtualMemoryBytes:  104857600,
+		ResidentMemoryBytes: 2560 * uint64(os.Getpagesize()),
+	}
+
+	if got != want {
+		t.Errorf("ReadStat() = %+v, want %+v", got, want)
+	}
+
+	if _, err := fs.ReadStat(200); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("ReadStat() error = %v, want %v", err, ErrInvalidFormat)
+	}
+
+	if _, err := fs.ReadStat(300); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadStat() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestFS_OpenFiles(t *testing.T) {
+	root := t.TempDir()
+	fakeProcess(t, root, 100, 1, 1001, 1002)
+
+	got, err := NewFS(root).OpenFiles(100)
+	if err != nil {
+		t.Fatalf("OpenFiles() error = %v", err)
+	}
+
+	if got != 3 {
+		t.Errorf("OpenFiles() = %d, want %d", got, 3)
+	}
+}
@@ -0,0 +1,134 @@
+// Package sigmask blocks signals in every thread of the wrapper, so
+// that they're only received with a signalfd, which reports their
+// sender, and starts the child processes without them blocked.
+package sigmask
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	mux sync.Mutex
+	// blocked are the signals blocked by Block, they're unblocked in
+	// the child processes.
+	blocked []syscall.Signal
+)
+
+// Set returns the set made of sigs.
+func Set(sigs ...syscall.Signal) unix.Sigset_t {
+	var set unix.Sigset_t
+
+	for _, sig := range sigs {
+		set.Val[(sig-1)/64] |= 1 << ((uint(sig) - 1) % 64)
+	}
+
+	return set
+}
+
+// IsBlocked returns true if sig is blocked in the current thread; once
+// Block returns, it's blocked in every thread of the process.
+func IsBlocked(sig syscall.Signal) (bool, error) {
+	var current unix.Sigset_t
+	if err := unix.PthreadSigmask(unix.SIG_BLOCK, nil, &current); err != nil {
+		return false, err
+	}
+
+	set := Set(sig)
+
+	return current.Val[(sig-1)/64]&set.Val[(sig-1)/64] != 0, nil
+}
+
+// Block blocks sig in every thread of the process. The go runtime
+// creates its threads with the signal mask of the process when it
+// started, so if sig is not blocked yet, the executable is executed
+// again, with the same arguments and environment, from a thread where
+// sig is blocked: Block doesn't return, unless the execution fails.
+// It must be called before the process changes its environment or
+// creates any file or socket, and sig must never be passed to
+// signal.Notify, which unblocks it.
+func Block(sig syscall.Signal) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	isBlocked, err := IsBlocked(sig)
+	if err != nil {
+		return err
+	}
+
+	if !isBlocked {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		set := Set(sig)
+		if err := unix.PthreadSigmask(unix.SIG_BLOCK, &set, nil); err != nil {
+			return err
+		}
+
+		// the signal mask of the thread is kept by execve
+		err = syscall.Exec(exe, os.Args, os.Environ())
+
+		_ = unix.PthreadSigmask(unix.SIG_UNBLOCK, &set, nil)
+
+		return fmt.Errorf("cannot execute %s again with %s blocked: %w", exe, unix.SignalName(sig), err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+
+	for _, b := range blocked {
+		if b == sig {
+			return nil
+		}
+	}
+
+	blocked = append(blocked, sig)
+
+	return nil
+}
+
+// Start starts cmd with the signals blocked by Block unblocked: a
+// child process inherits the signal mask of the thread starting it,
+// so cmd is started from a locked thread where they're unblocked.
+func Start(cmd *exec.Cmd) error {
+	mux.Lock()
+	sigs := blocked
+	mux.Unlock()
+
+	if len(sigs) == 0 {
+		return cmd.Start()
+	}
+
+	// while the signals are unblocked in the thread, they can be
+	// delivered to it; they're received by the go runtime, instead of
+	// applying their default action, which may terminate the wrapper
+	received := make(chan os.Signal, 1)
+	for _, sig := range sigs {
+		signal.Notify(received, sig)
+	}
+
+	defer signal.Stop(received)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	set := Set(sigs...)
+	if err := unix.PthreadSigmask(unix.SIG_UNBLOCK, &set, nil); err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = unix.PthreadSigmask(unix.SIG_BLOCK, &set, nil)
+	}()
+
+	return cmd.Start()
+}
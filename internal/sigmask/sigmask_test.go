@@ -0,0 +1,103 @@
+package sigmask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary is executed again with SIGUSR1 blocked
+	if err := Block(syscall.SIGUSR1); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(m.Run())
+}
+
+// blockedSignals returns the SigBlk mask in the status of a process.
+func blockedSignals(t *testing.T, status string) uint64 {
+	t.Helper()
+
+	for _, line := range strings.Split(status, "\n") {
+		if value, ok := strings.CutPrefix(line, "SigBlk:"); ok {
+			mask, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return mask
+		}
+	}
+
+	t.Fatalf("no SigBlk in %q", status)
+
+	return 0
+}
+
+// checkThreads checks that every thread of the process blocks SIGUSR1.
+func checkThreads(t *testing.T) {
+	t.Helper()
+
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, task := range tasks {
+		status, err := os.ReadFile("/proc/self/task/" + task.Name() + "/status")
+		if err != nil {
+			continue
+		}
+
+		if mask := blockedSignals(t, string(status)); mask&(1<<(syscall.SIGUSR1-1)) == 0 {
+			t.Errorf("SIGUSR1 is not blocked in the thread %s: %x", task.Name(), mask)
+		}
+	}
+}
+
+func TestBlock(t *testing.T) {
+	isBlocked, err := IsBlocked(syscall.SIGUSR1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isBlocked {
+		t.Errorf("SIGUSR1 is expected to be blocked")
+	}
+
+	checkThreads(t)
+
+	// a second call doesn't execute the process again
+	if err := Block(syscall.SIGUSR1); err != nil {
+		t.Errorf("no error was expected, got %s", err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	var output bytes.Buffer
+
+	cmd := exec.Command("/bin/cat", "/proc/self/status")
+	cmd.Stdout = &output
+
+	if err := Start(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if mask := blockedSignals(t, output.String()); mask&(1<<(syscall.SIGUSR1-1)) != 0 {
+		t.Errorf("SIGUSR1 is blocked in the child process: %x", mask)
+	}
+
+	// the signal is blocked again in the wrapper
+	checkThreads(t)
+}
@@ -0,0 +1,100 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+)
+
+// ControlCommand is an action on the wrapped process, requested from
+// outside of the wrapper.
+type ControlCommand int
+
+const (
+	// ControlRestart stops the running process with the stop sequence,
+	// and starts it again as soon as it exits.
+	ControlRestart ControlCommand = iota
+	// ControlStop stops the running process with the stop sequence,
+	// it's not restarted until a ControlStart or a ControlRestart.
+	ControlStop
+	// ControlStart starts the process if it's not running, even if the
+	// restarts are paused.
+	ControlStart
+	// ControlSignal sends a signal to the running process.
+	ControlSignal
+)
+
+func (c ControlCommand) String() string {
+	switch c {
+	case ControlRestart:
+		return "restart"
+	case ControlStop:
+		return "stop"
+	case ControlStart:
+		return "start"
+	case ControlSignal:
+		return "signal"
+	}
+
+	return "unknown"
+}
+
+// ControlAction is an action requested on the wrapped process.
+type ControlAction struct {
+	Command ControlCommand
+	// Signal is the signal sent by ControlSignal.
+	Signal syscall.Signal
+	// RequestedBy describes who requested the action, it's reported in
+	// the logs and in the reason of the exit.
+	RequestedBy string
+}
+
+var (
+	ErrNotRunning     = errors.New("the wrapped process is not running")
+	ErrAlreadyRunning = errors.New("the wrapped process is already running")
+	ErrStopping       = errors.New("the wrapped process is already stopping")
+	ErrExiting        = errors.New("the wrapper is exiting")
+)
+
+// controlRequest is a ControlAction waiting to be applied by the
+// wrapper loop, the result is sent on a buffered channel.
+type controlRequest struct {
+	action ControlAction
+	result chan error
+}
+
+// Control applies an action on the wrapped process, in the wrapper
+// loop, so that it doesn't race with the scheduled restarts. It
+// returns when the action is applied or refused: a restart or a stop
+// returns as soon as the stop sequence is started, without waiting for
+// the process to exit.
+func (p *wrapperHandler) Control(ctx context.Context, action ControlAction) error {
+	req := controlRequest{action: action, result: make(chan error, 1)}
+
+	select {
+	case p.control <- req:
+	case <-p.exited:
+		return ErrExiting
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopTimer stops the timer, discarding its expiration if it's not
+// received yet, so that it can be replaced.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func Test_wrapperHandler_do_Control(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	signals := filepath.Join(t.TempDir(), "signals")
+
+	// the process is never restarted on its own, only on request
+	p := &wrapperHandler{
+		arg:             []string{"-c", `trap "echo hup >> ` + signals + `" HUP; echo ready > ` + signals + `; while true; do sleep 0.01; done`},
+		control:         make(chan controlRequest),
+		exited:          make(chan struct{}),
+		path:            "/bin/sh",
+		restartInterval: 1 * time.Second,
+		restartMode:     WrapperRestartNever,
+		startupSignal:   make(chan struct{}, 1),
+		timeout:         1 * time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chanWrapperData := make(chan WrapperData)
+	chanWrapperDone := make(chan struct{})
+
+	go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+	// waitSignals waits for the content of the signals file
+	waitSignals := func(want string) {
+		t.Helper()
+
+		deadline := time.Now().Add(1 * time.Second)
+		for content, _ := os.ReadFile(signals); string(content) != want; content, _ = os.ReadFile(signals) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the signals file %q, got %q", want, content)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	control := func(command ControlCommand, sig syscall.Signal) error {
+		return p.Control(context.Background(), ControlAction{Command: command, Signal: sig, RequestedBy: "test"})
+	}
+
+	first := nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if first.WrapperStatus != WrapperStatusRunning {
+		t.Fatalf("after start: expected a running process, got %+v", first)
+	}
+
+	if err := control(ControlStart, 0); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("start: expected the error %v, got %v", ErrAlreadyRunning, err)
+	}
+
+	// the signal is trapped once the process is ready
+	waitSignals("ready\n")
+
+	if err := control(ControlSignal, syscall.SIGHUP); err != nil {
+		t.Errorf("signal: no error was expected, got %v", err)
+	}
+
+	waitSignals("ready\nhup\n")
+
+	// a restart stops the process, and starts it again right away
+	if err := control(ControlRestart, 0); err != nil {
+		t.Errorf("restart: no error was expected, got %v", err)
+	}
+
+	wd := nextWrapperData(t, chanWrapperData, 2*time.Second)
+	if wd.WrapperStatus != WrapperStatusStopped || wd.RestartDelay != 0 || wd.LastExit == nil || wd.LastExit.Cause != ExitCauseAdmin {
+		t.Fatalf("restart: expected a process stopped on request, got %+v (last exit: %+v)", wd, wd.LastExit)
+	}
+
+	if !strings.HasPrefix(wd.Reason, "restart requested by test, ") {
+		t.Errorf("restart: unexpected reason %q", wd.Reason)
+	}
+
+	wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if wd.WrapperStatus != WrapperStatusRunning || wd.Restarts != 1 || wd.Pid == first.Pid {
+		t.Fatalf("restart: expected a new process, got %+v", wd)
+	}
+
+	// a stop keeps the wrapper running, without the process
+	if err := control(ControlStop, 0); err != nil {
+		t.Errorf("stop: no error was expected, got %v", err)
+	}
+
+	wd = nextWrapperData(t, chanWrapperData, 2*time.Second)
+	if wd.WrapperStatus != WrapperStatusStopped || wd.Done || !strings.HasPrefix(wd.Reason, "stop requested by test, ") {
+		t.Fatalf("stop: expected a process stopped on request, got %+v", wd)
+	}
+
+	for _, command := range []ControlCommand{ControlStop, ControlSignal} {
+		if err := control(command, syscall.SIGHUP); !errors.Is(err, ErrNotRunning) {
+			t.Errorf("%s: expected the error %v, got %v", command, ErrNotRunning, err)
+		}
+	}
+
+	select {
+	case wd := <-chanWrapperData:
+		t.Fatalf("stop: the process must not be restarted, got %+v", wd)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := control(ControlStart, 0); err != nil {
+		t.Errorf("start: no error was expected, got %v", err)
+	}
+
+	wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if wd.WrapperStatus != WrapperStatusRunning || wd.Restarts != 2 {
+		t.Fatalf("start: expected a running process, got %+v", wd)
+	}
+
+	cancel()
+
+	for wd := range chanWrapperData {
+		if wd.Done {
+			break
+		}
+	}
+
+	<-chanWrapperDone
+
+	if err := control(ControlStart, 0); !errors.Is(err, ErrExiting) {
+		t.Errorf("after exit: expected the error %v, got %v", ErrExiting, err)
+	}
+}
+
+func Test_wrapperHandler_do_Control_Stopping(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	ready := filepath.Join(t.TempDir(), "ready")
+
+	// the process ignores SIGTERM, the stop sequence lasts until the
+	// timeout
+	p := &wrapperHandler{
+		arg:             []string{"-c", `trap "" TERM; echo ready > ` + ready + `; while true; do sleep 0.01; done`},
+		control:         make(chan controlRequest),
+		exited:          make(chan struct{}),
+		path:            "/bin/sh",
+		restartInterval: 1 * time.Second,
+		restartMode:     WrapperRestartNever,
+		startupSignal:   make(chan struct{}, 1),
+		timeout:         500 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chanWrapperData := make(chan WrapperData)
+	chanWrapperDone := make(chan struct{})
+
+	go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+	control := func(command ControlCommand, requestedBy string) error {
+		return p.Control(context.Background(), ControlAction{Command: command, RequestedBy: requestedBy})
+	}
+
+	if wd := nextWrapperData(t, chanWrapperData, 1*time.Second); wd.WrapperStatus != WrapperStatusRunning {
+		t.Fatalf("after start: expected a running process, got %+v", wd)
+	}
+
+	// the trap is set once the process is ready
+	deadline := time.Now().Add(1 * time.Second)
+	for _, err := os.Stat(ready); err != nil; _, err = os.Stat(ready) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the process is not ready: %s", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := control(ControlRestart, "alice"); err != nil {
+		t.Fatalf("restart: no error was expected, got %v", err)
+	}
+
+	// the requests during the stop sequence are refused
+	for _, command := range []ControlCommand{ControlStop, ControlRestart} {
+		if err := control(command, "bob"); !errors.Is(err, ErrStopping) {
+			t.Errorf("%s: expected the error %v, got %v", command, ErrStopping, err)
+		}
+	}
+
+	wd := nextWrapperData(t, chanWrapperData, 2*time.Second)
+	if wd.WrapperStatus != WrapperStatusStopped || !strings.HasPrefix(wd.Reason, "restart requested by alice, ") {
+		t.Fatalf("restart: expected a process stopped on the first request, got %+v", wd)
+	}
+
+	if wd = nextWrapperData(t, chanWrapperData, 1*time.Second); wd.WrapperStatus != WrapperStatusRunning {
+		t.Fatalf("restart: expected a new process, got %+v", wd)
+	}
+
+	cancel()
+
+	for wd := range chanWrapperData {
+		if wd.Done {
+			break
+		}
+	}
+
+	<-chanWrapperDone
+}
@@ -1,14 +1,38 @@
 package system
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// signalExitStatusBase is added to the number of the signal which
+// killed the wrapped process to compute its exit status, following
+// the convention used by the shells.
+const signalExitStatusBase = 128
+
+// exit statuses used by the shells when a command cannot be executed.
+const (
+	spawnExitStatusNotExecutable = 126
+	spawnExitStatusNotFound      = 127
+)
 
 type ProcessExitStatusError interface {
 	Error() string
 	ExitStatus() int
+	Signal() syscall.Signal
+	CoreDumped() bool
+	Reason() string
 }
 
 type processExitStatusError struct {
 	exitStatus byte
+	signal     syscall.Signal
+	coreDumped bool
 }
 
 func NewProcessExitStatusError(exitStatus int) ProcessExitStatusError {
@@ -17,10 +41,120 @@ func NewProcessExitStatusError(exitStatus int) ProcessExitStatusError {
 	}
 }
 
+// NewProcessSignalError returns the error of a process killed by
+// a signal, its exit status is 128 plus the number of the signal.
+func NewProcessSignalError(signal syscall.Signal, coreDumped bool) ProcessExitStatusError {
+	return &processExitStatusError{
+		exitStatus: byte(signalExitStatusBase + int(signal)),
+		signal:     signal,
+		coreDumped: coreDumped,
+	}
+}
+
 func (p *processExitStatusError) Error() string {
+	if p.signal != 0 {
+		return fmt.Sprintf("the process was %s", p.Reason())
+	}
+
 	return fmt.Sprintf("the process ended with exit status %d", p.exitStatus)
 }
 
 func (p *processExitStatusError) ExitStatus() int {
 	return int(p.exitStatus)
 }
+
+func (p *processExitStatusError) Signal() syscall.Signal {
+	return p.signal
+}
+
+func (p *processExitStatusError) CoreDumped() bool {
+	return p.coreDumped
+}
+
+// Reason returns a human-readable description of how the process
+// ended, like "exited with status 1" or "killed by SIGSEGV (core dumped)".
+func (p *processExitStatusError) Reason() string {
+	if p.signal == 0 {
+		return fmt.Sprintf("exited with status %d", p.exitStatus)
+	}
+
+	reason := "killed by " + SignalName(p.signal)
+	if p.coreDumped {
+		reason += " (core dumped)"
+	}
+
+	return reason
+}
+
+// SignalName returns the name of a signal, like SIGSEGV.
+func SignalName(signal syscall.Signal) string {
+	if name := unix.SignalName(signal); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("signal %d", int(signal))
+}
+
+type processSpawnError struct {
+	err        error
+	exitStatus byte
+	path       string
+}
+
+// NewProcessSpawnError returns the error of a process which cannot
+// be started, its exit status follows the convention used by the
+// shells: 127 if the executable is not found, 126 if it's found
+// but it cannot be executed.
+func NewProcessSpawnError(path string, err error) ProcessExitStatusError {
+	exitStatus := spawnExitStatusNotExecutable
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		exitStatus = spawnExitStatusNotFound
+	}
+
+	return &processSpawnError{
+		err:        err,
+		exitStatus: byte(exitStatus),
+		path:       path,
+	}
+}
+
+func (p *processSpawnError) Error() string {
+	return fmt.Sprintf("cannot start the process %s: %s", p.path, p.err)
+}
+
+func (p *processSpawnError) Unwrap() error {
+	return p.err
+}
+
+func (p *processSpawnError) ExitStatus() int {
+	return int(p.exitStatus)
+}
+
+func (p *processSpawnError) Signal() syscall.Signal {
+	return 0
+}
+
+func (p *processSpawnError) CoreDumped() bool {
+	return false
+}
+
+func (p *processSpawnError) Reason() string {
+	if p.exitStatus == spawnExitStatusNotFound {
+		return "not found"
+	}
+
+	return "cannot be executed"
+}
+
+// LookPath checks that the executable of the wrapped process exists and
+// it can be executed, searching it in the directories of the PATH
+// environment variable if it doesn't contain a slash; it returns the
+// path of the executable.
+func LookPath(path string) (string, error) {
+	found, err := exec.LookPath(path)
+	if err != nil {
+		return "", NewProcessSpawnError(path, err)
+	}
+
+	return found, nil
+}
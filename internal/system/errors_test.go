@@ -1,7 +1,13 @@
 package system
 
 import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"syscall"
 	"testing"
 )
 
@@ -19,6 +25,11 @@ func TestNewProcessExitStatusError(t *testing.T) {
 			args: args{exitStatus: 0},
 			want: &processExitStatusError{exitStatus: 0},
 		},
+		{
+			name: "255",
+			args: args{exitStatus: -1},
+			want: &processExitStatusError{exitStatus: 255},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -29,9 +40,41 @@ func TestNewProcessExitStatusError(t *testing.T) {
 	}
 }
 
+func TestNewProcessSignalError(t *testing.T) {
+	type args struct {
+		signal     syscall.Signal
+		coreDumped bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want ProcessExitStatusError
+	}{
+		{
+			name: "SIGTERM",
+			args: args{signal: syscall.SIGTERM},
+			want: &processExitStatusError{exitStatus: 143, signal: syscall.SIGTERM},
+		},
+		{
+			name: "SIGSEGV_core_dumped",
+			args: args{signal: syscall.SIGSEGV, coreDumped: true},
+			want: &processExitStatusError{exitStatus: 139, signal: syscall.SIGSEGV, coreDumped: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewProcessSignalError(tt.args.signal, tt.args.coreDumped); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewProcessSignalError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_processExitStatusError_Error(t *testing.T) {
 	type fields struct {
 		exitStatus byte
+		signal     syscall.Signal
+		coreDumped bool
 	}
 	tests := []struct {
 		name   string
@@ -43,11 +86,23 @@ func Test_processExitStatusError_Error(t *testing.T) {
 			fields: fields{exitStatus: 0},
 			want:   "the process ended with exit status 0",
 		},
+		{
+			name:   "SIGKILL",
+			fields: fields{exitStatus: 137, signal: syscall.SIGKILL},
+			want:   "the process was killed by SIGKILL",
+		},
+		{
+			name:   "SIGSEGV_core_dumped",
+			fields: fields{exitStatus: 139, signal: syscall.SIGSEGV, coreDumped: true},
+			want:   "the process was killed by SIGSEGV (core dumped)",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &processExitStatusError{
 				exitStatus: tt.fields.exitStatus,
+				signal:     tt.fields.signal,
+				coreDumped: tt.fields.coreDumped,
 			}
 			if got := p.Error(); got != tt.want {
 				t.Errorf("Error() = %v, want %v", got, tt.want)
@@ -82,3 +137,177 @@ func Test_processExitStatusError_ExitStatus(t *testing.T) {
 		})
 	}
 }
+
+func Test_processExitStatusError_Reason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  ProcessExitStatusError
+		want string
+	}{
+		{
+			name: "exit_status",
+			err:  NewProcessExitStatusError(10),
+			want: "exited with status 10",
+		},
+		{
+			name: "SIGSEGV",
+			err:  NewProcessSignalError(syscall.SIGSEGV, false),
+			want: "killed by SIGSEGV",
+		},
+		{
+			name: "SIGABRT_core_dumped",
+			err:  NewProcessSignalError(syscall.SIGABRT, true),
+			want: "killed by SIGABRT (core dumped)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Reason(); got != tt.want {
+				t.Errorf("Reason() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignalName(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal syscall.Signal
+		want   string
+	}{
+		{name: "SIGHUP", signal: syscall.SIGHUP, want: "SIGHUP"},
+		{name: "SIGUSR1", signal: syscall.SIGUSR1, want: "SIGUSR1"},
+		{name: "unknown", signal: syscall.Signal(200), want: "signal 200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignalName(tt.signal); got != tt.want {
+				t.Errorf("SignalName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProcessSpawnError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantExitStatus int
+		wantReason     string
+	}{
+		{
+			name:           "Not_found_in_PATH",
+			err:            &exec.Error{Name: "command", Err: exec.ErrNotFound},
+			wantExitStatus: 127,
+			wantReason:     "not found",
+		},
+		{
+			name:           "No_such_file",
+			err:            &fs.PathError{Op: "fork/exec", Path: "/command", Err: syscall.ENOENT},
+			wantExitStatus: 127,
+			wantReason:     "not found",
+		},
+		{
+			name:           "Permission_denied",
+			err:            &fs.PathError{Op: "fork/exec", Path: "/command", Err: syscall.EACCES},
+			wantExitStatus: 126,
+			wantReason:     "cannot be executed",
+		},
+		{
+			name:           "Exec_format_error",
+			err:            &fs.PathError{Op: "fork/exec", Path: "/command", Err: syscall.ENOEXEC},
+			wantExitStatus: 126,
+			wantReason:     "cannot be executed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewProcessSpawnError("/command", tt.err)
+
+			if got.ExitStatus() != tt.wantExitStatus {
+				t.Errorf("ExitStatus() = %v, want %v", got.ExitStatus(), tt.wantExitStatus)
+			}
+
+			if got.Reason() != tt.wantReason {
+				t.Errorf("Reason() = %v, want %v", got.Reason(), tt.wantReason)
+			}
+
+			if got.Signal() != 0 || got.CoreDumped() {
+				t.Errorf("a spawn error must not have a signal, got %v (core dumped: %v)", got.Signal(), got.CoreDumped())
+			}
+
+			if !errors.Is(got, tt.err) {
+				t.Errorf("the spawn error must wrap %v", tt.err)
+			}
+		})
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	notExecutable := filepath.Join(t.TempDir(), "not_executable.sh")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		want           string
+		wantExitStatus int
+	}{
+		{
+			name: "Relative_path",
+			path: filepath.Join(testDirectory, "test_int_no_err.sh"),
+			want: filepath.Join(testDirectory, "test_int_no_err.sh"),
+		},
+		{
+			name: "PATH_lookup",
+			path: "sh",
+		},
+		{
+			name:           "Not_found",
+			path:           filepath.Join(testDirectory, "command_not_found.sh"),
+			wantExitStatus: 127,
+		},
+		{
+			name:           "Not_found_in_PATH",
+			path:           "liveness-wrapper-command-not-found",
+			wantExitStatus: 127,
+		},
+		{
+			name:           "Not_executable",
+			path:           notExecutable,
+			wantExitStatus: 126,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LookPath(tt.path)
+
+			if tt.wantExitStatus == 0 {
+				if err != nil {
+					t.Fatalf("LookPath() unexpected error: %s", err)
+				}
+
+				if tt.want != "" && got != tt.want {
+					t.Errorf("LookPath() = %v, want %v", got, tt.want)
+				}
+
+				if got == "" {
+					t.Errorf("LookPath() returned an empty path")
+				}
+
+				return
+			}
+
+			var exitStatusError ProcessExitStatusError
+			if !errors.As(err, &exitStatusError) {
+				t.Fatalf("LookPath() error = %v, want a ProcessExitStatusError", err)
+			}
+
+			if exitStatusError.ExitStatus() != tt.wantExitStatus {
+				t.Errorf("LookPath() exit status = %v, want %v", exitStatusError.ExitStatus(), tt.wantExitStatus)
+			}
+		})
+	}
+}
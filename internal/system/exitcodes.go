@@ -0,0 +1,217 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type ExitCodeOutcome int
+
+const (
+	// ExitCodeError is the outcome of any non-zero exit code not
+	// matched by a rule: the process is marked as failed, and it's
+	// restarted only if the restart mode allows it.
+	ExitCodeError ExitCodeOutcome = iota
+	// ExitCodeSuccess handles the exit code like a zero exit code.
+	ExitCodeSuccess
+	// ExitCodeTransient marks the process as failed, and restarts it
+	// even if the restart mode is WrapperRestartNever.
+	ExitCodeTransient
+	// ExitCodeFatal marks the process as failed, and never restarts
+	// it, even if the restart mode is WrapperRestartAlways.
+	ExitCodeFatal
+	// ExitCodeIgnore restarts the process even if the restart mode is
+	// WrapperRestartNever, without marking it as failed.
+	ExitCodeIgnore
+)
+
+var (
+	ErrInvalidExitCodeRule = errors.New("invalid exit code rule")
+
+	exitCodeOutcomes = map[string]ExitCodeOutcome{
+		"success":   ExitCodeSuccess,
+		"transient": ExitCodeTransient,
+		"fatal":     ExitCodeFatal,
+		"ignore":    ExitCodeIgnore,
+	}
+)
+
+const maxExitCode = 255
+
+func (o ExitCodeOutcome) String() string {
+	switch o {
+	case ExitCodeError:
+		return "error"
+	case ExitCodeSuccess:
+		return "success"
+	case ExitCodeTransient:
+		return "transient"
+	case ExitCodeFatal:
+		return "fatal"
+	case ExitCodeIgnore:
+		return "ignore"
+	}
+
+	return "unknown"
+}
+
+// exitCodeRange is an inclusive range of exit codes.
+type exitCodeRange struct {
+	from int
+	to   int
+}
+
+func (r exitCodeRange) contains(exitStatus int) bool {
+	return exitStatus >= r.from && exitStatus <= r.to
+}
+
+// parseExitCodeRange parses a single exit code, like "3", or
+// an inclusive range of exit codes, like "64-78".
+func parseExitCodeRange(value string) (exitCodeRange, error) {
+	from, to, isRange := strings.Cut(value, "-")
+	if !isRange {
+		to = from
+	}
+
+	var r exitCodeRange
+
+	var err error
+
+	if r.from, err = parseExitCode(from); err != nil {
+		return r, err
+	}
+
+	if r.to, err = parseExitCode(to); err != nil {
+		return r, err
+	}
+
+	if r.from > r.to {
+		return r, fmt.Errorf("%w: the range %s is empty", ErrInvalidExitCodeRule, value)
+	}
+
+	return r, nil
+}
+
+func parseExitCode(value string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || code < 0 || code > maxExitCode {
+		return 0, fmt.Errorf("%w: %q is not an exit code between 0 and %d", ErrInvalidExitCodeRule, value, maxExitCode)
+	}
+
+	return code, nil
+}
+
+type exitCodeRule struct {
+	codes   exitCodeRange
+	outcome ExitCodeOutcome
+}
+
+// ExitCodeRules classifies the exit codes of the wrapped process,
+// the rules are evaluated in order, and the first one matching the
+// exit code is used.
+type ExitCodeRules []exitCodeRule
+
+// ParseExitCodeRules parses a list of rules in the form
+// "<code>[-<code>]:<outcome>", like "3:transient" or "64-78:fatal";
+// the outcome can be success, transient, fatal or ignore.
+func ParseExitCodeRules(rules []string) (ExitCodeRules, error) {
+	result := make(ExitCodeRules, 0, len(rules))
+
+	for _, rule := range rules {
+		codes, outcomeName, ok := strings.Cut(rule, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q must be in the form <code>[-<code>]:<outcome>", ErrInvalidExitCodeRule, rule)
+		}
+
+		r, err := parseExitCodeRange(codes)
+		if err != nil {
+			return nil, err
+		}
+
+		outcome, ok := exitCodeOutcomes[strings.ToLower(strings.TrimSpace(outcomeName))]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown outcome %q in %q", ErrInvalidExitCodeRule, outcomeName, rule)
+		}
+
+		result = append(result, exitCodeRule{codes: r, outcome: outcome})
+	}
+
+	return result, nil
+}
+
+// Classify returns the outcome of an exit code of the wrapped process.
+func (r ExitCodeRules) Classify(exitStatus int) ExitCodeOutcome {
+	for _, rule := range r {
+		if rule.codes.contains(exitStatus) {
+			return rule.outcome
+		}
+	}
+
+	if exitStatus == 0 {
+		return ExitCodeSuccess
+	}
+
+	return ExitCodeError
+}
+
+type exitCodeMapping struct {
+	codes      exitCodeRange
+	exitStatus int
+}
+
+// ExitCodeMap maps the exit codes of the wrapped process to the
+// exit codes used by the wrapper when it ends.
+type ExitCodeMap []exitCodeMapping
+
+// ParseExitCodeMap parses a list of mappings in the form
+// "<code>[-<code>]:<wrapper code>", like "3:0" or "64-78:1".
+func ParseExitCodeMap(mappings []string) (ExitCodeMap, error) {
+	result := make(ExitCodeMap, 0, len(mappings))
+
+	for _, mapping := range mappings {
+		codes, exitStatus, ok := strings.Cut(mapping, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q must be in the form <code>[-<code>]:<wrapper code>", ErrInvalidExitCodeRule, mapping)
+		}
+
+		r, err := parseExitCodeRange(codes)
+		if err != nil {
+			return nil, err
+		}
+
+		m := exitCodeMapping{codes: r}
+		if m.exitStatus, err = parseExitCode(exitStatus); err != nil {
+			return nil, err
+		}
+
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// Map returns the exit code of the wrapper for an exit code of the
+// wrapped process, if no mapping matches it, the same exit code is
+// returned.
+func (m ExitCodeMap) Map(exitStatus int) int {
+	for _, mapping := range m {
+		if mapping.codes.contains(exitStatus) {
+			return mapping.exitStatus
+		}
+	}
+
+	return exitStatus
+}
+
+// wrapperExitStatusError overrides the exit status of the error of
+// the wrapped process, with the one mapped by the ExitCodeMap.
+type wrapperExitStatusError struct {
+	ProcessExitStatusError
+	exitStatus int
+}
+
+func (e *wrapperExitStatusError) ExitStatus() int {
+	return e.exitStatus
+}
@@ -0,0 +1,126 @@
+package system
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseExitCodeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		want    map[int]ExitCodeOutcome
+		wantErr bool
+	}{
+		{
+			name:  "No_rules",
+			rules: nil,
+			want:  map[int]ExitCodeOutcome{0: ExitCodeSuccess, 1: ExitCodeError, 255: ExitCodeError},
+		},
+		{
+			name:  "Single_codes",
+			rules: []string{"3:transient", "75:transient", "2:ignore", "1:success", "0:fatal"},
+			want: map[int]ExitCodeOutcome{
+				0: ExitCodeFatal, 1: ExitCodeSuccess, 2: ExitCodeIgnore, 3: ExitCodeTransient, 4: ExitCodeError, 75: ExitCodeTransient,
+			},
+		},
+		{
+			name:  "Ranges_first_match_wins",
+			rules: []string{"75:transient", "64-78:fatal", "128-255:TRANSIENT"},
+			want: map[int]ExitCodeOutcome{
+				63: ExitCodeError, 64: ExitCodeFatal, 75: ExitCodeTransient, 78: ExitCodeFatal, 79: ExitCodeError, 139: ExitCodeTransient,
+			},
+		},
+		{
+			name:    "Missing_outcome",
+			rules:   []string{"3"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown_outcome",
+			rules:   []string{"3:retry"},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid_code",
+			rules:   []string{"three:fatal"},
+			wantErr: true,
+		},
+		{
+			name:    "Code_out_of_range",
+			rules:   []string{"256:fatal"},
+			wantErr: true,
+		},
+		{
+			name:    "Empty_range",
+			rules:   []string{"78-64:fatal"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseExitCodeRules(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExitCodeRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidExitCodeRule) {
+					t.Errorf("ParseExitCodeRules() error = %v, want ErrInvalidExitCodeRule", err)
+				}
+
+				return
+			}
+
+			for exitStatus, want := range tt.want {
+				if got := rules.Classify(exitStatus); got != want {
+					t.Errorf("Classify(%d) = %v, want %v", exitStatus, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseExitCodeMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []string
+		want     map[int]int
+		wantErr  bool
+	}{
+		{
+			name:     "No_mappings",
+			mappings: nil,
+			want:     map[int]int{0: 0, 3: 3, 139: 139},
+		},
+		{
+			name:     "Mappings",
+			mappings: []string{"3:0", "128-255:2", "1-255:1"},
+			want:     map[int]int{0: 0, 3: 0, 10: 1, 127: 1, 128: 2, 139: 2},
+		},
+		{
+			name:     "Missing_code",
+			mappings: []string{"3"},
+			wantErr:  true,
+		},
+		{
+			name:     "Invalid_wrapper_code",
+			mappings: []string{"3:-1"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseExitCodeMap(tt.mappings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExitCodeMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for exitStatus, want := range tt.want {
+				if got := m.Map(exitStatus); got != want {
+					t.Errorf("Map(%d) = %v, want %v", exitStatus, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package system
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// OutputStats counts the output written by the wrapped process since
+// the wrapper started; a stream is counted only if it's read by the
+// wrapper, e.g. a hidden stdout is not.
+type OutputStats struct {
+	StdOutLines uint64
+	StdOutBytes uint64
+	StdErrLines uint64
+	StdErrBytes uint64
+}
+
+// outputCounter is an io.Writer counting the lines and the bytes
+// written on it.
+type outputCounter struct {
+	bytes atomic.Uint64
+	lines atomic.Uint64
+}
+
+func (c *outputCounter) Write(p []byte) (int, error) {
+	c.bytes.Add(uint64(len(p)))
+	c.lines.Add(uint64(bytes.Count(p, []byte{'\n'})))
+
+	return len(p), nil
+}
+
+// OutputStats returns the number of lines and bytes written by the
+// wrapped process on its stdout and stderr.
+func (p *wrapperHandler) OutputStats() OutputStats {
+	return OutputStats{
+		StdOutLines: p.stdOutCounter.lines.Load(),
+		StdOutBytes: p.stdOutCounter.bytes.Load(),
+		StdErrLines: p.stdErrCounter.lines.Load(),
+		StdErrBytes: p.stdErrCounter.bytes.Load(),
+	}
+}
@@ -0,0 +1,60 @@
+package system
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
+	"github.com/gandalfmagic/liveness-wrapper/pkg/testconsole"
+)
+
+func Test_wrapperHandler_OutputStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		hideStdOut bool
+		want       OutputStats
+	}{
+		{
+			name: "Counted",
+			want: OutputStats{StdOutLines: 2, StdOutBytes: 5, StdErrLines: 1, StdErrBytes: 2},
+		},
+		{
+			name:       "Hidden_stdout",
+			hideStdOut: true,
+			want:       OutputStats{StdErrLines: 1, StdErrBytes: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+			p := &wrapperHandler{
+				arg:             []string{"-c", "echo a; echo bb; echo c >&2"},
+				hideStdOut:      tt.hideStdOut,
+				path:            "/bin/sh",
+				restartInterval: 10 * time.Millisecond,
+				restartMode:     WrapperRestartNever,
+				startupSignal:   make(chan struct{}, 1),
+				timeout:         1 * time.Second,
+			}
+
+			chanWrapperData := make(chan WrapperData)
+			chanWrapperDone := make(chan struct{})
+
+			go p.do(context.Background(), chanWrapperData, chanWrapperDone)
+
+			for wd := range chanWrapperData {
+				if wd.Done {
+					break
+				}
+			}
+
+			<-chanWrapperDone
+
+			if got := p.OutputStats(); got != tt.want {
+				t.Errorf("OutputStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,10 +2,15 @@ package system
 
 import (
 	"context"
+	"errors"
+	"io"
+	"os"
 	"os/exec"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/gandalfmagic/liveness-wrapper/internal/sigmask"
 	"github.com/gandalfmagic/liveness-wrapper/pkg/logger"
 )
 
@@ -17,6 +22,19 @@ const (
 	WrapperStatusError
 )
 
+func (s WrapperStatus) String() string {
+	switch s {
+	case WrapperStatusStopped:
+		return "stopped"
+	case WrapperStatusRunning:
+		return "running"
+	case WrapperStatusError:
+		return "error"
+	}
+
+	return "unknown"
+}
+
 type WrapperRestartMode int
 
 const (
@@ -25,34 +43,127 @@ const (
 	WrapperRestartAlways
 )
 
+func (m WrapperRestartMode) String() string {
+	switch m {
+	case WrapperRestartNever:
+		return "never"
+	case WrapperRestartOnError:
+		return "on-error"
+	case WrapperRestartAlways:
+		return "always"
+	}
+
+	return "unknown"
+}
+
 type WrapperConfiguration struct {
-	RestartMode  WrapperRestartMode
-	HideStdOut   bool
-	HideStdErr   bool
-	FailOnStdErr bool
-	Timeout      time.Duration
-	Path         string
+	RestartMode        WrapperRestartMode
+	HideStdOut         bool
+	HideStdErr         bool
+	FailOnStdErr       bool
+	Timeout            time.Duration
+	Path               string
+	StdErrLines        int
+	ExitCodes          ExitCodeRules
+	ExitCodeMap        ExitCodeMap
+	SpawnRetries       int
+	SpawnRetryInterval time.Duration
+	StartupTimeout     time.Duration
+	Env                []string
+	PingToken          bool
 }
 
 type WrapperData struct {
 	WrapperStatus WrapperStatus
 	Err           error
 	Done          bool
+	Restarts      int
+	StdErrTail    []string
+	Started       bool
+	Pid           int
+	// Token is the ping token of the running process, empty if the
+	// ping tokens are disabled or the process is not running.
+	Token string
+	// StartTime is the time the running process was started, zero if
+	// the process is not running.
+	StartTime time.Time
+	// LastExit describes how the previous execution of the process
+	// ended, nil until the process exits for the first time.
+	LastExit *ExitInfo
+	// RestartDelay is the time to wait before the process is started
+	// again, 0 if no restart is scheduled.
+	RestartDelay time.Duration
+	// Reason describes the change of state reported by the event.
+	Reason string
 }
 
+// causes of the end of an execution of the wrapped process.
+const (
+	ExitCauseExit           = "exit"
+	ExitCauseSignal         = "signal"
+	ExitCauseError          = "error"
+	ExitCauseStartupTimeout = "startup_timeout"
+	ExitCauseAdmin          = "admin"
+)
+
+// ExitInfo describes how an execution of the wrapped process ended.
+type ExitInfo struct {
+	Time       time.Time
+	ExitStatus int
+	// Signal is the name of the signal which killed the process,
+	// empty if the process exited.
+	Signal string
+	// Cause is one of the ExitCause constants.
+	Cause  string
+	Reason string
+}
+
+// ErrStartupTimeout is the error of a wrapped process which didn't
+// complete its startup within the startup timeout.
+var ErrStartupTimeout = errors.New("the process did not complete its startup in time")
+
 type WrapperHandler interface {
 	Start(ctx context.Context) (<-chan WrapperData, <-chan struct{})
+	StartupSignal() chan<- struct{}
+	ExtendStartup() chan<- time.Duration
+	PauseRestarts(paused bool)
+	OutputStats() OutputStats
+	Control(ctx context.Context, action ControlAction) error
 }
 
 type wrapperHandler struct {
-	arg             []string
-	failOnStdErr    bool
-	hideStdErr      bool
-	hideStdOut      bool
-	path            string
-	restartMode     WrapperRestartMode
-	restartInterval time.Duration
-	timeout         time.Duration
+	arg                []string
+	control            chan controlRequest
+	env                []string
+	exitCodeMap        ExitCodeMap
+	exitCodes          ExitCodeRules
+	exited             chan struct{}
+	extendStartup      chan time.Duration
+	failOnStdErr       bool
+	hideStdErr         bool
+	hideStdOut         bool
+	lastExit           *ExitInfo
+	path               string
+	pausedRestarts     atomic.Bool
+	pauseRestarts      chan struct{}
+	pid                int
+	pingToken          bool
+	process            *os.Process
+	restartMode        WrapperRestartMode
+	restartDelay       time.Duration
+	restartInterval    time.Duration
+	restarts           int
+	started            bool
+	spawnRetries       int
+	spawnRetryInterval time.Duration
+	startTime          time.Time
+	startupSignal      chan struct{}
+	startupTimeout     time.Duration
+	stdErrCounter      outputCounter
+	stdErrTail         *lineTail
+	stdOutCounter      outputCounter
+	timeout            time.Duration
+	token              string
 }
 
 // NewWrapperStatus creates a new process wrapper and returns it
@@ -71,6 +182,27 @@ type wrapperHandler struct {
 //	  expires and the process is still running, then we send
 //	  a SIGKILL signal to it
 //	path: the path of the process executable
+//	exitCodes ExitCodeRules: the rules used to classify the exit
+//	  codes of the wrapped process, and decide if it must restart
+//	exitCodeMap ExitCodeMap: maps the exit code of the wrapped
+//	  process to the exit code of the wrapper
+//	spawnRetries int: how many times the wrapper tries to start
+//	  the process again, when its executable cannot be started
+//	spawnRetryInterval time.Duration: the time to wait before
+//	  trying to start the process again
+//	startupTimeout time.Duration: how much time the wrapped process
+//	  has to complete its startup, after it's started; if no signal
+//	  is received on the StartupSignal() channel in time, then the
+//	  process is stopped and handled as failed, use 0 to disable
+//	env []string: additional environment variables for the wrapped
+//	  process, in the form "key=value"; they override the variables
+//	  inherited from the wrapper
+//	pingToken bool: if true, a new ping token is generated every
+//	  time the process is started, and passed to it in the
+//	  LIVENESS_WRAPPER_PING_TOKEN environment variable
+//	stdErrLines int: the number of lines written by the wrapped
+//	  process on its stderr to keep in memory, they are sent
+//	  with the last WrapperData event
 //	arg: a list of arguments for the process
 //
 // Return values:
@@ -78,14 +210,27 @@ type wrapperHandler struct {
 //	system.WrapperHandler
 func NewWrapperHandler(config WrapperConfiguration, arg ...string) WrapperHandler {
 	p := &wrapperHandler{
-		arg:             arg,
-		failOnStdErr:    config.FailOnStdErr,
-		hideStdErr:      config.HideStdErr,
-		hideStdOut:      config.HideStdOut,
-		path:            config.Path,
-		restartMode:     config.RestartMode,
-		restartInterval: 1 * time.Second,
-		timeout:         config.Timeout,
+		arg:                arg,
+		control:            make(chan controlRequest),
+		env:                config.Env,
+		exitCodeMap:        config.ExitCodeMap,
+		exitCodes:          config.ExitCodes,
+		exited:             make(chan struct{}),
+		extendStartup:      make(chan time.Duration, 1),
+		failOnStdErr:       config.FailOnStdErr,
+		hideStdErr:         config.HideStdErr,
+		hideStdOut:         config.HideStdOut,
+		path:               config.Path,
+		pauseRestarts:      make(chan struct{}, 1),
+		pingToken:          config.PingToken,
+		restartMode:        config.RestartMode,
+		restartInterval:    1 * time.Second,
+		spawnRetries:       config.SpawnRetries,
+		spawnRetryInterval: config.SpawnRetryInterval,
+		startupSignal:      make(chan struct{}, 1),
+		startupTimeout:     config.StartupTimeout,
+		stdErrTail:         newLineTail(config.StdErrLines),
+		timeout:            config.Timeout,
 	}
 
 	return p
@@ -115,6 +260,34 @@ func (p *wrapperHandler) Start(ctx context.Context) (<-chan WrapperData, <-chan
 	return chanWrapperData, chanWrapperDone
 }
 
+// PauseRestarts pauses or resumes the automatic restarts of the
+// wrapped process: while they are paused, a stopped process is not
+// restarted, until they are resumed.
+func (p *wrapperHandler) PauseRestarts(paused bool) {
+	p.pausedRestarts.Store(paused)
+
+	// wake up the wrapper, unless it's already notified
+	select {
+	case p.pauseRestarts <- struct{}{}:
+	default:
+	}
+}
+
+// StartupSignal returns the channel used to notify the wrapper that
+// the running process completed its startup; the sender should not
+// block if the channel is full, a single pending signal is enough.
+func (p *wrapperHandler) StartupSignal() chan<- struct{} {
+	return p.startupSignal
+}
+
+// ExtendStartup returns the channel used to extend the startup
+// timeout of the running process, the startup must complete within
+// the received duration from now; the sender should not block if
+// the channel is full.
+func (p *wrapperHandler) ExtendStartup() chan<- time.Duration {
+	return p.extendStartup
+}
+
 // initCmdLogWrappers is an internal method used to initialize
 // the behaviour of the wrapped command's logs
 // Parameters:
@@ -139,6 +312,48 @@ func (p *wrapperHandler) initCmdLogWrappers(cmd *exec.Cmd, signalOnErrors bool,
 			cmd.Stderr = logger.NewLogErrorWriter("wrapped log")
 		}
 	}
+
+	if p.stdErrTail != nil {
+		if cmd.Stderr != nil {
+			cmd.Stderr = io.MultiWriter(p.stdErrTail, cmd.Stderr)
+		} else {
+			cmd.Stderr = p.stdErrTail
+		}
+	}
+
+	// the output is counted only if it's read anyway, a hidden stream
+	// is not piped to the wrapper just to count it
+	if cmd.Stdout != nil {
+		cmd.Stdout = io.MultiWriter(&p.stdOutCounter, cmd.Stdout)
+	}
+
+	if cmd.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(&p.stdErrCounter, cmd.Stderr)
+	}
+}
+
+// data returns a new WrapperData event for the given status, reason
+// describes the change of state.
+func (p *wrapperHandler) data(status WrapperStatus, err error, done bool, reason string) WrapperData {
+	wd := WrapperData{
+		WrapperStatus: status,
+		Err:           err,
+		Done:          done,
+		Restarts:      p.restarts,
+		Started:       p.started,
+		Pid:           p.pid,
+		Token:         p.token,
+		StartTime:     p.startTime,
+		LastExit:      p.lastExit,
+		RestartDelay:  p.restartDelay,
+		Reason:        reason,
+	}
+
+	if done && p.stdErrTail != nil {
+		wd.StdErrTail = p.stdErrTail.Lines()
+	}
+
+	return wd
 }
 
 // run executes a new instance of the wrapped process and starts
@@ -161,22 +376,47 @@ func (p *wrapperHandler) initCmdLogWrappers(cmd *exec.Cmd, signalOnErrors bool,
 // Return values:
 //
 //	error: this function will return an error if the wrapped
-//	  process cannot be started for any reason
+//	  process cannot be started for any reason, in this case
+//	  nothing is sent on the runError channel
 func (p *wrapperHandler) run(ctx context.Context, runError chan<- error, signalOnErrors bool, loggedErrors chan<- int) error {
 	cmd := exec.Command(p.path, p.arg...) //nolint:gosec
 
 	p.initCmdLogWrappers(cmd, signalOnErrors, loggedErrors)
 
-	err := cmd.Start()
+	if len(p.env) > 0 {
+		cmd.Env = append(os.Environ(), p.env...)
+	}
+
+	token := ""
+
+	if p.pingToken {
+		var err error
+
+		if token, err = newPingToken(); err != nil {
+			logger.Errorf("cannot generate the ping token of the wrapped process %s: %s", p.path, err)
+
+			return err
+		}
+
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+
+		cmd.Env = append(cmd.Env, EnvPingToken+"="+token)
+	}
+
+	err := sigmask.Start(cmd)
 	if err != nil {
-		go func() {
-			logger.Errorf("cannot start the wrapped process %s: %s", p.path, err)
-			runError <- err
-		}()
+		logger.Errorf("cannot start the wrapped process %s: %s", p.path, err)
 
 		return err
 	}
 
+	p.pid = cmd.Process.Pid
+	p.process = cmd.Process
+	p.startTime = time.Now()
+	p.token = token
+
 	var waitDone chan struct{}
 
 	var waitTimeout *time.Timer
@@ -234,7 +474,8 @@ func (p *wrapperHandler) run(ctx context.Context, runError chan<- error, signalO
 //	status WrapperStatus: the new status of the wrapped process, based on
 //	  the value of err
 //	processExitStatus int: the error code returned from the wrapped
-//	  process when it ended
+//	  process when it ended, or 128 plus the number of the signal
+//	  if the process was killed by a signal
 //	err error: an error indicating
 func (p *wrapperHandler) parseRunError(processErr error) (status WrapperStatus, processExitStatus int, err error) {
 	if processErr != nil {
@@ -242,9 +483,28 @@ func (p *wrapperHandler) parseRunError(processErr error) (status WrapperStatus,
 
 		if exitError, ok := processErr.(*exec.ExitError); ok {
 			if waitStatus, ok := exitError.Sys().(syscall.WaitStatus); ok {
-				processExitStatus = waitStatus.ExitStatus()
-				err = NewProcessExitStatusError(processExitStatus)
-				logger.Errorf("wrapped process exited with status: %d", byte(processExitStatus))
+				var exitStatusError ProcessExitStatusError
+				if waitStatus.Signaled() {
+					exitStatusError = NewProcessSignalError(waitStatus.Signal(), waitStatus.CoreDump())
+				} else {
+					exitStatusError = NewProcessExitStatusError(waitStatus.ExitStatus())
+				}
+
+				processExitStatus = exitStatusError.ExitStatus()
+
+				switch outcome := p.exitCodes.Classify(processExitStatus); outcome {
+				case ExitCodeSuccess, ExitCodeIgnore:
+					status = WrapperStatusStopped
+					logger.Infof("wrapped process %s, handled as %s", exitStatusError.Reason(), outcome)
+				default:
+					err = exitStatusError
+
+					if waitStatus.Signaled() {
+						logger.Errorf("wrapped process %s", exitStatusError.Reason())
+					} else {
+						logger.Errorf("wrapped process exited with status: %d", processExitStatus)
+					}
+				}
 
 				return
 			}
@@ -266,11 +526,59 @@ func (p *wrapperHandler) parseRunError(processErr error) (status WrapperStatus,
 	return
 }
 
-func (p *wrapperHandler) doRestart(ctx context.Context, runError chan error, loggedErrors chan int) (status WrapperStatus) {
+// exitInfo describes how the wrapped process ended, given the error
+// returned when waiting for it.
+func exitInfo(processErr error) *ExitInfo {
+	info := &ExitInfo{Time: time.Now(), Cause: ExitCauseExit, Reason: "exited with status 0"}
+
+	var exitError *exec.ExitError
+
+	if !errors.As(processErr, &exitError) {
+		if processErr != nil {
+			info.Cause = ExitCauseError
+			info.Reason = processErr.Error()
+		}
+
+		return info
+	}
+
+	waitStatus, ok := exitError.Sys().(syscall.WaitStatus)
+	if !ok {
+		info.Cause = ExitCauseError
+		info.Reason = exitError.Error()
+
+		return info
+	}
+
+	var exitStatusError ProcessExitStatusError
+
+	if waitStatus.Signaled() {
+		exitStatusError = NewProcessSignalError(waitStatus.Signal(), waitStatus.CoreDump())
+		info.Signal = SignalName(waitStatus.Signal())
+		info.Cause = ExitCauseSignal
+	} else {
+		exitStatusError = NewProcessExitStatusError(waitStatus.ExitStatus())
+	}
+
+	info.ExitStatus = exitStatusError.ExitStatus()
+	info.Reason = exitStatusError.Reason()
+
+	return info
+}
+
+func (p *wrapperHandler) doRestart(ctx context.Context, runError chan error, loggedErrors chan int) (status WrapperStatus, stop context.CancelFunc, err error) {
+	// each execution has its own context, so it can be stopped
+	// without closing the whole wrapper
+	runCtx, stop := context.WithCancel(ctx)
+
 	// when a signal i received from the restartTimer, the wrapped
 	// process is started
-	if err := p.run(ctx, runError, p.failOnStdErr, loggedErrors); err != nil {
+	if err = p.run(runCtx, runError, p.failOnStdErr, loggedErrors); err != nil {
+		stop()
+
 		status = WrapperStatusError
+		stop = nil
+		err = NewProcessSpawnError(p.path, err)
 
 		return
 	}
@@ -282,34 +590,86 @@ func (p *wrapperHandler) doRestart(ctx context.Context, runError chan error, log
 	return
 }
 
+// canRetrySpawn checks if the wrapped process can be started
+// again after it failed to start for the given number of times.
+func (p *wrapperHandler) canRetrySpawn(contextIsCanceling bool, spawnFailures int) bool {
+	return !contextIsCanceling && spawnFailures <= p.spawnRetries
+}
+
 // canRestart return checks if the wrapped process can be restarted,
 // based on the current status of the environment
 // it takes the state of the context and the exit code of the process
 // as input values.
 func (p *wrapperHandler) canRestart(contextIsCanceling bool, exitStatus int) bool {
-	switch p.restartMode {
-	case WrapperRestartNever:
+	return p.canRestartOutcome(contextIsCanceling, p.exitCodes.Classify(exitStatus))
+}
+
+// canRestartOutcome checks if the wrapped process can be restarted,
+// given the outcome of its execution.
+func (p *wrapperHandler) canRestartOutcome(contextIsCanceling bool, outcome ExitCodeOutcome) bool {
+	if contextIsCanceling {
 		return false
-	case WrapperRestartOnError:
-		return !contextIsCanceling && exitStatus != 0
-	case WrapperRestartAlways:
-		return !contextIsCanceling
+	}
+
+	switch outcome {
+	case ExitCodeFatal:
+		return false
+	case ExitCodeTransient, ExitCodeIgnore:
+		return true
+	case ExitCodeSuccess:
+		return p.restartMode == WrapperRestartAlways
+	case ExitCodeError:
+		return p.restartMode == WrapperRestartOnError || p.restartMode == WrapperRestartAlways
 	}
 
 	return false
 }
 
+// exitError returns the error sent with the last WrapperData event,
+// replacing the exit status of the wrapped process with the one
+// mapped by the ExitCodeMap, if any.
+func (p *wrapperHandler) exitError(processExitStatus int, processError error) error {
+	if len(p.exitCodeMap) == 0 {
+		return processError
+	}
+
+	var exitStatusError ProcessExitStatusError
+
+	if !errors.As(processError, &exitStatusError) {
+		if processError != nil {
+			return processError
+		}
+
+		exitStatusError = NewProcessExitStatusError(processExitStatus)
+	}
+
+	exitStatus := p.exitCodeMap.Map(exitStatusError.ExitStatus())
+	if exitStatus == exitStatusError.ExitStatus() {
+		return processError
+	}
+
+	logger.Debugf("exit status %d of the wrapped process is mapped to %d", exitStatusError.ExitStatus(), exitStatus)
+
+	return &wrapperExitStatusError{ProcessExitStatusError: exitStatusError, exitStatus: exitStatus}
+}
+
 func (p *wrapperHandler) do(ctx context.Context, chanWrapperData chan<- WrapperData, chanWrapperDone chan<- struct{}) {
 	defer close(chanWrapperDone)
 	defer close(chanWrapperData)
 
+	if p.exited != nil {
+		defer close(p.exited)
+	}
+
 	var processError error
 
 	var processExitStatus int
 
 	var status WrapperStatus
 
-	defer func() { chanWrapperData <- WrapperData{status, processError, true} }()
+	defer func() {
+		chanWrapperData <- p.data(status, p.exitError(processExitStatus, processError), true, "the wrapper is exiting")
+	}()
 
 	runError := make(chan error)
 	defer close(runError)
@@ -321,6 +681,37 @@ func (p *wrapperHandler) do(ctx context.Context, chanWrapperData chan<- WrapperD
 
 	var contextDone bool
 
+	var spawned bool
+
+	var spawnFailures int
+
+	// stopProcess stops the running process, without closing the wrapper
+	var stopProcess context.CancelFunc
+
+	// startupTimeout is nil, unless the running process must still
+	// complete its startup, and the startup timeout is enabled
+	var startupTimer *time.Timer
+
+	var startupTimeout <-chan time.Time
+
+	var startupFailed bool
+
+	// restartPaused is true if a restart is waiting for the restarts
+	// to be resumed
+	var restartPaused bool
+
+	// held is true if the process was stopped by a ControlStop, it's
+	// not restarted until a ControlStart or a ControlRestart
+	var held bool
+
+	// forceStart is true if the next start was requested by a control
+	// action, it's not paused with the restarts
+	var forceStart bool
+
+	// stopRequest is the control action stopping the running process,
+	// nil if no one is
+	var stopRequest *ControlAction
+
 	for {
 		select {
 		case <-restartTimer.C:
@@ -329,8 +720,109 @@ func (p *wrapperHandler) do(ctx context.Context, chanWrapperData chan<- WrapperD
 				return
 			}
 
-			status = p.doRestart(ctx, runError, loggedErrors)
-			chanWrapperData <- WrapperData{status, nil, false}
+			if spawned && p.pausedRestarts.Load() && !forceStart {
+				logger.Warnf("the restart of the wrapped process %s is paused", p.path)
+
+				restartPaused = true
+
+				continue
+			}
+
+			forceStart = false
+
+			var spawnError error
+
+			// discard a startup signal left by the previous execution
+			select {
+			case <-p.startupSignal:
+			default:
+			}
+
+			select {
+			case <-p.extendStartup:
+			default:
+			}
+
+			status, stopProcess, spawnError = p.doRestart(ctx, runError, loggedErrors)
+			if spawnError != nil {
+				// the process is not running, so the spawn failures
+				// don't go through the exit codes and the restart mode
+				processError = spawnError
+				processExitStatus = 0
+
+				spawnFailures++
+				canRetry := p.canRetrySpawn(contextDone, spawnFailures)
+
+				p.restartDelay = 0
+				if canRetry {
+					p.restartDelay = p.spawnRetryInterval
+				}
+
+				chanWrapperData <- p.data(status, nil, false, spawnError.Error())
+
+				if !canRetry {
+					logger.Debugf("the wrapped process cannot be started, exiting now...")
+					return
+				}
+
+				logger.Warnf("the wrapped process will be started again in %s (retry %d of %d)...", p.spawnRetryInterval, spawnFailures, p.spawnRetries)
+				restartTimer = time.NewTimer(p.spawnRetryInterval)
+
+				continue
+			}
+
+			if spawned {
+				p.restarts++
+			}
+
+			spawned = true
+			spawnFailures = 0
+			startupFailed = false
+			p.restartDelay = 0
+
+			if p.startupTimeout > 0 {
+				p.started = false
+				startupTimer = time.NewTimer(p.startupTimeout)
+				startupTimeout = startupTimer.C
+			} else {
+				p.started = true
+			}
+
+			chanWrapperData <- p.data(status, nil, false, "started")
+
+		case <-p.startupSignal:
+			if startupTimeout == nil {
+				continue
+			}
+
+			_ = startupTimer.Stop()
+			startupTimeout = nil
+			p.started = true
+
+			logger.Infof("wrapped process %s completed its startup", p.path)
+			chanWrapperData <- p.data(status, nil, false, "startup completed")
+
+		case extend := <-p.extendStartup:
+			if startupTimeout == nil {
+				continue
+			}
+
+			if !startupTimer.Stop() {
+				select {
+				case <-startupTimer.C:
+				default:
+				}
+			}
+
+			startupTimer.Reset(extend)
+			logger.Infof("wrapped process %s asked to extend its startup timeout by %s", p.path, extend)
+
+		case <-startupTimeout:
+			startupTimeout = nil
+			startupFailed = true
+
+			logger.Errorf("wrapped process %s did not complete its startup within %s, stopping it", p.path, p.startupTimeout)
+			stopProcess()
 
 		case <-ctx.Done():
 			if contextDone {
@@ -341,26 +833,156 @@ func (p *wrapperHandler) do(ctx context.Context, chanWrapperData chan<- WrapperD
 
 			logger.Debugf("received the signal to close the wrapped process context")
 
-			if restartTimer.Stop() {
+			if restartTimer.Stop() || restartPaused || held {
 				logger.Debugf("wrapped process is scheduled, but not started yet, exit now")
 				return
 			}
 
+		case <-p.pauseRestarts:
+			if !restartPaused || p.pausedRestarts.Load() {
+				continue
+			}
+
+			logger.Infof("the restarts of the wrapped process %s are resumed", p.path)
+
+			restartPaused = false
+			restartTimer = time.NewTimer(0)
+
+		case req := <-p.control:
+			action := req.action
+			isRunning := p.pid != 0
+
+			var err error
+
+			switch {
+			case contextDone:
+				err = ErrExiting
+
+			case action.Command == ControlSignal:
+				if !isRunning {
+					err = ErrNotRunning
+					break
+				}
+
+				logger.Warnf("sending %s to the wrapped process %s, requested by %s", SignalName(action.Signal), p.path, action.RequestedBy)
+				err = p.process.Signal(action.Signal)
+
+			case action.Command == ControlStart && isRunning:
+				err = ErrAlreadyRunning
+
+			case stopRequest != nil:
+				// the stop sequence of the first request is not restarted,
+				// and its requester is kept for the reason of the exit
+				err = ErrStopping
+
+			case isRunning:
+				// the rest of the action is applied when the process exits
+				logger.Warnf("stopping the wrapped process %s for a %s, requested by %s", p.path, action.Command, action.RequestedBy)
+
+				stopRequest = &action
+				stopProcess()
+
+			case action.Command == ControlStop:
+				if held {
+					err = ErrNotRunning
+					break
+				}
+
+				// the process is not running, a scheduled restart is canceled
+				logger.Warnf("the wrapped process %s is stopped, requested by %s", p.path, action.RequestedBy)
+				stopTimer(restartTimer)
+
+				held = true
+				restartPaused = false
+				p.restartDelay = 0
+
+				chanWrapperData <- p.data(status, nil, false, "stop requested by "+action.RequestedBy)
+
+			default:
+				// a restart or a start of a process which is not running
+				logger.Warnf("starting the wrapped process %s, requested by %s", p.path, action.RequestedBy)
+				stopTimer(restartTimer)
+
+				held = false
+				restartPaused = false
+				forceStart = true
+				restartTimer = time.NewTimer(0)
+			}
+
+			req.result <- err
+
 		case n := <-loggedErrors:
 			status = WrapperStatusError
-			chanWrapperData <- WrapperData{status, nil, false}
+			chanWrapperData <- p.data(status, nil, false, "logged an error on stderr")
 
 			logger.Debugf("wrapped process logged an error: %d bytes", n)
 
 		case err := <-runError:
+			stopProcess()
+
+			if startupTimeout != nil {
+				_ = startupTimer.Stop()
+				startupTimeout = nil
+			}
+
+			p.started = false
+			p.pid = 0
+			p.process = nil
+			p.startTime = time.Time{}
+			p.token = ""
+			p.lastExit = exitInfo(err)
+
 			status, processExitStatus, processError = p.parseRunError(err)
-			chanWrapperData <- WrapperData{status, nil, false}
 
-			if p.canRestart(contextDone, processExitStatus) {
+			outcome := p.exitCodes.Classify(processExitStatus)
+			if startupFailed {
+				// whatever the exit status is, a process which didn't
+				// complete its startup in time is handled as failed
+				status = WrapperStatusError
+				outcome = ExitCodeError
+
+				if processError == nil {
+					processError = ErrStartupTimeout
+				}
+
+				p.lastExit.Cause = ExitCauseStartupTimeout
+				p.lastExit.Reason = "did not complete its startup in time, " + p.lastExit.Reason
+			}
+
+			canRestart := p.canRestartOutcome(contextDone, outcome)
+			isRequested := stopRequest != nil
+
+			if isRequested {
+				// the process was stopped on request, it's not a failure
+				status, processExitStatus, processError = WrapperStatusStopped, 0, nil
+
+				p.lastExit.Cause = ExitCauseAdmin
+				p.lastExit.Reason = stopRequest.Command.String() + " requested by " + stopRequest.RequestedBy + ", " + p.lastExit.Reason
+
+				canRestart = !contextDone && stopRequest.Command == ControlRestart
+				held = !contextDone && stopRequest.Command == ControlStop
+				forceStart = canRestart
+				stopRequest = nil
+			}
+
+			p.restartDelay = 0
+			if canRestart && !isRequested {
+				p.restartDelay = p.restartInterval
+			}
+
+			chanWrapperData <- p.data(status, nil, false, p.lastExit.Reason)
+
+			switch {
+			case canRestart && isRequested:
+				logger.Infof("restarting the wrapped process %s...", p.path)
+				restartTimer = time.NewTimer(0)
+			case canRestart:
 				logger.Debugf("the wrapped process will restart in %d seconds...", p.restartInterval/time.Second)
 				restartTimer = time.NewTimer(p.restartInterval)
 				p.restartInterval *= 2
-			} else {
+			case held:
+				logger.Warnf("the wrapped process %s is stopped, until it's started again", p.path)
+			default:
 				logger.Debugf("wrapped process is completed, exiting now...")
 				return
 			}
@@ -2,7 +2,10 @@ package system
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"sync"
 	"testing"
@@ -198,6 +201,541 @@ func Test_wrapperHandler_canRestart(t *testing.T) {
 	}
 }
 
+func Test_wrapperHandler_canRestart_ExitCodes(t *testing.T) {
+	exitCodes, err := ParseExitCodeRules([]string{"3:transient", "4:fatal", "5:success", "6:ignore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type args struct {
+		contextIsCanceling bool
+		exitStatus         int
+	}
+	tests := []struct {
+		name    string
+		restart WrapperRestartMode
+		args    args
+		want    bool
+	}{
+		{name: "Never_transient", restart: WrapperRestartNever, args: args{exitStatus: 3}, want: true},
+		{name: "Never_transient_canceling", restart: WrapperRestartNever, args: args{contextIsCanceling: true, exitStatus: 3}, want: false},
+		{name: "Never_ignore", restart: WrapperRestartNever, args: args{exitStatus: 6}, want: true},
+		{name: "Never_error", restart: WrapperRestartNever, args: args{exitStatus: 1}, want: false},
+		{name: "OnError_fatal", restart: WrapperRestartOnError, args: args{exitStatus: 4}, want: false},
+		{name: "OnError_success", restart: WrapperRestartOnError, args: args{exitStatus: 5}, want: false},
+		{name: "OnError_error", restart: WrapperRestartOnError, args: args{exitStatus: 1}, want: true},
+		{name: "Always_fatal", restart: WrapperRestartAlways, args: args{exitStatus: 4}, want: false},
+		{name: "Always_success", restart: WrapperRestartAlways, args: args{exitStatus: 5}, want: true},
+		{name: "Always_ignore_canceling", restart: WrapperRestartAlways, args: args{contextIsCanceling: true, exitStatus: 6}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &wrapperHandler{
+				exitCodes:   exitCodes,
+				restartMode: tt.restart,
+			}
+			if got := p.canRestart(tt.args.contextIsCanceling, tt.args.exitStatus); got != tt.want {
+				t.Errorf("canRestart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_wrapperHandler_exitError(t *testing.T) {
+	exitCodeMap, err := ParseExitCodeMap([]string{"3:0", "10:1", "128-255:2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	genericError := errors.New("generic error")
+
+	type args struct {
+		processExitStatus int
+		processError      error
+	}
+	type want struct {
+		exitStatus int
+		wantErr    bool
+	}
+	tests := []struct {
+		name        string
+		exitCodeMap ExitCodeMap
+		args        args
+		want        want
+	}{
+		{
+			name: "No_map",
+			args: args{processExitStatus: 10, processError: NewProcessExitStatusError(10)},
+			want: want{exitStatus: 10, wantErr: true},
+		},
+		{
+			name:        "Success",
+			exitCodeMap: exitCodeMap,
+			args:        args{processExitStatus: 0},
+			want:        want{exitStatus: 0, wantErr: false},
+		},
+		{
+			name:        "Mapped_to_0",
+			exitCodeMap: exitCodeMap,
+			args:        args{processExitStatus: 3, processError: NewProcessExitStatusError(3)},
+			want:        want{exitStatus: 0, wantErr: true},
+		},
+		{
+			name:        "Mapped",
+			exitCodeMap: exitCodeMap,
+			args:        args{processExitStatus: 10, processError: NewProcessExitStatusError(10)},
+			want:        want{exitStatus: 1, wantErr: true},
+		},
+		{
+			name:        "Mapped_signal",
+			exitCodeMap: exitCodeMap,
+			args:        args{processExitStatus: 139, processError: NewProcessSignalError(11, false)},
+			want:        want{exitStatus: 2, wantErr: true},
+		},
+		{
+			name:        "Not_mapped",
+			exitCodeMap: exitCodeMap,
+			args:        args{processExitStatus: 20, processError: NewProcessExitStatusError(20)},
+			want:        want{exitStatus: 20, wantErr: true},
+		},
+		{
+			name:        "Generic_error",
+			exitCodeMap: exitCodeMap,
+			args:        args{processExitStatus: 0, processError: genericError},
+			want:        want{exitStatus: 0, wantErr: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &wrapperHandler{exitCodeMap: tt.exitCodeMap}
+
+			err := p.exitError(tt.args.processExitStatus, tt.args.processError)
+			if (err != nil) != tt.want.wantErr {
+				t.Fatalf("exitError() = %v, wantErr %v", err, tt.want.wantErr)
+			}
+
+			var exitStatusError ProcessExitStatusError
+			if errors.As(err, &exitStatusError) && exitStatusError.ExitStatus() != tt.want.exitStatus {
+				t.Errorf("exitError() exit status = %v, want %v", exitStatusError.ExitStatus(), tt.want.exitStatus)
+			}
+
+			if errors.Is(tt.args.processError, genericError) && err != genericError {
+				t.Errorf("exitError() = %v, want %v", err, genericError)
+			}
+		})
+	}
+}
+
+func Test_wrapperHandler_parseRunError(t *testing.T) {
+	type want struct {
+		status            WrapperStatus
+		processExitStatus int
+		reason            string
+		wantErr           bool
+	}
+	tests := []struct {
+		name      string
+		command   string
+		exitCodes []string
+		want      want
+	}{
+		{
+			name:    "Exit_0",
+			command: "exit 0",
+			want:    want{status: WrapperStatusStopped, processExitStatus: 0, wantErr: false},
+		},
+		{
+			name:    "Exit_10",
+			command: "exit 10",
+			want:    want{status: WrapperStatusError, processExitStatus: 10, reason: "exited with status 10", wantErr: true},
+		},
+		{
+			name:    "Exit_255",
+			command: "exit 255",
+			want:    want{status: WrapperStatusError, processExitStatus: 255, reason: "exited with status 255", wantErr: true},
+		},
+		{
+			name:      "Exit_3_success",
+			command:   "exit 3",
+			exitCodes: []string{"3:success"},
+			want:      want{status: WrapperStatusStopped, processExitStatus: 3, wantErr: false},
+		},
+		{
+			name:      "Exit_3_ignore",
+			command:   "exit 3",
+			exitCodes: []string{"3:ignore"},
+			want:      want{status: WrapperStatusStopped, processExitStatus: 3, wantErr: false},
+		},
+		{
+			name:      "Exit_75_transient",
+			command:   "exit 75",
+			exitCodes: []string{"75:transient"},
+			want:      want{status: WrapperStatusError, processExitStatus: 75, reason: "exited with status 75", wantErr: true},
+		},
+		{
+			name:    "Killed_by_SIGKILL",
+			command: "kill -KILL $$",
+			want:    want{status: WrapperStatusError, processExitStatus: 137, reason: "killed by SIGKILL", wantErr: true},
+		},
+		{
+			name:    "Killed_by_SIGSEGV",
+			command: "ulimit -c 0; kill -SEGV $$",
+			want:    want{status: WrapperStatusError, processExitStatus: 139, reason: "killed by SIGSEGV", wantErr: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exitCodes, err := ParseExitCodeRules(tt.exitCodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := &wrapperHandler{exitCodes: exitCodes}
+
+			status, processExitStatus, err := p.parseRunError(exec.Command("/bin/sh", "-c", tt.command).Run())
+			if status != tt.want.status {
+				t.Errorf("parseRunError() status = %v, want %v", status, tt.want.status)
+			}
+
+			if processExitStatus != tt.want.processExitStatus {
+				t.Errorf("parseRunError() processExitStatus = %v, want %v", processExitStatus, tt.want.processExitStatus)
+			}
+
+			if tt.want.wantErr != (err != nil) {
+				t.Fatalf("parseRunError() err = %v, wantErr %v", err, tt.want.wantErr)
+			}
+
+			var exitStatusError ProcessExitStatusError
+			if tt.want.wantErr && !errors.As(err, &exitStatusError) {
+				t.Fatalf("parseRunError() err = %T, want a ProcessExitStatusError", err)
+			}
+
+			if tt.want.wantErr && exitStatusError.Reason() != tt.want.reason {
+				t.Errorf("parseRunError() reason = %v, want %v", exitStatusError.Reason(), tt.want.reason)
+			}
+
+			if tt.want.wantErr && exitStatusError.ExitStatus() != tt.want.processExitStatus {
+				t.Errorf("parseRunError() exit status = %v, want %v", exitStatusError.ExitStatus(), tt.want.processExitStatus)
+			}
+		})
+	}
+}
+
+func Test_wrapperHandler_do_Spawn_error(t *testing.T) {
+	notExecutable := filepath.Join(t.TempDir(), "not_executable.sh")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type fields struct {
+		path         string
+		restart      WrapperRestartMode
+		spawnRetries int
+	}
+
+	type want struct {
+		spawnAttempts int
+		exitStatus    int
+	}
+
+	tests := []struct {
+		name   string
+		fields fields
+		want   want
+	}{
+		{
+			name:   "Not_found_no_retries",
+			fields: fields{path: filepath.Join(testDirectory, "command_not_found.sh"), restart: WrapperRestartAlways},
+			want:   want{spawnAttempts: 1, exitStatus: 127},
+		},
+		{
+			name:   "Not_found_with_retries",
+			fields: fields{path: filepath.Join(testDirectory, "command_not_found.sh"), restart: WrapperRestartAlways, spawnRetries: 2},
+			want:   want{spawnAttempts: 3, exitStatus: 127},
+		},
+		{
+			name:   "Not_executable_with_retries",
+			fields: fields{path: notExecutable, restart: WrapperRestartOnError, spawnRetries: 1},
+			want:   want{spawnAttempts: 2, exitStatus: 126},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+			p := &wrapperHandler{
+				path:               tt.fields.path,
+				restartMode:        tt.fields.restart,
+				restartInterval:    10 * time.Millisecond,
+				spawnRetries:       tt.fields.spawnRetries,
+				spawnRetryInterval: 10 * time.Millisecond,
+				timeout:            1 * time.Second,
+			}
+
+			chanWrapperData := make(chan WrapperData)
+			chanWrapperDone := make(chan struct{})
+
+			go p.do(context.Background(), chanWrapperData, chanWrapperDone)
+
+			var spawnAttempts int
+
+			var last WrapperData
+
+			for wd := range chanWrapperData {
+				last = wd
+				if wd.Done {
+					break
+				}
+
+				if wd.WrapperStatus != WrapperStatusError {
+					t.Errorf("expected wrapperStatus == %v, got %v", WrapperStatusError, wd.WrapperStatus)
+				}
+
+				spawnAttempts++
+			}
+
+			<-chanWrapperDone
+
+			if spawnAttempts != tt.want.spawnAttempts {
+				t.Errorf("expected %d attempts to start the process, got %d", tt.want.spawnAttempts, spawnAttempts)
+			}
+
+			if last.WrapperStatus != WrapperStatusError {
+				t.Errorf("after done: expected wrapperStatus == %v, got %v", WrapperStatusError, last.WrapperStatus)
+			}
+
+			if last.Restarts != 0 {
+				t.Errorf("after done: expected no restarts, got %d", last.Restarts)
+			}
+
+			var exitStatusError ProcessExitStatusError
+			if !errors.As(last.Err, &exitStatusError) {
+				t.Fatalf("after done: expected a ProcessExitStatusError, got %v", last.Err)
+			}
+
+			if exitStatusError.ExitStatus() != tt.want.exitStatus {
+				t.Errorf("after done: expected exit status %d, got %d", tt.want.exitStatus, exitStatusError.ExitStatus())
+			}
+		})
+	}
+}
+
+// nextWrapperData waits for the next event sent by the wrapper.
+func nextWrapperData(t *testing.T, chanWrapperData <-chan WrapperData, timeout time.Duration) WrapperData {
+	t.Helper()
+
+	select {
+	case wd := <-chanWrapperData:
+		return wd
+	case <-time.After(timeout):
+		t.Fatalf("timeout waiting for the wrapper data")
+	}
+
+	return WrapperData{}
+}
+
+func Test_wrapperHandler_do_Startup(t *testing.T) {
+	t.Run("Startup_completed", func(t *testing.T) {
+		logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+		p := &wrapperHandler{
+			path:           filepath.Join(testDirectory, "test_2s_int_no_err.sh"),
+			restartMode:    WrapperRestartNever,
+			startupSignal:  make(chan struct{}, 1),
+			startupTimeout: 500 * time.Millisecond,
+			timeout:        1 * time.Second,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		chanWrapperData := make(chan WrapperData)
+		chanWrapperDone := make(chan struct{})
+
+		go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+		wd := nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusRunning || wd.Started {
+			t.Errorf("after start: expected a running process not started yet, got %v (started: %v)", wd.WrapperStatus, wd.Started)
+		}
+
+		if wd.Pid == 0 {
+			t.Errorf("after start: expected the pid of the running process")
+		}
+
+		p.StartupSignal() <- struct{}{}
+
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusRunning || !wd.Started {
+			t.Errorf("after startup: expected a running process started, got %v (started: %v)", wd.WrapperStatus, wd.Started)
+		}
+
+		// the startup timeout must not stop the process anymore
+		time.Sleep(600 * time.Millisecond)
+
+		cancel()
+
+		wd = nextWrapperData(t, chanWrapperData, 2*time.Second)
+		if wd.WrapperStatus != WrapperStatusStopped || wd.Started {
+			t.Errorf("after cancel: expected a stopped process, got %v (started: %v)", wd.WrapperStatus, wd.Started)
+		}
+
+		if wd.Pid != 0 {
+			t.Errorf("after cancel: no pid expected, got %d", wd.Pid)
+		}
+
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if !wd.Done || wd.Err != nil {
+			t.Errorf("after done: expected no errors, got %v", wd.Err)
+		}
+
+		<-chanWrapperDone
+	})
+
+	t.Run("Startup_timeout_Restart_never", func(t *testing.T) {
+		logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+		p := &wrapperHandler{
+			path:           filepath.Join(testDirectory, "test_2s_int_no_err.sh"),
+			restartMode:    WrapperRestartNever,
+			startupSignal:  make(chan struct{}, 1),
+			startupTimeout: 50 * time.Millisecond,
+			timeout:        1 * time.Second,
+		}
+
+		chanWrapperData := make(chan WrapperData)
+		chanWrapperDone := make(chan struct{})
+
+		go p.do(context.Background(), chanWrapperData, chanWrapperDone)
+
+		wd := nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusRunning {
+			t.Errorf("after start: expected wrapperStatus == %v, got %v", WrapperStatusRunning, wd.WrapperStatus)
+		}
+
+		// the process exits with status 0 when it's stopped, but
+		// it must be handled as failed anyway
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusError {
+			t.Errorf("after timeout: expected wrapperStatus == %v, got %v", WrapperStatusError, wd.WrapperStatus)
+		}
+
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if !wd.Done || !errors.Is(wd.Err, ErrStartupTimeout) {
+			t.Errorf("after done: expected %v, got %v", ErrStartupTimeout, wd.Err)
+		}
+
+		<-chanWrapperDone
+	})
+
+	t.Run("Startup_timeout_Restart_on_error", func(t *testing.T) {
+		logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+		p := &wrapperHandler{
+			path:            filepath.Join(testDirectory, "test_2s_int_no_err.sh"),
+			restartInterval: 10 * time.Millisecond,
+			restartMode:     WrapperRestartOnError,
+			startupSignal:   make(chan struct{}, 1),
+			startupTimeout:  50 * time.Millisecond,
+			timeout:         1 * time.Second,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		chanWrapperData := make(chan WrapperData)
+		chanWrapperDone := make(chan struct{})
+
+		go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+		wd := nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusRunning {
+			t.Errorf("after start: expected wrapperStatus == %v, got %v", WrapperStatusRunning, wd.WrapperStatus)
+		}
+
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusError {
+			t.Errorf("after timeout: expected wrapperStatus == %v, got %v", WrapperStatusError, wd.WrapperStatus)
+		}
+
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusRunning || wd.Restarts != 1 {
+			t.Errorf("after restart: expected a running process restarted once, got %v (restarts: %d)", wd.WrapperStatus, wd.Restarts)
+		}
+
+		p.StartupSignal() <- struct{}{}
+
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if !wd.Started {
+			t.Errorf("after startup: expected a started process")
+		}
+
+		// give the process the time to install its signal handlers
+		time.Sleep(50 * time.Millisecond)
+
+		cancel()
+
+		for wd = range chanWrapperData {
+			if wd.Done {
+				break
+			}
+		}
+
+		if wd.Err != nil {
+			t.Errorf("after done: no error expected, got %v", wd.Err)
+		}
+
+		<-chanWrapperDone
+	})
+
+	t.Run("Startup_timeout_Extended", func(t *testing.T) {
+		logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+		p := &wrapperHandler{
+			extendStartup:  make(chan time.Duration, 1),
+			path:           filepath.Join(testDirectory, "test_2s_int_no_err.sh"),
+			restartMode:    WrapperRestartNever,
+			startupSignal:  make(chan struct{}, 1),
+			startupTimeout: 100 * time.Millisecond,
+			timeout:        1 * time.Second,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		chanWrapperData := make(chan WrapperData)
+		chanWrapperDone := make(chan struct{})
+
+		go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+		wd := nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if wd.WrapperStatus != WrapperStatusRunning {
+			t.Errorf("after start: expected wrapperStatus == %v, got %v", WrapperStatusRunning, wd.WrapperStatus)
+		}
+
+		p.ExtendStartup() <- 1 * time.Second
+
+		// the original timeout is expired, but the process is still running
+		time.Sleep(300 * time.Millisecond)
+
+		p.StartupSignal() <- struct{}{}
+
+		wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+		if !wd.Started || wd.WrapperStatus != WrapperStatusRunning {
+			t.Errorf("after startup: expected a started process, got %v (started: %v)", wd.WrapperStatus, wd.Started)
+		}
+
+		cancel()
+
+		for wd = range chanWrapperData {
+			if wd.Done {
+				break
+			}
+		}
+
+		if wd.Err != nil {
+			t.Errorf("after done: no error expected, got %v", wd.Err)
+		}
+
+		<-chanWrapperDone
+	})
+}
+
 // testing a simple execution of the process, without context cancel.
 func Test_wrapperHandler_do(t *testing.T) {
 	type fields struct {
@@ -1767,3 +2305,225 @@ func Test_wrapperHandler_do_Log_error(t *testing.T) {
 		})
 	}
 }
+
+func Test_wrapperHandler_do_PingToken(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	tokens := filepath.Join(t.TempDir(), "tokens")
+
+	p := &wrapperHandler{
+		arg:             []string{"-c", `echo "$` + EnvPingToken + `" >> ` + tokens},
+		path:            "/bin/sh",
+		pingToken:       true,
+		restartInterval: 10 * time.Millisecond,
+		restartMode:     WrapperRestartAlways,
+		startupSignal:   make(chan struct{}, 1),
+		timeout:         1 * time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chanWrapperData := make(chan WrapperData)
+	chanWrapperDone := make(chan struct{})
+
+	go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+	first := nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if first.WrapperStatus != WrapperStatusRunning || len(first.Token) != 2*pingTokenSize {
+		t.Fatalf("after start: expected a running process with a token, got %v (token: %q)", first.WrapperStatus, first.Token)
+	}
+
+	wd := nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if wd.WrapperStatus != WrapperStatusStopped || wd.Token != "" {
+		t.Errorf("after exit: expected a stopped process without a token, got %v (token: %q)", wd.WrapperStatus, wd.Token)
+	}
+
+	second := nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if second.WrapperStatus != WrapperStatusRunning || second.Token == "" || second.Token == first.Token {
+		t.Errorf("after restart: expected a new token, got %q (previous: %q)", second.Token, first.Token)
+	}
+
+	cancel()
+
+	for wd := range chanWrapperData {
+		if wd.Done {
+			break
+		}
+	}
+
+	<-chanWrapperDone
+
+	content, err := os.ReadFile(tokens)
+	if err != nil {
+		t.Fatalf("cannot read the tokens: %s", err)
+	}
+
+	want := first.Token + "\n" + second.Token + "\n"
+	if string(content) != want {
+		t.Errorf("expected the tokens %q in the environment of the process, got %q", want, string(content))
+	}
+}
+
+func Test_wrapperHandler_do_PauseRestarts(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	tests := []struct {
+		name   string
+		resume bool
+	}{
+		{name: "Resume", resume: true},
+		{name: "Cancel_while_paused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &wrapperHandler{
+				arg:             []string{"-c", "exit 0"},
+				path:            "/bin/sh",
+				pauseRestarts:   make(chan struct{}, 1),
+				restartInterval: 10 * time.Millisecond,
+				restartMode:     WrapperRestartAlways,
+				startupSignal:   make(chan struct{}, 1),
+				timeout:         1 * time.Second,
+			}
+
+			p.PauseRestarts(true)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			chanWrapperData := make(chan WrapperData)
+			chanWrapperDone := make(chan struct{})
+
+			go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+			// the first start is not a restart
+			wd := nextWrapperData(t, chanWrapperData, 1*time.Second)
+			if wd.WrapperStatus != WrapperStatusRunning {
+				t.Fatalf("after start: expected wrapperStatus == %v, got %v", WrapperStatusRunning, wd.WrapperStatus)
+			}
+
+			wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+			if wd.WrapperStatus != WrapperStatusStopped {
+				t.Fatalf("after exit: expected wrapperStatus == %v, got %v", WrapperStatusStopped, wd.WrapperStatus)
+			}
+
+			// the process is not restarted while the restarts are paused
+			select {
+			case wd := <-chanWrapperData:
+				t.Fatalf("no restart was expected, got %+v", wd)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if tt.resume {
+				p.PauseRestarts(false)
+
+				wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+				if wd.WrapperStatus != WrapperStatusRunning || wd.Restarts != 1 {
+					t.Errorf("after resume: expected a restarted process, got %v (restarts: %d)", wd.WrapperStatus, wd.Restarts)
+				}
+
+				p.PauseRestarts(true)
+			}
+
+			cancel()
+
+			for wd := range chanWrapperData {
+				if wd.Done {
+					break
+				}
+			}
+
+			select {
+			case <-chanWrapperDone:
+			case <-time.After(1 * time.Second):
+				t.Errorf("the wrapper was expected to end")
+			}
+		})
+	}
+}
+
+func Test_exitInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    ExitInfo
+	}{
+		{
+			name:    "Exit_0",
+			command: "exit 0",
+			want:    ExitInfo{ExitStatus: 0, Cause: ExitCauseExit, Reason: "exited with status 0"},
+		},
+		{
+			name:    "Exit_10",
+			command: "exit 10",
+			want:    ExitInfo{ExitStatus: 10, Cause: ExitCauseExit, Reason: "exited with status 10"},
+		},
+		{
+			name:    "Killed_by_SIGKILL",
+			command: "kill -KILL $$",
+			want:    ExitInfo{ExitStatus: 137, Signal: "SIGKILL", Cause: ExitCauseSignal, Reason: "killed by SIGKILL"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+
+			got := exitInfo(exec.Command("/bin/sh", "-c", tt.command).Run())
+			if got.Time.Before(before) {
+				t.Errorf("exitInfo() time = %v, want after %v", got.Time, before)
+			}
+
+			got.Time = time.Time{}
+			if *got != tt.want {
+				t.Errorf("exitInfo() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_wrapperHandler_do_Status(t *testing.T) {
+	logger.New(testconsole.NewTestConsole(), "", "INFO")
+
+	p := &wrapperHandler{
+		arg:             []string{"-c", "sleep 0.1; exit 3"},
+		path:            "/bin/sh",
+		restartInterval: 50 * time.Millisecond,
+		restartMode:     WrapperRestartOnError,
+		startupSignal:   make(chan struct{}, 1),
+		timeout:         1 * time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chanWrapperData := make(chan WrapperData)
+	chanWrapperDone := make(chan struct{})
+
+	go p.do(ctx, chanWrapperData, chanWrapperDone)
+
+	wd := nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if wd.Reason != "started" || wd.StartTime.IsZero() || wd.LastExit != nil || wd.RestartDelay != 0 {
+		t.Fatalf("after start: unexpected state %+v", wd)
+	}
+
+	wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if wd.Reason != "exited with status 3" || !wd.StartTime.IsZero() || wd.RestartDelay != 50*time.Millisecond {
+		t.Fatalf("after exit: unexpected state %+v", wd)
+	}
+
+	if wd.LastExit == nil || wd.LastExit.ExitStatus != 3 {
+		t.Fatalf("after exit: expected the exit status 3, got %+v", wd.LastExit)
+	}
+
+	wd = nextWrapperData(t, chanWrapperData, 1*time.Second)
+	if wd.Reason != "started" || wd.RestartDelay != 0 || wd.LastExit == nil || wd.Restarts != 1 {
+		t.Errorf("after restart: unexpected state %+v", wd)
+	}
+
+	cancel()
+
+	for wd := range chanWrapperData {
+		if wd.Done {
+			break
+		}
+	}
+
+	<-chanWrapperDone
+}
@@ -0,0 +1,68 @@
+package system
+
+import (
+	"strings"
+	"sync"
+)
+
+// lineTail is an io.Writer keeping in memory only the last
+// lines written on it, it's used to collect the latest logs
+// written by the wrapped process on its stderr.
+type lineTail struct {
+	lines   []string
+	mux     sync.Mutex
+	partial string
+	size    int
+}
+
+// newLineTail creates a new lineTail keeping the last size lines.
+func newLineTail(size int) *lineTail {
+	return &lineTail{
+		size: size,
+	}
+}
+
+func (t *lineTail) Write(p []byte) (int, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if t.size <= 0 {
+		return len(p), nil
+	}
+
+	text := t.partial + string(p)
+	lines := strings.Split(text, "\n")
+
+	// the last element is an incomplete line, or an empty
+	// string if p ends with a newline
+	t.partial = lines[len(lines)-1]
+
+	for _, line := range lines[:len(lines)-1] {
+		t.lines = append(t.lines, line)
+	}
+
+	if len(t.lines) > t.size {
+		t.lines = append([]string(nil), t.lines[len(t.lines)-t.size:]...)
+	}
+
+	return len(p), nil
+}
+
+// Lines returns a copy of the lines currently kept in memory,
+// including the last incomplete line, if any.
+func (t *lineTail) Lines() []string {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	lines := append([]string(nil), t.lines...)
+
+	if t.partial != "" {
+		lines = append(lines, t.partial)
+	}
+
+	if len(lines) > t.size {
+		lines = lines[len(lines)-t.size:]
+	}
+
+	return lines
+}
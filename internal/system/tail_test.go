@@ -0,0 +1,83 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_lineTail_Write(t *testing.T) {
+	type fields struct {
+		size int
+	}
+	type args struct {
+		writes []string
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   []string
+	}{
+		{
+			name:   "empty",
+			fields: fields{size: 3},
+			args:   args{writes: nil},
+			want:   []string{},
+		},
+		{
+			name:   "less_lines_than_size",
+			fields: fields{size: 3},
+			args:   args{writes: []string{"line 1\n", "line 2\n"}},
+			want:   []string{"line 1", "line 2"},
+		},
+		{
+			name:   "more_lines_than_size",
+			fields: fields{size: 2},
+			args:   args{writes: []string{"line 1\nline 2\n", "line 3\n"}},
+			want:   []string{"line 2", "line 3"},
+		},
+		{
+			name:   "partial_lines",
+			fields: fields{size: 3},
+			args:   args{writes: []string{"li", "ne 1\nline", " 2\nline 3"}},
+			want:   []string{"line 1", "line 2", "line 3"},
+		},
+		{
+			name:   "partial_line_over_size",
+			fields: fields{size: 2},
+			args:   args{writes: []string{"line 1\nline 2\nline 3"}},
+			want:   []string{"line 2", "line 3"},
+		},
+		{
+			name:   "disabled",
+			fields: fields{size: 0},
+			args:   args{writes: []string{"line 1\n"}},
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tail := newLineTail(tt.fields.size)
+
+			for _, w := range tt.args.writes {
+				n, err := tail.Write([]byte(w))
+				if err != nil {
+					t.Fatalf("Write() unexpected error: %s", err)
+				}
+
+				if n != len(w) {
+					t.Errorf("Write() = %d, want %d", n, len(w))
+				}
+			}
+
+			got := tail.Lines()
+			if got == nil {
+				got = []string{}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// TerminationMessageMaxSize is the maximum size of a termination
+// message accepted by kubernetes, longer messages are truncated.
+const TerminationMessageMaxSize = 4096
+
+// TerminationMessage formats the final state of the wrapped process,
+// in a form suitable to be used as a kubernetes termination message;
+// the latest lines written by the process on its stderr are added
+// at the end of the message, dropping the oldest ones if the message
+// doesn't fit into TerminationMessageMaxSize bytes; a truncated line
+// keeps whole UTF-8 characters.
+func TerminationMessage(data WrapperData) string {
+	var header strings.Builder
+
+	fmt.Fprintf(&header, "status: %s\n", data.WrapperStatus)
+
+	var exitStatusError ProcessExitStatusError
+
+	switch {
+	case errors.As(data.Err, &exitStatusError):
+		fmt.Fprintf(&header, "exit status: %d\n", exitStatusError.ExitStatus())
+
+		fmt.Fprintf(&header, "reason: %s\n", exitStatusError.Reason())
+	case data.Err != nil:
+		fmt.Fprintf(&header, "error: %s\n", data.Err)
+	default:
+		fmt.Fprintf(&header, "exit status: %d\n", 0)
+	}
+
+	fmt.Fprintf(&header, "restarts: %d\n", data.Restarts)
+
+	message := header.String()
+	if len(message) >= TerminationMessageMaxSize {
+		return headBytes(message, TerminationMessageMaxSize)
+	}
+
+	if len(data.StdErrTail) == 0 {
+		return message
+	}
+
+	const stdErrHeader = "stderr:\n"
+
+	available := TerminationMessageMaxSize - len(message) - len(stdErrHeader)
+	if available <= 0 {
+		return message
+	}
+
+	// collect the lines starting from the most recent one, until
+	// there is space available in the message
+	var tail []string
+
+	for i := len(data.StdErrTail) - 1; i >= 0; i-- {
+		line := data.StdErrTail[i] + "\n"
+
+		if len(line) > available {
+			if len(tail) == 0 {
+				// keep at least the end of the most recent line
+				tail = append(tail, tailBytes(line, available))
+			}
+
+			break
+		}
+
+		tail = append(tail, line)
+		available -= len(line)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(message)
+	b.WriteString(stdErrHeader)
+
+	for i := len(tail) - 1; i >= 0; i-- {
+		b.WriteString(tail[i])
+	}
+
+	return b.String()
+}
+
+// headBytes returns the first n bytes of s at most, without cutting a
+// multi-byte character.
+func headBytes(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// tailBytes returns the last n bytes of s at most, without cutting a
+// multi-byte character.
+func tailBytes(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+
+	return s[start:]
+}
+
+// WriteTerminationMessage writes the termination message of the
+// wrapped process in the file at path.
+func WriteTerminationMessage(path string, data WrapperData) error {
+	return os.WriteFile(path, []byte(TerminationMessage(data)), 0o644) //nolint:gosec
+}
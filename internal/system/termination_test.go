@@ -0,0 +1,153 @@
+package system
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTerminationMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		data WrapperData
+		want string
+	}{
+		{
+			name: "Stopped",
+			data: WrapperData{WrapperStatus: WrapperStatusStopped, Done: true},
+			want: "status: stopped\nexit status: 0\nrestarts: 0\n",
+		},
+		{
+			name: "Exit_status",
+			data: WrapperData{
+				WrapperStatus: WrapperStatusError,
+				Err:           NewProcessExitStatusError(10),
+				Done:          true,
+				Restarts:      3,
+				StdErrTail:    []string{"first line", "second line"},
+			},
+			want: "status: error\nexit status: 10\nreason: exited with status 10\nrestarts: 3\nstderr:\nfirst line\nsecond line\n",
+		},
+		{
+			name: "Killed_by_signal",
+			data: WrapperData{
+				WrapperStatus: WrapperStatusError,
+				Err:           NewProcessSignalError(syscall.SIGSEGV, true),
+				Done:          true,
+			},
+			want: "status: error\nexit status: 139\nreason: killed by SIGSEGV (core dumped)\nrestarts: 0\n",
+		},
+		{
+			name: "Generic_error",
+			data: WrapperData{
+				WrapperStatus: WrapperStatusError,
+				Err:           errors.New("exec: not started"),
+				Done:          true,
+			},
+			want: "status: error\nerror: exec: not started\nrestarts: 0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TerminationMessage(tt.data); got != tt.want {
+				t.Errorf("TerminationMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		lines := make([]string, 0, 100)
+		for i := 0; i < 100; i++ {
+			lines = append(lines, strings.Repeat("x", 99))
+		}
+
+		lines[len(lines)-1] = "the last line"
+
+		got := TerminationMessage(WrapperData{
+			WrapperStatus: WrapperStatusError,
+			Err:           NewProcessExitStatusError(1),
+			StdErrTail:    lines,
+		})
+
+		if len(got) > TerminationMessageMaxSize {
+			t.Errorf("TerminationMessage() length = %d, want <= %d", len(got), TerminationMessageMaxSize)
+		}
+
+		if !strings.HasPrefix(got, "status: error\nexit status: 1\nreason: exited with status 1\n") {
+			t.Errorf("TerminationMessage() must start with the process status, got %q", got[:40])
+		}
+
+		if !strings.HasSuffix(got, "\nthe last line\n") {
+			t.Errorf("TerminationMessage() must end with the last stderr line")
+		}
+	})
+
+	t.Run("Truncated_long_line", func(t *testing.T) {
+		got := TerminationMessage(WrapperData{
+			WrapperStatus: WrapperStatusError,
+			StdErrTail:    []string{strings.Repeat("x", 2*TerminationMessageMaxSize) + "END"},
+		})
+
+		if len(got) != TerminationMessageMaxSize {
+			t.Errorf("TerminationMessage() length = %d, want %d", len(got), TerminationMessageMaxSize)
+		}
+
+		if !strings.HasSuffix(got, "END\n") {
+			t.Errorf("TerminationMessage() must keep the end of the last line")
+		}
+	})
+
+	t.Run("Truncated_multi_byte_characters", func(t *testing.T) {
+		// the header and the line don't split the characters of 3 bytes
+		// on a boundary of the available space
+		for _, prefix := range []string{"", "x", "xx"} {
+			got := TerminationMessage(WrapperData{
+				WrapperStatus: WrapperStatusError,
+				StdErrTail:    []string{prefix + strings.Repeat("€", TerminationMessageMaxSize) + "END"},
+			})
+
+			if !utf8.ValidString(got) {
+				t.Errorf("TerminationMessage() with prefix %q is not valid UTF-8: %q", prefix, got[:60])
+			}
+
+			if len(got) > TerminationMessageMaxSize {
+				t.Errorf("TerminationMessage() length = %d, want <= %d", len(got), TerminationMessageMaxSize)
+			}
+
+			if !strings.HasSuffix(got, "END\n") {
+				t.Errorf("TerminationMessage() must keep the end of the last line")
+			}
+		}
+
+		got := TerminationMessage(WrapperData{
+			WrapperStatus: WrapperStatusError,
+			Err:           errors.New(strings.Repeat("€", TerminationMessageMaxSize)),
+		})
+
+		if !utf8.ValidString(got) || len(got) > TerminationMessageMaxSize {
+			t.Errorf("TerminationMessage() of a long error: length %d, valid UTF-8 %t", len(got), utf8.ValidString(got))
+		}
+	})
+}
+
+func TestWriteTerminationMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "termination-log")
+
+	data := WrapperData{WrapperStatus: WrapperStatusError, Err: NewProcessExitStatusError(2), Restarts: 1}
+	if err := WriteTerminationMessage(path, data); err != nil {
+		t.Fatalf("WriteTerminationMessage() unexpected error: %s", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := TerminationMessage(data); string(got) != want {
+		t.Errorf("termination message file = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,23 @@
+package system
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// EnvPingToken is the environment variable with the ping token of the
+// wrapped process, a new token is generated every time it's started.
+const EnvPingToken = "LIVENESS_WRAPPER_PING_TOKEN"
+
+// pingTokenSize is the number of random bytes of a ping token.
+const pingTokenSize = 16
+
+// newPingToken returns a new random ping token, hex encoded.
+func newPingToken() (string, error) {
+	b := make([]byte, pingTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
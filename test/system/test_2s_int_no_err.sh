@@ -0,0 +1,8 @@
+#!/bin/sh
+
+trap 'echo "INT SIGNAL"; exit 0' INT
+trap 'echo "TERM SIGNAL"; exit 0' TERM
+
+i=0; while [ $i -le 199 ]; do i=$(( i + 1 )); sleep 0.01; done
+
+exit 0